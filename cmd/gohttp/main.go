@@ -0,0 +1,286 @@
+// Command gohttp sends http requests from the shell using httpclient, which makes it possible
+// to reproduce the requests sent by the services using the same client
+//
+//	gohttp [flags] [METHOD] URL
+//	gohttp -H "Accept: application/json" -q page=2 https://example.com/items
+//	echo '{"name":"item"}' | gohttp -token "$TOKEN" -d @- POST https://example.com/items
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sghaida/go-stuff/cmd/internal/cli"
+	"github.com/sghaida/go-stuff/src/httpclient"
+)
+
+// environment variables used when the auth flags aren't set
+const (
+	envBasic  = "GOHTTP_BASIC"
+	envToken  = "GOHTTP_TOKEN"
+	envAPIKey = "GOHTTP_API_KEY"
+)
+
+// exitFail is the exit code of responses with an error status when -fail is set, as curl does
+const exitFail = 22
+
+// options are the parsed command line
+type options struct {
+	method       string
+	target       string
+	headers      cli.MultiFlag
+	query        cli.MultiFlag
+	data         string
+	basic        string
+	token        string
+	apiKey       string
+	retries      int
+	timeout      time.Duration
+	maxRedirects int
+	verbose      bool
+	include      bool
+	raw          bool
+	fail         bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Getenv))
+}
+
+// run executes the command and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, getenv func(string) string) int {
+	opts, err := parseArgs(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "gohttp:", err)
+		return 2
+	}
+	code, err := send(opts, stdin, stdout, stderr, getenv)
+	if err != nil {
+		fmt.Fprintln(stderr, "gohttp:", err)
+		return 1
+	}
+	return code
+}
+
+// parseArgs parses the flags and the optional method followed by the url
+func parseArgs(args []string, stderr io.Writer) (*options, error) {
+	opts := &options{}
+	flags := flag.NewFlagSet("gohttp", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: gohttp [flags] [METHOD] URL")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.method, "X", "", "request method, GET or POST when a body is sent by default")
+	flags.Var(&opts.headers, "H", `request header "Name: value", repeatable`)
+	flags.Var(&opts.query, "q", "query param name=value, repeatable")
+	flags.StringVar(&opts.data, "d", "", "request body, @file reads a file and @- the standard input")
+	flags.StringVar(&opts.basic, "basic", "", "basic auth user:password, or $"+envBasic)
+	flags.StringVar(&opts.token, "token", "", "bearer jwt token, or $"+envToken)
+	flags.StringVar(&opts.apiKey, "api-key", "", "api key sent in x-api-key, or $"+envAPIKey)
+	flags.IntVar(&opts.retries, "retry", 0, "number of retries of idempotent requests on errors and 429, 5xx statuses")
+	flags.DurationVar(&opts.timeout, "timeout", 0, "timeout of the request including reading the body")
+	flags.IntVar(&opts.maxRedirects, "max-redirects", -1, "maximum redirects to follow, the client default if negative")
+	flags.BoolVar(&opts.verbose, "v", false, "dump the request and the response headers to the standard error")
+	flags.BoolVar(&opts.include, "i", false, "include the response status and headers in the output")
+	flags.BoolVar(&opts.raw, "raw", false, "don't pretty print json responses")
+	flags.BoolVar(&opts.fail, "fail", false, fmt.Sprintf("exit with %d on error statuses", exitFail))
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if opts.retries < 0 {
+		return nil, errors.New("-retry can't be negative")
+	}
+
+	switch flags.NArg() {
+	case 1:
+		opts.target = flags.Arg(0)
+	case 2:
+		if opts.method != "" {
+			return nil, errors.New("the method is set twice")
+		}
+		opts.method, opts.target = flags.Arg(0), flags.Arg(1)
+	default:
+		flags.Usage()
+		return nil, errors.New("expected [METHOD] URL")
+	}
+	if opts.method == "" {
+		opts.method = http.MethodGet
+		if opts.data != "" {
+			opts.method = http.MethodPost
+		}
+	}
+	opts.method = strings.ToUpper(opts.method)
+	return opts, nil
+}
+
+// send sends the request and writes the response, it returns the exit code
+func send(opts *options, stdin io.Reader, stdout, stderr io.Writer, getenv func(string) string) (int, error) {
+	host, route, err := cli.SplitURL(opts.target)
+	if err != nil {
+		return 0, err
+	}
+	basic, token, apiKey := opts.basic, opts.token, opts.apiKey
+	if basic == "" && token == "" && apiKey == "" {
+		basic, token, apiKey = getenv(envBasic), getenv(envToken), getenv(envAPIKey)
+	}
+	auth, err := cli.Auth(basic, token, apiKey)
+	if err != nil {
+		return 0, err
+	}
+	body, err := cli.ReadBody(opts.data, stdin)
+	if err != nil {
+		return 0, err
+	}
+	headers, err := cli.ParseHeaders(opts.headers)
+	if err != nil {
+		return 0, err
+	}
+	query, err := cli.ParseQuery(opts.query)
+	if err != nil {
+		return 0, err
+	}
+	if len(body) > 0 && !cli.HasHeader(headers, "Content-Type") && json.Valid(body) {
+		headers["Content-Type"] = httpclient.MediaTypeJSON
+	}
+
+	// the client retry count is the number of attempts
+	config := httpclient.NewConfig().WithTimeout(opts.timeout).WithRetry(opts.retries + 1)
+	if opts.maxRedirects >= 0 {
+		policy, err := httpclient.NewRedirectPolicy().WithMaxHops(opts.maxRedirects).Build()
+		if err != nil {
+			return 0, err
+		}
+		config.WithRedirectPolicy(policy)
+	}
+	cfg, err := config.Build()
+	if err != nil {
+		return 0, err
+	}
+	httpClient := &http.Client{}
+	if opts.verbose {
+		base, _ := http.DefaultTransport.(*http.Transport)
+		httpClient.Transport = &dumpTransport{next: base.Clone(), out: stderr}
+	}
+	client, err := httpclient.NewClient(cfg, httpClient, auth)
+	if err != nil {
+		return 0, err
+	}
+
+	caller, err := httpclient.NewCallerBuilder(client, host, route, httpclient.HttpMethod(opts.method)).
+		WithHeaders(headers).
+		WithQueryParam(query).
+		WithRequestBody(body).
+		Build()
+	if err != nil {
+		return 0, err
+	}
+	call := caller.CallWithContext
+	if opts.retries > 0 {
+		call = caller.RetryableCallWithContext
+	}
+	resp, err := call(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if opts.include {
+		if err := writeHead(stdout, resp); err != nil {
+			return 0, err
+		}
+	}
+	if err := writeBody(stdout, resp, opts.raw); err != nil {
+		return 0, err
+	}
+	if opts.fail && resp.StatusCode >= http.StatusBadRequest {
+		return exitFail, nil
+	}
+	return 0, nil
+}
+
+// writeHead writes the status line and the headers of the response
+func writeHead(w io.Writer, resp *http.Response) error {
+	if _, err := fmt.Fprintf(w, "%s %s\n", resp.Proto, resp.Status); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(w); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// writeBody copies the response body, json bodies are indented unless raw is set
+func writeBody(w io.Writer, resp *http.Response, raw bool) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	isJSON := mediaType == httpclient.MediaTypeJSON || strings.HasSuffix(mediaType, "+json")
+	if raw || !isJSON {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read response body: %w", err)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		// not valid json after all
+		_, err := w.Write(body)
+		return err
+	}
+	indented.WriteString("\n")
+	_, err = w.Write(indented.Bytes())
+	return err
+}
+
+// dumpTransport writes the requests as sent on the wire and the response headers
+type dumpTransport struct {
+	next http.RoundTripper
+	out  io.Writer
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		writeDump(t.out, "> ", dump)
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintf(t.out, "* %s %s failed after %s: %v\n", req.Method, req.URL, time.Since(start), err)
+		return nil, err
+	}
+	if dump, err := httputil.DumpResponse(resp, false); err == nil {
+		writeDump(t.out, "< ", dump)
+	}
+	fmt.Fprintf(t.out, "* %s %s took %s\n", req.Method, req.URL, time.Since(start))
+	return resp, nil
+}
+
+// writeDump writes the lines of the dump with the prefix, the body lines aren't prefixed
+func writeDump(w io.Writer, prefix string, dump []byte) {
+	head, body, _ := cli.Cut(string(dump), "\r\n\r\n")
+	for _, line := range strings.Split(head, "\r\n") {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+	fmt.Fprintln(w, prefix)
+	if body != "" {
+		fmt.Fprintln(w, body)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	var attempts int32
+	// the server echoes the request as json, /text replies with plain text and /flaky fails once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("plain text"))
+			return
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "/flaky":
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/redirect":
+			http.Redirect(w, r, "/text", http.StatusFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Method", r.Method)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"method": r.Method,
+			"query":  r.URL.RawQuery,
+			"auth":   r.Header.Get("Authorization") + r.Header.Get("x-api-key"),
+			"header": r.Header.Get("X-Custom"),
+			"type":   r.Header.Get("Content-Type"),
+			"body":   string(body),
+		})
+	}))
+	defer server.Close()
+
+	env := map[string]string{}
+	exec := func(stdin string, args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(args, strings.NewReader(stdin), &stdout, &stderr, func(key string) string {
+			return env[key]
+		})
+		return code, stdout.String(), stderr.String()
+	}
+
+	t.Run("get with headers and query params", func(t *testing.T) {
+		code, out, _ := exec("", "-H", "X-Custom: a", "-H", "x-custom: b", "-q", "page=2", server.URL+"/items?sort=name")
+		assert.Equal(t, 0, code)
+		assert.Contains(t, out, `"method": "GET"`)
+		assert.Contains(t, out, `"header": "a, b"`)
+		assert.Contains(t, out, "page=2")
+		assert.Contains(t, out, "sort=name")
+	})
+
+	t.Run("body from stdin and file", func(t *testing.T) {
+		code, out, _ := exec(`{"name":"item"}`, "-d", "@-", server.URL+"/items")
+		assert.Equal(t, 0, code)
+		assert.Contains(t, out, `"method": "POST"`)
+		assert.Contains(t, out, `"type": "application/json"`)
+		assert.Contains(t, out, `"body": "{\"name\":\"item\"}"`)
+
+		file := filepath.Join(t.TempDir(), "body.txt")
+		assert.NoError(t, os.WriteFile(file, []byte("from file"), 0o600))
+		code, out, _ = exec("", "-d", "@"+file, "-H", "Content-Type: text/plain", "PUT", server.URL+"/items")
+		assert.Equal(t, 0, code)
+		assert.Contains(t, out, `"method": "PUT"`)
+		assert.Contains(t, out, `"body": "from file"`)
+	})
+
+	t.Run("auth from flags and env", func(t *testing.T) {
+		_, out, _ := exec("", "-token", "jwt", server.URL)
+		assert.Contains(t, out, `"auth": "Bearer jwt"`)
+
+		env[envAPIKey] = "key"
+		_, out, _ = exec("", server.URL)
+		assert.Contains(t, out, `"auth": "key"`)
+		// the flags override the environment
+		_, out, _ = exec("", "-basic", "user:pass", server.URL)
+		assert.Contains(t, out, `"auth": "Basic dXNlcjpwYXNz"`)
+		delete(env, envAPIKey)
+
+		code, _, errOut := exec("", "-token", "jwt", "-api-key", "key", server.URL)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, errOut, "only one of")
+	})
+
+	t.Run("raw and include", func(t *testing.T) {
+		_, out, _ := exec("", "-raw", server.URL)
+		assert.True(t, strings.HasPrefix(out, `{"auth":"",`))
+
+		_, out, _ = exec("", "-i", server.URL+"/text")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\n"))
+		assert.Contains(t, out, "Content-Type: text/plain")
+		assert.True(t, strings.HasSuffix(out, "\r\n\nplain text"))
+	})
+
+	t.Run("verbose", func(t *testing.T) {
+		code, _, errOut := exec("", "-v", "-api-key", "secret", "-d", "payload", server.URL+"/redirect")
+		assert.Equal(t, 0, code)
+		assert.Contains(t, errOut, "> POST /redirect HTTP/1.1")
+		assert.Contains(t, errOut, "> X-Api-Key: secret")
+		assert.Contains(t, errOut, "payload")
+		assert.Contains(t, errOut, "< HTTP/1.1 302 Found")
+		assert.Contains(t, errOut, "> GET /text HTTP/1.1")
+		assert.Contains(t, errOut, "< HTTP/1.1 200 OK")
+	})
+
+	t.Run("redirects not followed", func(t *testing.T) {
+		_, out, _ := exec("", "-i", "-max-redirects", "0", server.URL+"/redirect")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 302 Found"))
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		_, out, _ := exec("", "-i", server.URL+"/flaky")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 503"))
+		atomic.StoreInt32(&attempts, 0)
+		_, out, _ = exec("", "-i", "-retry", "1", server.URL+"/flaky")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200"))
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		code, _, _ := exec("", server.URL+"/missing")
+		assert.Equal(t, 0, code)
+		code, _, _ = exec("", "-fail", server.URL+"/missing")
+		assert.Equal(t, exitFail, code)
+	})
+
+	t.Run("invalid usage", func(t *testing.T) {
+		tt := []struct {
+			name string
+			args []string
+			code int
+		}{
+			{name: "no url", args: []string{}, code: 2},
+			{name: "method set twice", args: []string{"-X", "GET", "POST", server.URL}, code: 2},
+			{name: "malformed header", args: []string{"-H", "no colon", server.URL}, code: 1},
+			{name: "malformed query", args: []string{"-q", "novalue", server.URL}, code: 1},
+			{name: "malformed basic auth", args: []string{"-basic", "user", server.URL}, code: 1},
+			{name: "missing body file", args: []string{"-d", "@/does/not/exist", server.URL}, code: 1},
+			{name: "unreachable", args: []string{"http://127.0.0.1:1"}, code: 1},
+			{name: "help", args: []string{"-h"}, code: 0},
+		}
+		for _, tc := range tt {
+			t.Run(tc.name, func(t *testing.T) {
+				code, _, _ := exec("", tc.args...)
+				assert.Equal(t, tc.code, code)
+			})
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Histogram records latencies in microseconds into log linear buckets as HDR histograms do:
+// the values are grouped by power of two magnitudes, each split into linear sub buckets, which
+// keeps the relative error of the recorded values under 10^-significantDigits whatever their range
+type Histogram struct {
+	subBucketBits  uint
+	subBucketCount int
+	subBucketHalf  int
+	counts         []uint64
+	total          uint64
+	min            int64
+	max            int64
+	sum            float64
+	sumSquares     float64
+}
+
+// NewHistogram creates a histogram keeping the given number of significant digits, between 1 and 5
+func NewHistogram(significantDigits int) *Histogram {
+	if significantDigits < 1 {
+		significantDigits = 1
+	}
+	if significantDigits > 5 {
+		significantDigits = 5
+	}
+	// the sub buckets of a magnitude must distinguish 2 * 10^digits values
+	largest := 2 * math.Pow10(significantDigits)
+	subBucketBits := uint(math.Ceil(math.Log2(largest)))
+	return &Histogram{
+		subBucketBits:  subBucketBits,
+		subBucketCount: 1 << subBucketBits,
+		subBucketHalf:  1 << (subBucketBits - 1),
+		min:            math.MaxInt64,
+	}
+}
+
+// Record records a latency
+func (h *Histogram) Record(d time.Duration) {
+	h.recordValue(d.Microseconds(), 1)
+}
+
+// recordValue records count occurrences of a value in microseconds
+func (h *Histogram) recordValue(value int64, count uint64) {
+	if value < 0 {
+		value = 0
+	}
+	index := h.index(value)
+	if index >= len(h.counts) {
+		counts := make([]uint64, index+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[index] += count
+	h.total += count
+	if value < h.min {
+		h.min = value
+	}
+	if value > h.max {
+		h.max = value
+	}
+	h.sum += float64(value) * float64(count)
+	h.sumSquares += float64(value) * float64(value) * float64(count)
+}
+
+// Count returns the number of recorded values
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+// Min returns the smallest recorded latency
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min) * time.Microsecond
+}
+
+// Max returns the largest recorded latency
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Mean returns the mean of the recorded latencies
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/float64(h.total)) * time.Microsecond
+}
+
+// StdDev returns the standard deviation of the recorded latencies
+func (h *Histogram) StdDev() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	mean := h.sum / float64(h.total)
+	variance := h.sumSquares/float64(h.total) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	return time.Duration(math.Sqrt(variance)) * time.Microsecond
+}
+
+// Percentile returns the latency under which the given percentage of the values fall,
+// as the highest value equivalent to the recorded ones within the precision of the histogram
+func (h *Histogram) Percentile(percentile float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if percentile > 100 {
+		percentile = 100
+	}
+	target := uint64(math.Ceil(percentile / 100 * float64(h.total)))
+	if target == 0 {
+		target = 1
+	}
+	var seen uint64
+	for index, count := range h.counts {
+		seen += count
+		if seen >= target {
+			value := h.highest(index)
+			if value > h.max {
+				value = h.max
+			}
+			if value < h.min {
+				value = h.min
+			}
+			return time.Duration(value) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
+
+// index returns the bucket of a value, the values under subBucketCount have their own bucket
+// then each magnitude has subBucketHalf buckets
+func (h *Histogram) index(value int64) int {
+	if value < int64(h.subBucketCount) {
+		return int(value)
+	}
+	shift := uint(bits.Len64(uint64(value))) - h.subBucketBits
+	return h.subBucketCount + int(shift-1)*h.subBucketHalf + int(value>>shift) - h.subBucketHalf
+}
+
+// lowest returns the lowest value of a bucket
+func (h *Histogram) lowest(index int) int64 {
+	if index < h.subBucketCount {
+		return int64(index)
+	}
+	offset := index - h.subBucketCount
+	shift := uint(offset/h.subBucketHalf + 1)
+	return int64(offset%h.subBucketHalf+h.subBucketHalf) << shift
+}
+
+// highest returns the highest value of a bucket
+func (h *Histogram) highest(index int) int64 {
+	if index < h.subBucketCount {
+		return int64(index)
+	}
+	shift := uint((index-h.subBucketCount)/h.subBucketHalf + 1)
+	return h.lowest(index) + 1<<shift - 1
+}
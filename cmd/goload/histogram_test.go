@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		h := NewHistogram(3)
+		assert.Equal(t, uint64(0), h.Count())
+		assert.Equal(t, time.Duration(0), h.Min())
+		assert.Equal(t, time.Duration(0), h.Percentile(99))
+		assert.Equal(t, time.Duration(0), h.Mean())
+	})
+
+	t.Run("percentiles", func(t *testing.T) {
+		h := NewHistogram(3)
+		// 1ms to 10s
+		for i := 1; i <= 10000; i++ {
+			h.Record(time.Duration(i) * time.Millisecond)
+		}
+		assert.Equal(t, uint64(10000), h.Count())
+		assert.Equal(t, time.Millisecond, h.Min())
+		assert.Equal(t, 10*time.Second, h.Max())
+		assert.InDelta(t, float64(5000500*time.Microsecond), float64(h.Mean()), float64(time.Microsecond))
+
+		tt := []struct {
+			percentile float64
+			expected   time.Duration
+		}{
+			{percentile: 0, expected: time.Millisecond},
+			{percentile: 50, expected: 5 * time.Second},
+			{percentile: 90, expected: 9 * time.Second},
+			{percentile: 99, expected: 9900 * time.Millisecond},
+			{percentile: 99.9, expected: 9990 * time.Millisecond},
+			{percentile: 100, expected: 10 * time.Second},
+		}
+		for _, tc := range tt {
+			actual := h.Percentile(tc.percentile)
+			// the values are within the precision of 3 significant digits
+			assert.InEpsilon(t, float64(tc.expected), float64(actual), 0.001, "p%v is %v", tc.percentile, actual)
+			assert.GreaterOrEqual(t, int64(actual), int64(tc.expected))
+		}
+	})
+
+	t.Run("standard deviation", func(t *testing.T) {
+		h := NewHistogram(2)
+		h.Record(2 * time.Millisecond)
+		h.Record(4 * time.Millisecond)
+		assert.Equal(t, time.Millisecond, h.StdDev())
+	})
+
+	t.Run("buckets", func(t *testing.T) {
+		h := NewHistogram(3)
+		assert.Equal(t, 2048, h.subBucketCount)
+		// the buckets cover every value once, their width keeps the relative error under 0.1%
+		previous := int64(-1)
+		for index := 0; index < 20*h.subBucketHalf; index++ {
+			lowest, highest := h.lowest(index), h.highest(index)
+			assert.Equal(t, previous+1, lowest)
+			assert.Equal(t, index, h.index(lowest))
+			assert.Equal(t, index, h.index(highest))
+			assert.LessOrEqual(t, float64(highest-lowest), math.Max(1, float64(lowest)/1000))
+			previous = highest
+		}
+	})
+}
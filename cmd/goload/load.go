@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/httpclient"
+)
+
+// significantDigits is the precision of the latency histogram
+const significantDigits = 3
+
+// load drives a Caller at a fixed rate or with a fixed concurrency for a duration
+type load struct {
+	call func(ctx context.Context) (*http.Response, error)
+	// rate is the number of requests per second, the load has a fixed concurrency if 0
+	rate float64
+	// concurrency is the number of workers, or the maximum requests in flight at a fixed rate
+	concurrency int
+	duration    time.Duration
+
+	mutex     *sync.Mutex
+	latencies *Histogram
+	statuses  map[int]int
+	errors    map[string]int
+	dropped   int
+	canceled  int
+}
+
+// newLoad creates a load calling the caller, retryable calls use the retry of the client config
+func newLoad(caller *httpclient.Caller, retryable bool, rate float64, concurrency int, duration time.Duration) *load {
+	call := caller.CallWithContext
+	if retryable {
+		call = caller.RetryableCallWithContext
+	}
+	return &load{
+		call:        call,
+		rate:        rate,
+		concurrency: concurrency,
+		duration:    duration,
+		mutex:       new(sync.Mutex),
+		latencies:   NewHistogram(significantDigits),
+		statuses:    make(map[int]int),
+		errors:      make(map[string]int),
+	}
+}
+
+// run sends the requests until the duration elapses or ctx is done, then waits for the requests
+// in flight and reports the results
+func (l *load) run(ctx context.Context) *Report {
+	start := time.Now()
+	sendCtx, cancel := context.WithTimeout(ctx, l.duration)
+	defer cancel()
+	if l.rate > 0 {
+		l.runAtRate(ctx, sendCtx)
+	} else {
+		l.runConcurrently(ctx, sendCtx)
+	}
+	return l.report(time.Since(start))
+}
+
+// runAtRate schedules the requests at a fixed rate, the latency is measured from the scheduled time
+// so that a slow server doesn't hide the requests it delayed. the requests scheduled while the
+// maximum requests are in flight are dropped
+func (l *load) runAtRate(ctx, sendCtx context.Context) {
+	interval := time.Duration(float64(time.Second) / l.rate)
+	inFlight := make(chan struct{}, l.concurrency)
+	wg := new(sync.WaitGroup)
+	defer wg.Wait()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	next := time.Now()
+	for {
+		select {
+		case <-sendCtx.Done():
+			return
+		case <-timer.C:
+		}
+		select {
+		case inFlight <- struct{}{}:
+			wg.Add(1)
+			go func(scheduled time.Time) {
+				defer wg.Done()
+				l.send(ctx, scheduled)
+				<-inFlight
+			}(next)
+		default:
+			l.mutex.Lock()
+			l.dropped++
+			l.mutex.Unlock()
+		}
+		next = next.Add(interval)
+		timer.Reset(time.Until(next))
+	}
+}
+
+// runConcurrently keeps the workers sending requests one after the other
+func (l *load) runConcurrently(ctx, sendCtx context.Context) {
+	wg := new(sync.WaitGroup)
+	for i := 0; i < l.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sendCtx.Err() == nil {
+				l.send(ctx, time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// send sends a request and records its latency until the body is read, and its status or error.
+// the requests interrupted by ctx being canceled e.g. with Ctrl-C are only counted as canceled
+func (l *load) send(ctx context.Context, start time.Time) {
+	resp, err := l.call(ctx)
+	if err == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	latency := time.Since(start)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err != nil && errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		l.canceled++
+		return
+	}
+	l.latencies.Record(latency)
+	if err != nil {
+		l.errors[errorKind(err)]++
+		return
+	}
+	l.statuses[resp.StatusCode]++
+}
+
+// errorKind groups the errors by cause for the report
+func errorKind(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection reset"
+	case errors.Is(err, httpclient.ErrBulkheadFull), errors.Is(err, httpclient.ErrLimitExceeded):
+		return "rejected"
+	}
+	return "other"
+}
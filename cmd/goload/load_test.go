@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	var requests, inFlight, maxInFlight int32
+	// every third request fails, /slow takes 50ms
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if r.Header.Get("x-api-key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if atomic.AddInt32(&requests, 1)%3 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	exec := func(args ...string) (int, *Report, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(context.Background(), append([]string{"-json"}, args...), strings.NewReader(""), &stdout, &stderr)
+		var report *Report
+		if code == 0 {
+			report = &Report{}
+			assert.NoError(t, json.Unmarshal(stdout.Bytes(), report))
+		}
+		return code, report, stderr.String()
+	}
+
+	t.Run("fixed rate", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		code, report, _ := exec("-rate", "100", "-duration", "500ms", "-api-key", "secret", server.URL)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "rate", report.Mode)
+		assert.InDelta(t, 50, report.Requests, 5)
+		assert.Equal(t, report.Requests, report.Succeeded+report.Failed)
+		assert.Equal(t, report.Statuses["503"], report.Classes["5xx"])
+		assert.Equal(t, report.Requests/3, report.Statuses["503"])
+		assert.Equal(t, report.Succeeded, report.Statuses["200"])
+		assert.Greater(t, report.Latency.P50, 0.0)
+		assert.LessOrEqual(t, report.Latency.P50, report.Latency.P99)
+		assert.LessOrEqual(t, report.Latency.P99, report.Latency.Max)
+		assert.InDelta(t, 100, report.Throughput, 20)
+	})
+
+	t.Run("fixed rate drops above the requests in flight", func(t *testing.T) {
+		code, report, _ := exec("-rate", "200", "-c", "1", "-duration", "300ms", server.URL+"/slow")
+		assert.Equal(t, 0, code)
+		assert.Greater(t, report.Dropped, 0)
+		assert.Equal(t, report.Requests, report.Statuses["401"])
+		assert.Equal(t, report.Requests, report.Classes["4xx"])
+	})
+
+	t.Run("fixed concurrency", func(t *testing.T) {
+		atomic.StoreInt32(&maxInFlight, 0)
+		code, report, _ := exec("-c", "4", "-duration", "300ms", "-api-key", "secret", server.URL+"/slow")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "concurrency", report.Mode)
+		assert.Equal(t, int32(4), atomic.LoadInt32(&maxInFlight))
+		// 4 workers sending a 50ms request after the other during 300ms, the last ones end after 300ms
+		assert.LessOrEqual(t, report.Requests, 28)
+		assert.GreaterOrEqual(t, report.Requests, 12)
+		assert.GreaterOrEqual(t, report.Latency.Min, 50.0)
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		code, report, _ := exec("-c", "1", "-duration", "200ms", "-retry", "1", "-api-key", "secret", server.URL)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, 0, report.Failed)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		code, report, _ := exec("-c", "1", "-duration", "100ms", "http://127.0.0.1:1")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, report.Requests, report.Errors["connection refused"])
+		assert.Equal(t, report.Requests, report.Failed)
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		var stdout, stderr bytes.Buffer
+		code := run(ctx, []string{"-json", "-c", "4", "-duration", "10s", "-api-key", "secret", server.URL + "/slow"},
+			strings.NewReader(""), &stdout, &stderr)
+		assert.Equal(t, 0, code)
+		report := &Report{}
+		assert.NoError(t, json.Unmarshal(stdout.Bytes(), report))
+		// the requests in flight are canceled, not failed
+		assert.Greater(t, report.Canceled, 0)
+		assert.LessOrEqual(t, report.Canceled, 4)
+		assert.Equal(t, 0, report.Errors["canceled"])
+		assert.Equal(t, report.Requests, report.Succeeded+report.Failed)
+	})
+
+	t.Run("text report", func(t *testing.T) {
+		var stdout bytes.Buffer
+		code := run(context.Background(), []string{"-c", "1", "-duration", "100ms", server.URL},
+			strings.NewReader(""), &stdout, &stdout)
+		assert.Equal(t, 0, code)
+		for _, line := range []string{"mode", "requests", "throughput", "latency", "percentiles", "statuses", "classes"} {
+			assert.Contains(t, stdout.String(), line+" ")
+		}
+		assert.Contains(t, stdout.String(), "401: ")
+	})
+
+	t.Run("invalid usage", func(t *testing.T) {
+		for _, args := range [][]string{
+			{}, {"-rate", "-1", server.URL}, {"-c", "0", server.URL}, {"-duration", "0s", server.URL},
+			{"-X", "GET", "POST", server.URL},
+		} {
+			code, _, _ := exec(args...)
+			assert.Equal(t, 2, code, args)
+		}
+		code, _, _ := exec("-token", "a", "-api-key", "b", server.URL)
+		assert.Equal(t, 1, code)
+	})
+}
@@ -0,0 +1,174 @@
+// Command goload drives an http endpoint at a fixed rate or with a fixed concurrency for a duration
+// using httpclient, and reports the latency percentiles, the errors and the throughput
+//
+//	goload -rate 100 -duration 30s http://localhost:8080/items
+//	goload -c 20 -duration 1m -json -token "$TOKEN" -d @item.json POST http://localhost:8080/items
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/sghaida/go-stuff/cmd/internal/cli"
+	"github.com/sghaida/go-stuff/src/httpclient"
+)
+
+// options are the parsed command line
+type options struct {
+	method      string
+	target      string
+	headers     cli.MultiFlag
+	data        string
+	basic       string
+	token       string
+	apiKey      string
+	rate        float64
+	concurrency int
+	duration    time.Duration
+	timeout     time.Duration
+	retries     int
+	json        bool
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command and returns the exit code, interrupting ctx stops the load early
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseArgs(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "goload:", err)
+		return 2
+	}
+	l, err := newLoadFromOptions(opts, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "goload:", err)
+		return 1
+	}
+
+	report := l.run(ctx)
+	if opts.json {
+		err = report.WriteJSON(stdout)
+	} else {
+		err = report.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "goload:", err)
+		return 1
+	}
+	return 0
+}
+
+// parseArgs parses the flags and the optional method followed by the url
+func parseArgs(args []string, stderr io.Writer) (*options, error) {
+	opts := &options{}
+	flags := flag.NewFlagSet("goload", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: goload [flags] [METHOD] URL")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.method, "X", "", "request method, GET or POST when a body is sent by default")
+	flags.Var(&opts.headers, "H", `request header "Name: value", repeatable`)
+	flags.StringVar(&opts.data, "d", "", "request body, @file reads a file and @- the standard input")
+	flags.StringVar(&opts.basic, "basic", "", "basic auth user:password")
+	flags.StringVar(&opts.token, "token", "", "bearer jwt token")
+	flags.StringVar(&opts.apiKey, "api-key", "", "api key sent in x-api-key")
+	flags.Float64Var(&opts.rate, "rate", 0, "requests per second, the load has a fixed concurrency if 0")
+	flags.IntVar(&opts.concurrency, "c", 10, "concurrent workers, or the maximum requests in flight at a fixed rate")
+	flags.DurationVar(&opts.duration, "duration", 10*time.Second, "duration of the load")
+	flags.DurationVar(&opts.timeout, "timeout", 30*time.Second, "timeout of each request")
+	flags.IntVar(&opts.retries, "retry", 0, "number of retries of idempotent requests on errors and 429, 5xx statuses")
+	flags.BoolVar(&opts.json, "json", false, "write the report as json")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opts.rate < 0:
+		return nil, errors.New("-rate can't be negative")
+	case opts.concurrency <= 0:
+		return nil, errors.New("-c must be positive")
+	case opts.duration <= 0:
+		return nil, errors.New("-duration must be positive")
+	case opts.retries < 0:
+		return nil, errors.New("-retry can't be negative")
+	}
+	switch flags.NArg() {
+	case 1:
+		opts.target = flags.Arg(0)
+	case 2:
+		if opts.method != "" {
+			return nil, errors.New("the method is set twice")
+		}
+		opts.method, opts.target = flags.Arg(0), flags.Arg(1)
+	default:
+		flags.Usage()
+		return nil, errors.New("expected [METHOD] URL")
+	}
+	if opts.method == "" {
+		opts.method = http.MethodGet
+		if opts.data != "" {
+			opts.method = http.MethodPost
+		}
+	}
+	opts.method = strings.ToUpper(opts.method)
+	return opts, nil
+}
+
+// newLoadFromOptions builds the client and the caller of the load
+func newLoadFromOptions(opts *options, stdin io.Reader) (*load, error) {
+	host, route, err := cli.SplitURL(opts.target)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := cli.Auth(opts.basic, opts.token, opts.apiKey)
+	if err != nil {
+		return nil, err
+	}
+	body, err := cli.ReadBody(opts.data, stdin)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := cli.ParseHeaders(opts.headers)
+	if err != nil {
+		return nil, err
+	}
+
+	// the client retry count is the number of attempts
+	config, err := httpclient.NewConfig().
+		WithTimeout(opts.timeout).
+		WithRetry(opts.retries + 1).
+		WithMaxIdleConnsPerHost(opts.concurrency).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	client, err := httpclient.NewClient(config, &http.Client{}, auth)
+	if err != nil {
+		return nil, err
+	}
+	caller, err := httpclient.NewCallerBuilder(client, host, route, httpclient.HttpMethod(opts.method)).
+		WithHeaders(headers).
+		WithRequestBody(body).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	return newLoad(caller, opts.retries > 0, opts.rate, opts.concurrency, opts.duration), nil
+}
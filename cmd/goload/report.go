@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Report is the result of a load, the requests in flight when the load is interrupted
+// are Canceled and not part of the Requests
+type Report struct {
+	Mode       string  `json:"mode"`
+	Duration   float64 `json:"durationSeconds"`
+	Requests   int     `json:"requests"`
+	Succeeded  int     `json:"succeeded"`
+	Failed     int     `json:"failed"`
+	Dropped    int     `json:"dropped"`
+	Canceled   int     `json:"canceled"`
+	Throughput float64 `json:"throughput"`
+	Latency    Latency `json:"latencyMs"`
+	// Statuses counts the responses by status code and Classes by status class e.g. 5xx
+	Statuses map[string]int `json:"statuses"`
+	Classes  map[string]int `json:"classes"`
+	// Errors counts the requests which got no response by cause
+	Errors map[string]int `json:"errors"`
+}
+
+// Latency holds the latency statistics in milliseconds
+type Latency struct {
+	Min    float64 `json:"min"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stdDev"`
+	P50    float64 `json:"p50"`
+	P90    float64 `json:"p90"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+	P999   float64 `json:"p99.9"`
+	Max    float64 `json:"max"`
+}
+
+// report summarizes the results of the load, the responses with a status of 400 or more are failures
+func (l *load) report(elapsed time.Duration) *Report {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	report := &Report{
+		Mode:     "concurrency",
+		Duration: elapsed.Seconds(),
+		Dropped:  l.dropped,
+		Canceled: l.canceled,
+		Statuses: make(map[string]int),
+		Classes:  make(map[string]int),
+		Errors:   make(map[string]int),
+	}
+	if l.rate > 0 {
+		report.Mode = "rate"
+	}
+	for status, count := range l.statuses {
+		report.Requests += count
+		report.Statuses[strconv.Itoa(status)] += count
+		report.Classes[fmt.Sprintf("%dxx", status/100)] += count
+		if status >= http.StatusBadRequest {
+			report.Failed += count
+			continue
+		}
+		report.Succeeded += count
+	}
+	for kind, count := range l.errors {
+		report.Requests += count
+		report.Failed += count
+		report.Errors[kind] = count
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(report.Requests) / elapsed.Seconds()
+	}
+
+	h := l.latencies
+	report.Latency = Latency{
+		Min:    milliseconds(h.Min()),
+		Mean:   milliseconds(h.Mean()),
+		StdDev: milliseconds(h.StdDev()),
+		P50:    milliseconds(h.Percentile(50)),
+		P90:    milliseconds(h.Percentile(90)),
+		P95:    milliseconds(h.Percentile(95)),
+		P99:    milliseconds(h.Percentile(99)),
+		P999:   milliseconds(h.Percentile(99.9)),
+		Max:    milliseconds(h.Max()),
+	}
+	return report
+}
+
+// WriteJSON writes the indented json report
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteText writes the report as aligned text
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "mode\t%s\n", r.Mode)
+	fmt.Fprintf(tw, "duration\t%.2fs\n", r.Duration)
+	fmt.Fprintf(tw, "requests\t%d\tsucceeded %d\tfailed %d\tdropped %d\tcanceled %d\n",
+		r.Requests, r.Succeeded, r.Failed, r.Dropped, r.Canceled)
+	fmt.Fprintf(tw, "throughput\t%.2f req/s\n", r.Throughput)
+	l := r.Latency
+	fmt.Fprintf(tw, "latency\tmin %.2fms\tmean %.2fms\tstddev %.2fms\tmax %.2fms\n", l.Min, l.Mean, l.StdDev, l.Max)
+	fmt.Fprintf(tw, "percentiles\tp50 %.2fms\tp90 %.2fms\tp95 %.2fms\tp99 %.2fms\tp99.9 %.2fms\n",
+		l.P50, l.P90, l.P95, l.P99, l.P999)
+	fmt.Fprintf(tw, "statuses\t%s\n", counts(r.Statuses))
+	fmt.Fprintf(tw, "classes\t%s\n", counts(r.Classes))
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(tw, "errors\t%s\n", counts(r.Errors))
+	}
+	return tw.Flush()
+}
+
+// counts formats the counts sorted by key
+func counts(values map[string]int) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %d", key, values[key]))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
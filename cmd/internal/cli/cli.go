@@ -0,0 +1,143 @@
+// Package cli holds the command line parsing shared by the commands
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+)
+
+// MultiFlag is a repeatable flag
+type MultiFlag []string
+
+func (f *MultiFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+// Set appends the value
+func (f *MultiFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// SplitURL splits the url into the host and the route of the Caller
+func SplitURL(target string) (string, string, error) {
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed url: %w", err)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("malformed url %q: missing host", target)
+	}
+	route := u.EscapedPath()
+	if route == "" {
+		route = "/"
+	}
+	if u.RawQuery != "" {
+		route += "?" + u.RawQuery
+	}
+	return u.Scheme + "://" + u.Host, route, nil
+}
+
+// Auth returns the auth of the basic user:password, the jwt token or the api key, at most one can be set
+func Auth(basic, token, apiKey string) (cauth.IAuth, error) {
+	set := 0
+	for _, value := range []string{basic, token, apiKey} {
+		if value != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("only one of basic, token and api key auth can be used")
+	}
+	switch {
+	case basic != "":
+		user, password, ok := Cut(basic, ":")
+		if !ok {
+			return nil, errors.New("basic auth must be user:password")
+		}
+		return cauth.NewBasicAuth(user, password), nil
+	case token != "":
+		return cauth.NewJWTAuth(token), nil
+	case apiKey != "":
+		return cauth.NewAPIKey(apiKey), nil
+	}
+	return cauth.NoAuth, nil
+}
+
+// ReadBody returns the body given inline, from a file using @file or from the standard input using @-
+func ReadBody(data string, stdin io.Reader) ([]byte, error) {
+	switch {
+	case data == "@-":
+		body, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the standard input: %w", err)
+		}
+		return body, nil
+	case strings.HasPrefix(data, "@"):
+		body, err := os.ReadFile(data[1:])
+		if err != nil {
+			return nil, fmt.Errorf("unable to read body file: %w", err)
+		}
+		return body, nil
+	}
+	return []byte(data), nil
+}
+
+// ParseHeaders parses the "Name: value" headers, the values of a repeated header are comma separated
+func ParseHeaders(values []string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, value := range values {
+		name, v, ok := Cut(value, ":")
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("malformed header %q, expected \"Name: value\"", value)
+		}
+		v = strings.TrimSpace(v)
+		if previous, ok := headers[name]; ok {
+			v = previous + ", " + v
+		}
+		headers[name] = v
+	}
+	return headers, nil
+}
+
+// ParseQuery parses the name=value query params
+func ParseQuery(values []string) (map[string]string, error) {
+	query := make(map[string]string)
+	for _, value := range values {
+		name, v, ok := Cut(value, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("malformed query param %q, expected name=value", value)
+		}
+		query[name] = v
+	}
+	return query, nil
+}
+
+// HasHeader reports whether the header is set regardless of its case
+func HasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cut slices s around the first instance of sep, strings.Cut requires go 1.18
+func Cut(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
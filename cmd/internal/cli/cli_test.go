@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitURL(t *testing.T) {
+	tt := []struct {
+		target string
+		host   string
+		route  string
+	}{
+		{target: "https://example.com", host: "https://example.com", route: "/"},
+		{target: "example.com:8080/items?page=2", host: "http://example.com:8080", route: "/items?page=2"},
+		{target: "http://example.com/a%2Fb", host: "http://example.com", route: "/a%2Fb"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.target, func(t *testing.T) {
+			host, route, err := SplitURL(tc.target)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.host, host)
+			assert.Equal(t, tc.route, route)
+		})
+	}
+	_, _, err := SplitURL("http:///items")
+	assert.Error(t, err)
+}
+
+func TestAuth(t *testing.T) {
+	auth, err := Auth("", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, cauth.None, auth.GetAuthType())
+	auth, _ = Auth("user:pa:ss", "", "")
+	assert.Equal(t, cauth.NewBasicAuth("user", "pa:ss"), auth)
+	auth, _ = Auth("", "token", "")
+	assert.Equal(t, cauth.AuthJwt, auth.GetAuthType())
+	auth, _ = Auth("", "", "key")
+	assert.Equal(t, cauth.AuthApiKey, auth.GetAuthType())
+
+	_, err = Auth("user", "", "")
+	assert.Error(t, err)
+	_, err = Auth("", "token", "key")
+	assert.Error(t, err)
+}
+
+func TestParse(t *testing.T) {
+	headers, err := ParseHeaders([]string{"accept: a", "Accept:b", "X-Empty:"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Accept": "a, b", "X-Empty": ""}, headers)
+	assert.True(t, HasHeader(headers, "x-empty"))
+	_, err = ParseHeaders([]string{": value"})
+	assert.Error(t, err)
+
+	query, err := ParseQuery([]string{"a=1", "b==2"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "=2"}, query)
+	_, err = ParseQuery([]string{"=1"})
+	assert.Error(t, err)
+
+	body, err := ReadBody("@-", strings.NewReader("stdin"))
+	assert.NoError(t, err)
+	assert.Equal(t, "stdin", string(body))
+	body, _ = ReadBody("inline", nil)
+	assert.Equal(t, "inline", string(body))
+}
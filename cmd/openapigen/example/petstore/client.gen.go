@@ -0,0 +1,290 @@
+// Code generated by openapigen from petstore.yaml. DO NOT EDIT.
+
+// Package petstore is the client of Petstore 1.0.0
+package petstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/sghaida/go-stuff/src/httpclient"
+)
+
+// Error ...
+type Error struct {
+	Code    int32  `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewPetOwner ...
+type NewPetOwner struct {
+	Email *string `json:"email,omitempty"`
+	Name  *string `json:"name,omitempty"`
+}
+
+// NewPet ...
+type NewPet struct {
+	BirthDate *time.Time   `json:"birthDate,omitempty"`
+	Name      string       `json:"name"`
+	Owner     *NewPetOwner `json:"owner,omitempty"`
+	Status    *Status      `json:"status,omitempty"`
+	Tag       *string      `json:"tag,omitempty"`
+}
+
+// Pet a pet of the store
+type Pet struct {
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	BirthDate  *time.Time             `json:"birthDate,omitempty"`
+	// ID the unique id of the pet
+	ID     int64        `json:"id"`
+	Name   string       `json:"name"`
+	Owner  *NewPetOwner `json:"owner,omitempty"`
+	Status *Status      `json:"status,omitempty"`
+	Tag    *string      `json:"tag,omitempty"`
+	Tags   []string     `json:"tags,omitempty"`
+}
+
+// Status the adoption status of a pet
+type Status string
+
+// values of Status
+const (
+	StatusAvailable Status = "available"
+	StatusPending   Status = "pending"
+	StatusSold      Status = "sold"
+)
+
+// ListPetsParams are the parameters of ListPets
+type ListPetsParams struct {
+	// Limit maximum number of pets
+	Limit      *int32
+	Tags       []string
+	Status     *Status
+	XRequestID *string
+}
+
+// PostPetsPetIDPhotosRequest ...
+type PostPetsPetIDPhotosRequest struct {
+	Caption *string `json:"caption,omitempty"`
+	URL     string  `json:"url"`
+}
+
+// PostPetsPetIDPhotosResponse ...
+type PostPetsPetIDPhotosResponse struct {
+	Count *int `json:"count,omitempty"`
+}
+
+// DefaultHost is the first server of the spec
+const DefaultHost = "https://petstore.example.com/v1"
+
+// APIError is returned when the API replies with an unexpected status
+type APIError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// Client calls the operations of the API, the auth and timeout of the httpclient Client config apply
+// to every operation unless a security scheme credential is set, the retry only to the idempotent
+// operations e.g. GET, PUT and DELETE
+type Client struct {
+	client *httpclient.Client
+	host   string
+	auth   map[string]cauth.IAuth
+}
+
+// NewClient creates a Client calling the API at host
+func NewClient(client *httpclient.Client, host string) *Client {
+	return &Client{
+		client: client,
+		host:   host,
+		auth:   make(map[string]cauth.IAuth),
+	}
+}
+
+// WithAPIKey set the credentials of the apiKey security scheme, it must be called before using the client
+func (c *Client) WithAPIKey(key string) *Client {
+	c.auth["apiKey"] = &headerAuth{name: "X-Pet-Token", value: key}
+	return c
+}
+
+// WithBasicAuth set the credentials of the basicAuth security scheme, it must be called before using the client
+func (c *Client) WithBasicAuth(username, password string) *Client {
+	c.auth["basicAuth"] = cauth.NewBasicAuth(username, password)
+	return c
+}
+
+// WithBearerAuth set the credentials of the bearerAuth security scheme, it must be called before using the client
+func (c *Client) WithBearerAuth(token string) *Client {
+	c.auth["bearerAuth"] = cauth.NewJWTAuth(token)
+	return c
+}
+
+// ListPets list the pets
+func (c *Client) ListPets(ctx context.Context, params ListPetsParams) ([]Pet, error) {
+	builder := httpclient.NewCallerBuilder(c.client, c.host, "/pets", httpclient.GET)
+	query := make(map[string]string)
+	if params.Limit != nil {
+		query["limit"] = formatParam(*params.Limit)
+	}
+	if len(params.Tags) > 0 {
+		query["tags"] = formatParam(params.Tags)
+	}
+	if params.Status != nil {
+		query["status"] = formatParam(*params.Status)
+	}
+	builder.WithQueryParam(query)
+	headers := make(map[string]string)
+	if params.XRequestID != nil {
+		headers["X-Request-ID"] = formatParam(*params.XRequestID)
+	}
+	builder.WithHeaders(headers)
+	builder.WithAccept("application/json")
+	if auth := c.authFor("bearerAuth"); auth != nil {
+		builder.WithAuth(auth)
+	}
+	var result []Pet
+	err := c.do(ctx, builder, &result)
+	return result, err
+}
+
+// CreatePet create a pet
+func (c *Client) CreatePet(ctx context.Context, body NewPet) (*Pet, error) {
+	builder := httpclient.NewCallerBuilder(c.client, c.host, "/pets", httpclient.POST)
+	builder.WithBody(body, "application/json")
+	builder.WithAccept("application/json")
+	if auth := c.authFor("bearerAuth"); auth != nil {
+		builder.WithAuth(auth)
+	}
+	var result Pet
+	if err := c.do(ctx, builder, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetPet get a pet by id
+func (c *Client) GetPet(ctx context.Context, petID int64) (*Pet, error) {
+	builder := httpclient.NewCallerBuilder(c.client, c.host, "/pets/{petId}", httpclient.GET)
+	builder.WithPathParams(map[string]string{"petId": formatParam(petID)})
+	builder.WithAccept("application/json")
+	if auth := c.authFor("apiKey", "bearerAuth"); auth != nil {
+		builder.WithAuth(auth)
+	}
+	var result Pet
+	if err := c.do(ctx, builder, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeletePet delete a pet
+func (c *Client) DeletePet(ctx context.Context, petID int64) error {
+	builder := httpclient.NewCallerBuilder(c.client, c.host, "/pets/{petId}", httpclient.DELETE)
+	builder.WithPathParams(map[string]string{"petId": formatParam(petID)})
+	if auth := c.authFor("basicAuth"); auth != nil {
+		builder.WithAuth(auth)
+	}
+	return c.do(ctx, builder, nil)
+}
+
+// PostPetsPetIDPhotos upload a photo of a pet
+//
+// Deprecated: the operation is deprecated by the API
+func (c *Client) PostPetsPetIDPhotos(ctx context.Context, petID int64, body PostPetsPetIDPhotosRequest) (*PostPetsPetIDPhotosResponse, error) {
+	builder := httpclient.NewCallerBuilder(c.client, c.host, "/pets/{petId}/photos", httpclient.POST)
+	builder.WithPathParams(map[string]string{"petId": formatParam(petID)})
+	builder.WithBody(body, "application/json")
+	builder.WithAccept("application/json")
+	if auth := c.authFor("bearerAuth"); auth != nil {
+		builder.WithAuth(auth)
+	}
+	var result PostPetsPetIDPhotosResponse
+	if err := c.do(ctx, builder, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetStats API statistics
+func (c *Client) GetStats(ctx context.Context) (map[string]int, error) {
+	builder := httpclient.NewCallerBuilder(c.client, c.host, "/stats", httpclient.GET)
+	builder.WithAccept("application/json")
+	var result map[string]int
+	err := c.do(ctx, builder, &result)
+	return result, err
+}
+
+// authFor returns the credentials of the first scheme which is set, or nil to use the client auth
+func (c *Client) authFor(schemes ...string) cauth.IAuth {
+	for _, scheme := range schemes {
+		if auth, ok := c.auth[scheme]; ok {
+			return auth
+		}
+	}
+	return nil
+}
+
+// do calls the operation and decodes the response into result unless it is nil,
+// the responses with an unsuccessful status are returned as APIError
+func (c *Client) do(ctx context.Context, builder *httpclient.CallerBuilder, result interface{}) error {
+	caller, err := builder.Build()
+	if err != nil {
+		return err
+	}
+	resp, err := caller.RetryableCallWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer httpclient.DrainAndClose(resp.Body)
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Body: body}
+	}
+	if result == nil {
+		httpclient.DrainAndClose(resp.Body)
+		return nil
+	}
+	return caller.Decode(resp, result)
+}
+
+// formatParam formats a parameter value, the items of arrays are comma separated
+func formatParam(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Slice && value.Type().Elem().Kind() != reflect.Uint8 {
+		items := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			items = append(items, formatParam(value.Index(i).Interface()))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// headerAuth sends an api key in a custom header
+type headerAuth struct {
+	name  string
+	value string
+}
+
+func (a *headerAuth) GetAuthType() cauth.AuthType {
+	return cauth.AuthApiKey
+}
+
+func (a *headerAuth) GetAuthData() (cauth.AuthHeader, error) {
+	if a.value == "" {
+		return cauth.AuthHeader{}, fmt.Errorf("%s should not be empty", a.name)
+	}
+	return cauth.NewAuthHeader(a.name, a.value), nil
+}
@@ -0,0 +1,123 @@
+package petstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/sghaida/go-stuff/src/httpclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		request *http.Request
+		body    []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		request = r.Clone(context.Background())
+		body, _ = io.ReadAll(r.Body)
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/pets":
+			_, _ = w.Write([]byte(`[{"id":1,"name":"rex","status":"available"}]`))
+		case r.Method == http.MethodPost && r.URL.Path == "/pets":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":2,"name":"tom"}`))
+		case r.URL.Path == "/pets/404":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":404,"message":"not found"}`))
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/stats":
+			_, _ = w.Write([]byte(`{"available":3}`))
+		default:
+			_, _ = w.Write([]byte(`{"id":7,"name":"kitty","tags":["cat"]}`))
+		}
+	}))
+	defer server.Close()
+
+	config, _ := httpclient.NewConfig().Build()
+	client, _ := httpclient.NewClient(config, &http.Client{}, cauth.NewAPIKey("default"))
+	petstore := NewClient(client, server.URL).WithBearerAuth("token").WithBasicAuth("user", "pass")
+	lastRequest := func() (*http.Request, []byte) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return request, body
+	}
+
+	t.Run("query and header params", func(t *testing.T) {
+		limit, status, requestID := int32(10), StatusAvailable, "req-1"
+		pets, err := petstore.ListPets(context.Background(), ListPetsParams{
+			Limit: &limit, Tags: []string{"a", "b"}, Status: &status, XRequestID: &requestID,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []Pet{{ID: 1, Name: "rex", Status: &status}}, pets)
+
+		req, _ := lastRequest()
+		assert.Equal(t, "10", req.URL.Query().Get("limit"))
+		assert.Equal(t, "a,b", req.URL.Query().Get("tags"))
+		assert.Equal(t, "available", req.URL.Query().Get("status"))
+		assert.Equal(t, "req-1", req.Header.Get("X-Request-ID"))
+		assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+	})
+
+	t.Run("request body", func(t *testing.T) {
+		pet, err := petstore.CreatePet(context.Background(), NewPet{Name: "tom"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), pet.ID)
+
+		_, sent := lastRequest()
+		var decoded map[string]interface{}
+		assert.NoError(t, json.Unmarshal(sent, &decoded))
+		assert.Equal(t, map[string]interface{}{"name": "tom"}, decoded)
+	})
+
+	t.Run("path params and security schemes", func(t *testing.T) {
+		pet, err := petstore.GetPet(context.Background(), 7)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"cat"}, pet.Tags)
+		req, _ := lastRequest()
+		assert.Equal(t, "/pets/7", req.URL.Path)
+		// the api key isn't set so the bearer token is used
+		assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+
+		withKey := NewClient(client, server.URL).WithAPIKey("pet-token")
+		_, err = withKey.GetPet(context.Background(), 7)
+		assert.NoError(t, err)
+		req, _ = lastRequest()
+		assert.Equal(t, "pet-token", req.Header.Get("X-Pet-Token"))
+
+		assert.NoError(t, petstore.DeletePet(context.Background(), 7))
+		req, _ = lastRequest()
+		user, pass, _ := req.BasicAuth()
+		assert.Equal(t, "user:pass", user+":"+pass)
+	})
+
+	t.Run("client auth without security scheme credentials", func(t *testing.T) {
+		stats, err := NewClient(client, server.URL).GetStats(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"available": 3}, stats)
+		req, _ := lastRequest()
+		assert.Equal(t, "default", req.Header.Get("x-api-key"))
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		_, err := petstore.GetPet(context.Background(), 404)
+		var apiErr *APIError
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+			assert.JSONEq(t, `{"code":404,"message":"not found"}`, string(apiErr.Body))
+		}
+	})
+}
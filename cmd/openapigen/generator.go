@@ -0,0 +1,836 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// mediaTypes are the media types handled by the default httpclient codecs, by preference
+var mediaTypes = []string{
+	"application/json", "application/xml", "text/xml", "application/x-www-form-urlencoded", "text/plain",
+}
+
+// initialisms are kept upper case in the generated names
+var initialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true,
+	"JSON": true, "SQL": true, "URI": true, "URL": true, "UUID": true, "XML": true,
+}
+
+// keywords can't be used as parameter names
+var keywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true, "default": true,
+	"defer": true, "else": true, "fallthrough": true, "for": true, "func": true, "go": true, "goto": true,
+	"if": true, "import": true, "interface": true, "map": true, "package": true, "range": true,
+	"return": true, "select": true, "struct": true, "switch": true, "type": true, "var": true,
+	// the names used by the generated methods
+	"ctx": true, "params": true, "body": true, "builder": true, "result": true, "query": true, "headers": true,
+}
+
+// generator writes the Go client of a spec
+type generator struct {
+	spec   *Spec
+	source string
+	pkg    string
+
+	types      bytes.Buffer
+	operations bytes.Buffer
+	declared   map[string]bool
+	inline     map[*Schema]string
+	imports    map[string]bool
+	headerAuth bool
+	warnings   []string
+}
+
+// param is a parameter of an operation
+type param struct {
+	name        string
+	in          string
+	description string
+	goName      string
+	goType      string
+	required    bool
+}
+
+// Generate returns the formatted source of the client of the spec in package pkg,
+// source is the spec file mentioned in the generated header. the parts of the spec
+// which can't be generated are skipped and reported as warnings
+func Generate(spec *Spec, source, pkg string) ([]byte, []string, error) {
+	g := &generator{
+		spec:     spec,
+		source:   source,
+		pkg:      pkg,
+		declared: make(map[string]bool),
+		inline:   make(map[*Schema]string),
+		imports: map[string]bool{
+			"context": true, "fmt": true, "io": true, "reflect": true, "strings": true, "time": true,
+			"github.com/sghaida/go-stuff/src/cauth":      true,
+			"github.com/sghaida/go-stuff/src/httpclient": true,
+		},
+	}
+
+	names := make([]string, 0, len(spec.Components.Schemas))
+	for name := range spec.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := g.declareSchema(goName(name), spec.Components.Schemas[name]); err != nil {
+			return nil, nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+
+	paths := make([]string, 0, len(spec.Paths))
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		item := spec.Paths[path]
+		for _, o := range item.operations() {
+			if err := g.operation(path, o.method, item, o.op); err != nil {
+				return nil, nil, fmt.Errorf("%s %s: %w", o.method, path, err)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	g.header(&out)
+	out.Write(g.types.Bytes())
+	g.client(&out)
+	out.Write(g.operations.Bytes())
+	g.helpers(&out)
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("generated invalid code: %w", err)
+	}
+	return src, g.warnings, nil
+}
+
+// warn records a part of the spec which is skipped
+func (g *generator) warn(format string, args ...interface{}) {
+	g.warnings = append(g.warnings, fmt.Sprintf(format, args...))
+}
+
+// header writes the package clause and the imports
+func (g *generator) header(out *bytes.Buffer) {
+	fmt.Fprintf(out, "// Code generated by openapigen from %s. DO NOT EDIT.\n\n", g.source)
+	title := g.spec.Info.Title
+	if title == "" {
+		title = "the API"
+	}
+	fmt.Fprintf(out, "// Package %s is the client of %s %s\n", g.pkg, title, g.spec.Info.Version)
+	fmt.Fprintf(out, "package %s\n\nimport (\n", g.pkg)
+	var std, others []string
+	for path := range g.imports {
+		if strings.Contains(path, ".") {
+			others = append(others, path)
+			continue
+		}
+		std = append(std, path)
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+	for _, path := range std {
+		fmt.Fprintf(out, "%q\n", path)
+	}
+	out.WriteString("\n")
+	for _, path := range others {
+		fmt.Fprintf(out, "%q\n", path)
+	}
+	out.WriteString(")\n\n")
+}
+
+// declareSchema declares the named type of a schema
+func (g *generator) declareSchema(name string, schema *Schema) error {
+	if g.declared[name] {
+		return nil
+	}
+	g.declared[name] = true
+	// the declaration is written after the types of its inline schemas
+	var decl bytes.Buffer
+	defer func() {
+		g.types.Write(decl.Bytes())
+	}()
+	comment(&decl, name, schema.Description)
+
+	if len(schema.Enum) > 0 && (schema.Type == "string" || schema.Type == "") {
+		fmt.Fprintf(&decl, "type %s string\n\n", name)
+		fmt.Fprintf(&decl, "// values of %s\nconst (\n", name)
+		for i, value := range schema.Enum {
+			constName := goName(value)
+			if constName == "" || !unicode.IsLetter([]rune(constName)[0]) {
+				constName = "Value" + strconv.Itoa(i)
+			}
+			fmt.Fprintf(&decl, "%s%s %s = %q\n", name, constName, name, value)
+		}
+		decl.WriteString(")\n\n")
+		return nil
+	}
+
+	properties, required, err := g.properties(schema)
+	if err != nil {
+		return err
+	}
+	if properties == nil {
+		typ, err := g.goType(schema, name+"Item")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&decl, "type %s %s\n\n", name, typ)
+		return nil
+	}
+
+	var fields bytes.Buffer
+	propertyNames := make([]string, 0, len(properties))
+	for property := range properties {
+		propertyNames = append(propertyNames, property)
+	}
+	sort.Strings(propertyNames)
+	for _, property := range propertyNames {
+		propertySchema := properties[property]
+		fieldName := goName(property)
+		typ, err := g.goType(propertySchema, name+fieldName)
+		if err != nil {
+			return fmt.Errorf("property %s: %w", property, err)
+		}
+		resolved, err := g.spec.schema(propertySchema)
+		if err != nil {
+			return err
+		}
+		tag := property
+		if !required[property] {
+			tag += ",omitempty"
+		}
+		if (!required[property] || resolved.Nullable || propertySchema.Nullable) && nillable(typ) {
+			typ = "*" + typ
+		}
+		if propertySchema.Description != "" {
+			comment(&fields, fieldName, propertySchema.Description)
+		}
+		fmt.Fprintf(&fields, "%s %s `json:%q`\n", fieldName, typ, tag)
+	}
+	fmt.Fprintf(&decl, "type %s struct {\n%s}\n\n", name, fields.String())
+	return nil
+}
+
+// properties returns the properties of an object schema merging allOf, or nil if the schema isn't an object
+func (g *generator) properties(schema *Schema) (map[string]*Schema, map[string]bool, error) {
+	if len(schema.Properties) == 0 && len(schema.AllOf) == 0 {
+		return nil, nil, nil
+	}
+	properties := make(map[string]*Schema)
+	required := make(map[string]bool)
+	for name, property := range schema.Properties {
+		properties[name] = property
+	}
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	for _, part := range schema.AllOf {
+		resolved, err := g.spec.schema(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		partProperties, partRequired, err := g.properties(resolved)
+		if err != nil {
+			return nil, nil, err
+		}
+		for name, property := range partProperties {
+			properties[name] = property
+		}
+		for name := range partRequired {
+			required[name] = true
+		}
+	}
+	return properties, required, nil
+}
+
+// goType returns the Go type of a schema, inline objects are declared using the name hint
+func (g *generator) goType(schema *Schema, hint string) (string, error) {
+	if schema == nil {
+		return "interface{}", nil
+	}
+	if schema.Ref != "" {
+		name, err := refName(schema.Ref, "schemas")
+		if err != nil {
+			return "", err
+		}
+		if _, ok := g.spec.Components.Schemas[name]; !ok {
+			return "", fmt.Errorf("unknown schema %q", schema.Ref)
+		}
+		return goName(name), nil
+	}
+	if len(schema.AllOf) == 1 && len(schema.Properties) == 0 {
+		return g.goType(schema.AllOf[0], hint)
+	}
+	if len(schema.OneOf) > 0 || len(schema.AnyOf) > 0 {
+		g.imports["encoding/json"] = true
+		return "json.RawMessage", nil
+	}
+
+	switch schema.Type {
+	case "string":
+		switch schema.Format {
+		case "date-time":
+			return "time.Time", nil
+		case "byte", "binary":
+			return "[]byte", nil
+		}
+		return "string", nil
+	case "integer":
+		switch schema.Format {
+		case "int32":
+			return "int32", nil
+		case "int64":
+			return "int64", nil
+		}
+		return "int", nil
+	case "number":
+		if schema.Format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		item, err := g.goType(schema.Items, hint+"Item")
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	}
+
+	if len(schema.Properties) > 0 || len(schema.AllOf) > 0 {
+		// an inline schema shared using allOf is declared once
+		if name, ok := g.inline[schema]; ok {
+			return name, nil
+		}
+		g.inline[schema] = hint
+		if err := g.declareSchema(hint, schema); err != nil {
+			return "", err
+		}
+		return hint, nil
+	}
+	if schema.AdditionalProperties != nil {
+		value, err := g.goType(schema.AdditionalProperties, hint+"Value")
+		if err != nil {
+			return "", err
+		}
+		return "map[string]" + value, nil
+	}
+	if schema.Type == "object" {
+		return "map[string]interface{}", nil
+	}
+	return "interface{}", nil
+}
+
+// client writes the client type and the setters of the security schemes
+func (g *generator) client(out *bytes.Buffer) {
+	if len(g.spec.Servers) > 0 && strings.Contains(g.spec.Servers[0].URL, "://") {
+		fmt.Fprintf(out, "// DefaultHost is the first server of the spec\nconst DefaultHost = %q\n\n", g.spec.Servers[0].URL)
+	}
+	out.WriteString(`// APIError is returned when the API replies with an unexpected status
+type APIError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// Client calls the operations of the API, the auth and timeout of the httpclient Client config apply
+// to every operation unless a security scheme credential is set, the retry only to the idempotent
+// operations e.g. GET, PUT and DELETE
+type Client struct {
+	client *httpclient.Client
+	host   string
+	auth   map[string]cauth.IAuth
+}
+
+// NewClient creates a Client calling the API at host
+func NewClient(client *httpclient.Client, host string) *Client {
+	return &Client{
+		client: client,
+		host:   host,
+		auth:   make(map[string]cauth.IAuth),
+	}
+}
+
+`)
+
+	schemes := make([]string, 0, len(g.spec.Components.SecuritySchemes))
+	for name := range g.spec.Components.SecuritySchemes {
+		schemes = append(schemes, name)
+	}
+	sort.Strings(schemes)
+	for _, name := range schemes {
+		scheme := g.spec.Components.SecuritySchemes[name]
+		method := "With" + goName(name)
+		var args, auth string
+		switch {
+		case scheme.Type == "http" && strings.EqualFold(scheme.Scheme, "basic"):
+			args, auth = "username, password string", "cauth.NewBasicAuth(username, password)"
+		case scheme.Type == "http" && strings.EqualFold(scheme.Scheme, "bearer"),
+			scheme.Type == "oauth2", scheme.Type == "openIdConnect":
+			args, auth = "token string", "cauth.NewJWTAuth(token)"
+		case scheme.Type == "apiKey" && scheme.In == "header" && strings.EqualFold(scheme.Name, "x-api-key"):
+			args, auth = "key string", "cauth.NewAPIKey(key)"
+		case scheme.Type == "apiKey" && scheme.In == "header":
+			g.headerAuth = true
+			args, auth = "key string", fmt.Sprintf("&headerAuth{name: %q, value: key}", scheme.Name)
+		default:
+			g.warn("security scheme %s: unsupported %s scheme is skipped", name, scheme.Type)
+			continue
+		}
+		fmt.Fprintf(out, "// %s set the credentials of the %s security scheme, it must be called before using the client\n",
+			method, name)
+		fmt.Fprintf(out, "func (c *Client) %s(%s) *Client {\nc.auth[%q] = %s\nreturn c\n}\n\n", method, args, name, auth)
+	}
+}
+
+// operation writes the method of an operation
+func (g *generator) operation(path, method string, item PathItem, op *Operation) error {
+	name := goName(op.OperationID)
+	if name == "" {
+		name = goName(strings.ToLower(method) + " " + path)
+	}
+
+	params, err := g.params(name, item, op)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"ctx context.Context"}
+	var queryParams, headerParams []param
+	for _, p := range params {
+		switch p.in {
+		case "path":
+			args = append(args, p.goName+" "+p.goType)
+		case "query":
+			queryParams = append(queryParams, p)
+		case "header":
+			headerParams = append(headerParams, p)
+		default:
+			g.warn("%s: %s parameter %s is skipped", name, p.in, p.name)
+		}
+	}
+	if len(queryParams) > 0 || len(headerParams) > 0 {
+		paramsType := name + "Params"
+		fmt.Fprintf(&g.types, "// %s are the parameters of %s\ntype %s struct {\n", paramsType, name, paramsType)
+		for _, p := range append(append([]param(nil), queryParams...), headerParams...) {
+			if p.description != "" {
+				comment(&g.types, goName(p.name), p.description)
+			}
+			fmt.Fprintf(&g.types, "%s %s\n", goName(p.name), p.fieldType())
+		}
+		g.types.WriteString("}\n\n")
+		args = append(args, "params "+paramsType)
+	}
+
+	bodyType, bodyMediaType, err := g.requestBody(name, op)
+	if err != nil {
+		return err
+	}
+	if bodyType != "" {
+		args = append(args, "body "+bodyType)
+	}
+
+	resultType, resultMediaType, err := g.result(name, op)
+	if err != nil {
+		return err
+	}
+
+	summary := op.Summary
+	if summary == "" {
+		summary = op.Description
+	}
+	if summary == "" {
+		summary = method + " " + path
+	}
+	comment(&g.operations, name, summary)
+	if op.Deprecated {
+		g.operations.WriteString("//\n// Deprecated: the operation is deprecated by the API\n")
+	}
+	returns := "error"
+	if resultType != "" {
+		returns = fmt.Sprintf("(%s, error)", returnType(resultType))
+	}
+	fmt.Fprintf(&g.operations, "func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+
+	w := &g.operations
+	fmt.Fprintf(w, "builder := httpclient.NewCallerBuilder(c.client, c.host, %q, httpclient.%s)\n", path, method)
+	for _, p := range params {
+		if p.in == "path" {
+			fmt.Fprintf(w, "builder.WithPathParams(map[string]string{%q: formatParam(%s)})\n", p.name, p.goName)
+		}
+	}
+	writeParams(w, queryParams, "query", "WithQueryParam")
+	writeParams(w, headerParams, "headers", "WithHeaders")
+	if bodyType != "" {
+		fmt.Fprintf(w, "builder.WithBody(body, %q)\n", bodyMediaType)
+	}
+	if resultType != "" {
+		fmt.Fprintf(w, "builder.WithAccept(%q)\n", resultMediaType)
+	}
+	if schemes := g.securitySchemes(op); len(schemes) > 0 {
+		quoted := make([]string, 0, len(schemes))
+		for _, scheme := range schemes {
+			quoted = append(quoted, strconv.Quote(scheme))
+		}
+		fmt.Fprintf(w, "if auth := c.authFor(%s); auth != nil {\nbuilder.WithAuth(auth)\n}\n", strings.Join(quoted, ", "))
+	}
+
+	switch {
+	case resultType == "":
+		w.WriteString("return c.do(ctx, builder, nil)\n}\n\n")
+	case returnType(resultType) != resultType:
+		fmt.Fprintf(w, "var result %s\nif err := c.do(ctx, builder, &result); err != nil {\nreturn nil, err\n}\n", resultType)
+		w.WriteString("return &result, nil\n}\n\n")
+	default:
+		fmt.Fprintf(w, "var result %s\nerr := c.do(ctx, builder, &result)\nreturn result, err\n}\n\n", resultType)
+	}
+	return nil
+}
+
+// params returns the parameters of the operation, which override the parameters of the path
+func (g *generator) params(operation string, item PathItem, op *Operation) ([]param, error) {
+	var resolved []Parameter
+	index := make(map[string]int)
+	for _, p := range append(append([]Parameter(nil), item.Parameters...), op.Parameters...) {
+		p, err := g.spec.parameter(p)
+		if err != nil {
+			return nil, err
+		}
+		key := p.In + ":" + p.Name
+		if i, ok := index[key]; ok {
+			resolved[i] = p
+			continue
+		}
+		index[key] = len(resolved)
+		resolved = append(resolved, p)
+	}
+
+	params := make([]param, 0, len(resolved))
+	for _, p := range resolved {
+		typ, err := g.goType(p.Schema, operation+goName(p.Name))
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		params = append(params, param{
+			name:        p.Name,
+			in:          p.In,
+			description: p.Description,
+			goName:      argName(p.Name),
+			goType:      typ,
+			required:    p.Required || p.In == "path",
+		})
+	}
+	return params, nil
+}
+
+// requestBody returns the type and the media type of the request body
+func (g *generator) requestBody(operation string, op *Operation) (string, string, error) {
+	body, err := g.spec.requestBody(op.RequestBody)
+	if err != nil || body == nil {
+		return "", "", err
+	}
+	mediaType, content, ok := pickContent(body.Content)
+	if !ok {
+		g.warn("%s: request body has no supported media type and is skipped", operation)
+		return "", "", nil
+	}
+	typ, err := g.goType(content.Schema, operation+"Request")
+	if err != nil {
+		return "", "", fmt.Errorf("request body: %w", err)
+	}
+	return typ, mediaType, nil
+}
+
+// result returns the type and the media type of the first successful response having content
+func (g *generator) result(operation string, op *Operation) (string, string, error) {
+	statuses := make([]string, 0, len(op.Responses))
+	for status := range op.Responses {
+		if strings.HasPrefix(status, "2") {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		resp, err := g.spec.response(op.Responses[status])
+		if err != nil {
+			return "", "", err
+		}
+		if len(resp.Content) == 0 {
+			continue
+		}
+		mediaType, content, ok := pickContent(resp.Content)
+		if !ok {
+			g.warn("%s: response %s has no supported media type and is skipped", operation, status)
+			return "", "", nil
+		}
+		typ, err := g.goType(content.Schema, operation+"Response")
+		if err != nil {
+			return "", "", fmt.Errorf("response %s: %w", status, err)
+		}
+		return typ, mediaType, nil
+	}
+	return "", "", nil
+}
+
+// securitySchemes returns the supported schemes which may authenticate the operation by preference,
+// a requirement combining several schemes is satisfied by its first scheme
+func (g *generator) securitySchemes(op *Operation) []string {
+	requirements := g.spec.Security
+	if op.Security != nil {
+		requirements = *op.Security
+	}
+	var schemes []string
+	for _, requirement := range requirements {
+		names := make([]string, 0, len(requirement))
+		for name := range requirement {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) > 0 {
+			schemes = append(schemes, names[0])
+		}
+	}
+	return schemes
+}
+
+// helpers writes the functions used by the operations
+func (g *generator) helpers(out *bytes.Buffer) {
+	out.WriteString(`// authFor returns the credentials of the first scheme which is set, or nil to use the client auth
+func (c *Client) authFor(schemes ...string) cauth.IAuth {
+	for _, scheme := range schemes {
+		if auth, ok := c.auth[scheme]; ok {
+			return auth
+		}
+	}
+	return nil
+}
+
+// do calls the operation and decodes the response into result unless it is nil,
+// the responses with an unsuccessful status are returned as APIError
+func (c *Client) do(ctx context.Context, builder *httpclient.CallerBuilder, result interface{}) error {
+	caller, err := builder.Build()
+	if err != nil {
+		return err
+	}
+	resp, err := caller.RetryableCallWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer httpclient.DrainAndClose(resp.Body)
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Body: body}
+	}
+	if result == nil {
+		httpclient.DrainAndClose(resp.Body)
+		return nil
+	}
+	return caller.Decode(resp, result)
+}
+
+// formatParam formats a parameter value, the items of arrays are comma separated
+func formatParam(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Slice && value.Type().Elem().Kind() != reflect.Uint8 {
+		items := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			items = append(items, formatParam(value.Index(i).Interface()))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v)
+}
+`)
+	if g.headerAuth {
+		out.WriteString(`
+// headerAuth sends an api key in a custom header
+type headerAuth struct {
+	name  string
+	value string
+}
+
+func (a *headerAuth) GetAuthType() cauth.AuthType {
+	return cauth.AuthApiKey
+}
+
+func (a *headerAuth) GetAuthData() (cauth.AuthHeader, error) {
+	if a.value == "" {
+		return cauth.AuthHeader{}, fmt.Errorf("%s should not be empty", a.name)
+	}
+	return cauth.NewAuthHeader(a.name, a.value), nil
+}
+`)
+	}
+}
+
+// fieldType is the type of the parameter in the Params struct, optional parameters are pointers
+func (p param) fieldType() string {
+	if p.required || !nillable(p.goType) {
+		return p.goType
+	}
+	return "*" + p.goType
+}
+
+// writeParams writes the query or header parameters, unset optional parameters are skipped
+func writeParams(w *bytes.Buffer, params []param, variable, setter string) {
+	if len(params) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s := make(map[string]string)\n", variable)
+	for _, p := range params {
+		field := "params." + goName(p.name)
+		switch {
+		case p.fieldType() != p.goType:
+			fmt.Fprintf(w, "if %s != nil {\n%s[%q] = formatParam(*%s)\n}\n", field, variable, p.name, field)
+		case !p.required && p.goType == "interface{}":
+			fmt.Fprintf(w, "if %s != nil {\n%s[%q] = formatParam(%s)\n}\n", field, variable, p.name, field)
+		case !p.required:
+			fmt.Fprintf(w, "if len(%s) > 0 {\n%s[%q] = formatParam(%s)\n}\n", field, variable, p.name, field)
+		default:
+			fmt.Fprintf(w, "%s[%q] = formatParam(%s)\n", variable, p.name, field)
+		}
+	}
+	fmt.Fprintf(w, "builder.%s(%s)\n", setter, variable)
+}
+
+// pickContent returns the preferred supported media type of the content
+func pickContent(content map[string]MediaType) (string, MediaType, bool) {
+	for _, mediaType := range mediaTypes {
+		if c, ok := content[mediaType]; ok {
+			return mediaType, c, true
+		}
+	}
+	return "", MediaType{}, false
+}
+
+// nillable reports whether optional values of the type need a pointer to be omitted
+func nillable(typ string) bool {
+	return !strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map[") &&
+		typ != "interface{}" && typ != "json.RawMessage"
+}
+
+// returnType returns the type returned by an operation, structs are returned as pointers
+func returnType(typ string) string {
+	if nillable(typ) && typ != "time.Time" && !isBuiltin(typ) {
+		return "*" + typ
+	}
+	return typ
+}
+
+// isBuiltin reports whether the type is a predeclared type
+func isBuiltin(typ string) bool {
+	switch typ {
+	case "string", "bool", "int", "int32", "int64", "float32", "float64":
+		return true
+	}
+	return false
+}
+
+// comment writes a doc comment starting with the name
+func comment(w *bytes.Buffer, name, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		fmt.Fprintf(w, "// %s ...\n", name)
+		return
+	}
+	lines := strings.Split(text, "\n")
+	first := strings.TrimSpace(lines[0])
+	// keep the acronyms starting the text e.g. API
+	if runes := []rune(first); len(runes) < 2 || !unicode.IsUpper(runes[1]) {
+		first = lowerFirst(first)
+	}
+	fmt.Fprintf(w, "// %s %s\n", name, first)
+	for _, line := range lines[1:] {
+		fmt.Fprintf(w, "// %s\n", strings.TrimSpace(line))
+	}
+}
+
+// words splits an identifier at the non alphanumeric characters and the case changes
+func words(s string) []string {
+	var (
+		result  []string
+		current []rune
+	)
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(current) > 0 {
+				result = append(result, string(current))
+				current = nil
+			}
+			continue
+		}
+		lowerToUpper := i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1])
+		// the last upper case letter of an acronym followed by a lower case letter starts a word e.g. HTTPServer
+		acronymEnd := i > 0 && i+1 < len(runes) && unicode.IsUpper(r) && unicode.IsUpper(runes[i-1]) &&
+			unicode.IsLower(runes[i+1])
+		if (lowerToUpper || acronymEnd) && len(current) > 0 {
+			result = append(result, string(current))
+			current = nil
+		}
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		result = append(result, string(current))
+	}
+	return result
+}
+
+// goName returns the exported Go name of an identifier e.g. pet_id becomes PetID
+func goName(s string) string {
+	var b strings.Builder
+	for _, word := range words(s) {
+		if upper := strings.ToUpper(word); initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		runes := []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	name := b.String()
+	if name != "" && unicode.IsDigit([]rune(name)[0]) {
+		name = "N" + name
+	}
+	return name
+}
+
+// argName returns the unexported Go name of a parameter e.g. pet_id becomes petID
+func argName(s string) string {
+	name := goName(s)
+	parts := words(s)
+	if len(parts) > 0 && initialisms[strings.ToUpper(parts[0])] {
+		name = strings.ToLower(parts[0]) + name[len(parts[0]):]
+	} else {
+		name = lowerFirst(name)
+	}
+	if keywords[name] || name == "" {
+		name += "Param"
+	}
+	return name
+}
+
+// lowerFirst lower cases the first letter
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	runes := []rune(s)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Run("matches the generated example", func(t *testing.T) {
+		spec, err := LoadSpec("testdata/petstore.yaml")
+		assert.NoError(t, err)
+		src, warnings, err := Generate(spec, "petstore.yaml", "petstore")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"PostPetsPetIDPhotos: cookie parameter session is skipped",
+			"security scheme cookieAuth: unsupported apiKey scheme is skipped",
+		}, warnings)
+
+		// the example is regenerated using go generate ./cmd/openapigen/...
+		expected, err := os.ReadFile("example/petstore/client.gen.go")
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(src))
+	})
+
+	t.Run("json spec", func(t *testing.T) {
+		spec, err := ParseSpec([]byte(`{
+			"openapi": "3.1.0",
+			"info": {"title": "Users"},
+			"paths": {"/users/{user_id}": {"get": {
+				"parameters": [{"name": "user_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+				"responses": {"200": {"description": "user", "content": {"application/json": {"schema": {
+					"type": "object", "properties": {"name": {"type": "string"}}
+				}}}}}
+			}}}
+		}`))
+		assert.NoError(t, err)
+		src, _, err := Generate(spec, "users.json", "users")
+		assert.NoError(t, err)
+		assert.Contains(t, string(src), "func (c *Client) GetUsersUserID(ctx context.Context, userID string) (*GetUsersUserIDResponse, error)")
+		assert.Contains(t, string(src), "Name *string `json:\"name,omitempty\"`")
+	})
+
+	t.Run("invalid specs", func(t *testing.T) {
+		_, err := ParseSpec([]byte("swagger: '2.0'"))
+		assert.Error(t, err)
+		_, err = ParseSpec([]byte("openapi: ["))
+		assert.Error(t, err)
+
+		spec, _ := ParseSpec([]byte(`
+openapi: 3.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        '200':
+          description: pets
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Missing'
+`))
+		_, _, err = Generate(spec, "pets.yaml", "pets")
+		assert.True(t, err != nil && strings.Contains(err.Error(), "Missing"))
+	})
+}
+
+func TestNames(t *testing.T) {
+	tt := []struct {
+		name    string
+		goName  string
+		argName string
+	}{
+		{name: "petId", goName: "PetID", argName: "petID"},
+		{name: "pet_id", goName: "PetID", argName: "petID"},
+		{name: "id", goName: "ID", argName: "id"},
+		{name: "X-Request-ID", goName: "XRequestID", argName: "xRequestID"},
+		{name: "HTTPServer", goName: "HTTPServer", argName: "httpServer"},
+		{name: "2fa", goName: "N2fa", argName: "n2fa"},
+		{name: "type", goName: "Type", argName: "typeParam"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.goName, goName(tc.name))
+			assert.Equal(t, tc.argName, argName(tc.name))
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Command openapigen generates a typed Go client from an OpenAPI 3 JSON or YAML spec,
+// the operations are called using httpclient.Client and CallerBuilder
+//
+//	openapigen -spec petstore.yaml -package petstore -out petstore/client.gen.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	specPath := flag.String("spec", "", "path of the OpenAPI 3 JSON or YAML spec")
+	pkg := flag.String("package", "client", "package name of the generated client")
+	out := flag.String("out", "", "output file, the standard output if empty")
+	flag.Parse()
+
+	if err := run(*specPath, *pkg, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "openapigen:", err)
+		os.Exit(1)
+	}
+}
+
+// run generates the client of the spec and writes it to out
+func run(specPath, pkg, out string) error {
+	if specPath == "" {
+		return fmt.Errorf("-spec is required")
+	}
+	spec, err := LoadSpec(specPath)
+	if err != nil {
+		return err
+	}
+	src, warnings, err := Generate(spec, filepath.Base(specPath), pkg)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "openapigen: warning:", warning)
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
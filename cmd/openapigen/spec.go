@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the subset of an OpenAPI 3 document used to generate the client
+type Spec struct {
+	OpenAPI    string                `yaml:"openapi"`
+	Info       Info                  `yaml:"info"`
+	Servers    []Server              `yaml:"servers"`
+	Paths      map[string]PathItem   `yaml:"paths"`
+	Components Components            `yaml:"components"`
+	Security   []map[string][]string `yaml:"security"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	Version     string `yaml:"version"`
+}
+
+// Server is a base url of the API
+type Server struct {
+	URL string `yaml:"url"`
+}
+
+// PathItem holds the operations of a path
+type PathItem struct {
+	Get        *Operation  `yaml:"get"`
+	Put        *Operation  `yaml:"put"`
+	Post       *Operation  `yaml:"post"`
+	Delete     *Operation  `yaml:"delete"`
+	Options    *Operation  `yaml:"options"`
+	Head       *Operation  `yaml:"head"`
+	Patch      *Operation  `yaml:"patch"`
+	Trace      *Operation  `yaml:"trace"`
+	Parameters []Parameter `yaml:"parameters"`
+}
+
+// operations returns the operations of the path by method in a stable order
+func (p PathItem) operations() []struct {
+	method string
+	op     *Operation
+} {
+	all := []struct {
+		method string
+		op     *Operation
+	}{
+		{"GET", p.Get}, {"PUT", p.Put}, {"POST", p.Post}, {"DELETE", p.Delete},
+		{"OPTIONS", p.Options}, {"HEAD", p.Head}, {"PATCH", p.Patch}, {"TRACE", p.Trace},
+	}
+	operations := all[:0]
+	for _, o := range all {
+		if o.op != nil {
+			operations = append(operations, o)
+		}
+	}
+	return operations
+}
+
+// Operation is an API operation
+type Operation struct {
+	OperationID string                 `yaml:"operationId"`
+	Summary     string                 `yaml:"summary"`
+	Description string                 `yaml:"description"`
+	Deprecated  bool                   `yaml:"deprecated"`
+	Parameters  []Parameter            `yaml:"parameters"`
+	RequestBody *RequestBody           `yaml:"requestBody"`
+	Responses   map[string]Response    `yaml:"responses"`
+	Security    *[]map[string][]string `yaml:"security"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Ref         string  `yaml:"$ref"`
+	Name        string  `yaml:"name"`
+	In          string  `yaml:"in"`
+	Description string  `yaml:"description"`
+	Required    bool    `yaml:"required"`
+	Schema      *Schema `yaml:"schema"`
+}
+
+// RequestBody is the body of an operation
+type RequestBody struct {
+	Ref         string               `yaml:"$ref"`
+	Description string               `yaml:"description"`
+	Required    bool                 `yaml:"required"`
+	Content     map[string]MediaType `yaml:"content"`
+}
+
+// Response is a response of an operation
+type Response struct {
+	Ref         string               `yaml:"$ref"`
+	Description string               `yaml:"description"`
+	Content     map[string]MediaType `yaml:"content"`
+}
+
+// MediaType holds the schema of a content
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// Schema is a JSON schema
+type Schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Description          string             `yaml:"description"`
+	Nullable             bool               `yaml:"nullable"`
+	Enum                 []string           `yaml:"enum"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	Required             []string           `yaml:"required"`
+	Items                *Schema            `yaml:"items"`
+	AllOf                []*Schema          `yaml:"allOf"`
+	OneOf                []*Schema          `yaml:"oneOf"`
+	AnyOf                []*Schema          `yaml:"anyOf"`
+	AdditionalProperties *Schema            `yaml:"-"`
+}
+
+// UnmarshalYAML decodes additionalProperties which is either a boolean or a schema
+func (s *Schema) UnmarshalYAML(node *yaml.Node) error {
+	type plain Schema
+	var raw struct {
+		plain                `yaml:",inline"`
+		AdditionalProperties yaml.Node `yaml:"additionalProperties"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	*s = Schema(raw.plain)
+	switch raw.AdditionalProperties.Kind {
+	case yaml.MappingNode:
+		s.AdditionalProperties = new(Schema)
+		return raw.AdditionalProperties.Decode(s.AdditionalProperties)
+	case yaml.ScalarNode:
+		if raw.AdditionalProperties.Value == "true" {
+			s.AdditionalProperties = new(Schema)
+		}
+	}
+	return nil
+}
+
+// Components holds the reusable objects of the spec
+type Components struct {
+	Schemas         map[string]*Schema        `yaml:"schemas"`
+	Parameters      map[string]Parameter      `yaml:"parameters"`
+	RequestBodies   map[string]RequestBody    `yaml:"requestBodies"`
+	Responses       map[string]Response       `yaml:"responses"`
+	SecuritySchemes map[string]SecurityScheme `yaml:"securitySchemes"`
+}
+
+// SecurityScheme is an authentication scheme of the API
+type SecurityScheme struct {
+	Type        string `yaml:"type"`
+	Description string `yaml:"description"`
+	Name        string `yaml:"name"`
+	In          string `yaml:"in"`
+	Scheme      string `yaml:"scheme"`
+}
+
+// LoadSpec reads a JSON or YAML OpenAPI 3 spec
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read spec: %w", err)
+	}
+	return ParseSpec(data)
+}
+
+// ParseSpec parses a JSON or YAML OpenAPI 3 spec, JSON being a subset of YAML
+func ParseSpec(data []byte) (*Spec, error) {
+	var spec Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("unable to parse spec: %w", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q", spec.OpenAPI)
+	}
+	return &spec, nil
+}
+
+// refName returns the component name of a local reference of the given kind
+// e.g. #/components/schemas/Pet of kind schemas
+func refName(ref, kind string) (string, error) {
+	prefix := "#/components/" + kind + "/"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("unsupported reference %q", ref)
+	}
+	return strings.TrimPrefix(ref, prefix), nil
+}
+
+// parameter resolves a parameter reference
+func (s *Spec) parameter(p Parameter) (Parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	name, err := refName(p.Ref, "parameters")
+	if err != nil {
+		return p, err
+	}
+	resolved, ok := s.Components.Parameters[name]
+	if !ok {
+		return p, fmt.Errorf("unknown parameter %q", p.Ref)
+	}
+	return resolved, nil
+}
+
+// requestBody resolves a request body reference
+func (s *Spec) requestBody(b *RequestBody) (*RequestBody, error) {
+	if b == nil || b.Ref == "" {
+		return b, nil
+	}
+	name, err := refName(b.Ref, "requestBodies")
+	if err != nil {
+		return nil, err
+	}
+	resolved, ok := s.Components.RequestBodies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown request body %q", b.Ref)
+	}
+	return &resolved, nil
+}
+
+// response resolves a response reference
+func (s *Spec) response(r Response) (Response, error) {
+	if r.Ref == "" {
+		return r, nil
+	}
+	name, err := refName(r.Ref, "responses")
+	if err != nil {
+		return r, err
+	}
+	resolved, ok := s.Components.Responses[name]
+	if !ok {
+		return r, fmt.Errorf("unknown response %q", r.Ref)
+	}
+	return resolved, nil
+}
+
+// schema resolves a schema reference
+func (s *Spec) schema(schema *Schema) (*Schema, error) {
+	if schema == nil || schema.Ref == "" {
+		return schema, nil
+	}
+	name, err := refName(schema.Ref, "schemas")
+	if err != nil {
+		return nil, err
+	}
+	resolved, ok := s.Components.Schemas[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %q", schema.Ref)
+	}
+	return resolved, nil
+}
@@ -3,9 +3,10 @@ module github.com/sghaida/go-stuff
 go 1.16
 
 require (
-	github.com/PuerkitoBio/goquery v1.8.0 // indirect
+	github.com/PuerkitoBio/goquery v1.8.0
 	github.com/google/uuid v1.1.1
 	github.com/sirupsen/logrus v1.6.0
 	github.com/stretchr/testify v1.8.1
-	golang.org/x/net v0.7.0 // indirect
+	golang.org/x/net v0.7.0
+	gopkg.in/yaml.v3 v3.0.1
 )
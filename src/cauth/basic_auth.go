@@ -35,3 +35,8 @@ func (b *BasicAuth) GetAuthData() (AuthHeader, error) {
 
 	return AuthHeader{key: "Authorization", value: fmt.Sprintf("Basic %s", encodedAuthStr)}, nil
 }
+
+// GetCredentials returns the username and password e.g. to authenticate against a proxy
+func (b *BasicAuth) GetCredentials() (string, string) {
+	return b.username, b.password
+}
@@ -49,3 +49,10 @@ func TestBasicAuth_GetAuthKey(t *testing.T) {
 		})
 	}
 }
+
+func TestBasicAuth_GetCredentials(t *testing.T) {
+	basicAuth := NewBasicAuth("some-user", "some-password")
+	username, password := basicAuth.GetCredentials()
+	assert.Equal(t, "some-user", username)
+	assert.Equal(t, "some-password", password)
+}
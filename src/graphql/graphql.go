@@ -0,0 +1,216 @@
+// Package graphql posts GraphQL operations using the httpclient Client
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sghaida/go-stuff/src/httpclient"
+)
+
+// persistedQueryNotFound is the error of servers which don't know the hash of a persisted query
+const persistedQueryNotFound = "PersistedQueryNotFound"
+
+// Client posts GraphQL operations to an endpoint, built using ClientBuilder
+type Client struct {
+	client           *httpclient.Client
+	host             string
+	route            string
+	headers          map[string]string
+	persistedQueries bool
+}
+
+// ClientBuilder builds the GraphQL Client
+type ClientBuilder struct {
+	client           *httpclient.Client
+	host             string
+	route            string
+	headers          map[string]string
+	persistedQueries bool
+}
+
+// Request is a GraphQL operation
+type Request struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Location is the position of an error in the query
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is an entry of the errors of a GraphQL response
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	// Path is the path of the response field which failed, made of field names and list indexes
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e Error) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	path := make([]string, 0, len(e.Path))
+	for _, p := range e.Path {
+		path = append(path, fmt.Sprint(p))
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(path, "."), e.Message)
+}
+
+// Errors are the errors of a GraphQL response, the data may still be partially decoded
+type Errors []Error
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+// HTTPError is returned when the server replies with an error status and no GraphQL errors
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("graphql: unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// response is the GraphQL response
+type response struct {
+	Data       json.RawMessage        `json:"data"`
+	Errors     Errors                 `json:"errors"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// NewClient creates a ClientBuilder posting the operations to the route of the host e.g. "graphql"
+func NewClient(client *httpclient.Client, host, route string) *ClientBuilder {
+	return &ClientBuilder{
+		client:  client,
+		host:    host,
+		route:   route,
+		headers: make(map[string]string),
+	}
+}
+
+// WithHeaders add request headers
+func (b *ClientBuilder) WithHeaders(headers map[string]string) *ClientBuilder {
+	for key, value := range headers {
+		b.headers[key] = value
+	}
+	return b
+}
+
+// WithPersistedQueries send the sha256 hash of the queries instead of the queries, the query is sent
+// along with its hash when the server doesn't know it yet, following the automatic persisted queries protocol
+func (b *ClientBuilder) WithPersistedQueries(persistedQueries bool) *ClientBuilder {
+	b.persistedQueries = persistedQueries
+	return b
+}
+
+// Build validates the GraphQL Client
+func (b *ClientBuilder) Build() (*Client, error) {
+	if b.client == nil {
+		return nil, errors.New("client can't be nil")
+	}
+	if _, err := httpclient.NewCallerBuilder(b.client, b.host, b.route, httpclient.POST).Build(); err != nil {
+		return nil, err
+	}
+	return (*Client)(b), nil
+}
+
+// Do posts the operation and decodes the response data into data, which may be nil.
+// the GraphQL errors are returned as Errors after decoding the partial data
+func (c *Client) Do(ctx context.Context, req Request, data interface{}) error {
+	if req.Query == "" {
+		return errors.New("graphql query can't be empty")
+	}
+	if !c.persistedQueries {
+		return c.post(ctx, req, data)
+	}
+
+	sum := sha256.Sum256([]byte(req.Query))
+	extensions := make(map[string]interface{}, len(req.Extensions)+1)
+	for key, value := range req.Extensions {
+		extensions[key] = value
+	}
+	extensions["persistedQuery"] = map[string]interface{}{"version": 1, "sha256Hash": hex.EncodeToString(sum[:])}
+	persisted := req
+	persisted.Query = ""
+	persisted.Extensions = extensions
+
+	err := c.post(ctx, persisted, data)
+	var gqlErrors Errors
+	if !errors.As(err, &gqlErrors) || !gqlErrors.isPersistedQueryNotFound() {
+		return err
+	}
+	// register the query along with its hash
+	persisted.Query = req.Query
+	return c.post(ctx, persisted, data)
+}
+
+// post sends the request and decodes the response
+func (c *Client) post(ctx context.Context, req Request, data interface{}) error {
+	caller, err := httpclient.NewCallerBuilder(c.client, c.host, c.route, httpclient.POST).
+		WithHeaders(c.headers).
+		WithBody(req, httpclient.MediaTypeJSON).
+		WithAccept(httpclient.MediaTypeJSON).
+		Build()
+	if err != nil {
+		return err
+	}
+	resp, err := caller.CallWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer httpclient.DrainAndClose(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read response body: %w", err)
+	}
+
+	var gqlResp response
+	if err := json.Unmarshal(body, &gqlResp); err != nil {
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		return fmt.Errorf("graphql: malformed response: %w", err)
+	}
+	if len(gqlResp.Errors) == 0 && (resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices) {
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if data != nil && len(gqlResp.Data) > 0 && string(gqlResp.Data) != "null" {
+		if err := json.Unmarshal(gqlResp.Data, data); err != nil {
+			return fmt.Errorf("graphql: unable to decode data: %w", err)
+		}
+	}
+	if len(gqlResp.Errors) > 0 {
+		return gqlResp.Errors
+	}
+	return nil
+}
+
+// isPersistedQueryNotFound reports whether the server doesn't know the persisted query
+func (e Errors) isPersistedQueryNotFound() bool {
+	for _, err := range e {
+		if err.Message == persistedQueryNotFound || err.Extensions["code"] == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
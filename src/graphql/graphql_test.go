@@ -0,0 +1,157 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/sghaida/go-stuff/src/httpclient"
+	"github.com/stretchr/testify/assert"
+)
+
+type hero struct {
+	Hero struct {
+		Name    string `json:"name"`
+		Friends []struct {
+			Name string `json:"name"`
+		} `json:"friends"`
+	} `json:"hero"`
+}
+
+// graphqlStandIn replies based on the operation name and keeps the persisted queries it registered
+type graphqlStandIn struct {
+	mutex     *sync.Mutex
+	persisted map[string]string
+	requests  []Request
+}
+
+func (s *graphqlStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	s.mutex.Lock()
+	s.requests = append(s.requests, req)
+	if pq, ok := req.Extensions["persistedQuery"].(map[string]interface{}); ok {
+		hash := pq["sha256Hash"].(string)
+		if req.Query == "" {
+			req.Query = s.persisted[hash]
+		} else {
+			s.persisted[hash] = req.Query
+		}
+	}
+	s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case req.Query == "":
+		_, _ = w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound",` +
+			`"extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+	case req.OperationName == "Partial":
+		_, _ = w.Write([]byte(`{"data":{"hero":{"name":"R2-D2","friends":[{"name":"Luke"},null]}},` +
+			`"errors":[{"message":"friend not found","locations":[{"line":3,"column":5}],` +
+			`"path":["hero","friends",1],"extensions":{"code":"NOT_FOUND"}}]}`))
+	case req.OperationName == "Broken":
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("bad gateway"))
+	case req.OperationName == "Invalid":
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors":[{"message":"syntax error"}]}`))
+	default:
+		_, _ = w.Write([]byte(`{"data":{"hero":{"name":"` + req.Variables["episode"].(string) + `","friends":[]}}}`))
+	}
+}
+
+func TestClient_Do(t *testing.T) {
+	standIn := &graphqlStandIn{mutex: new(sync.Mutex), persisted: make(map[string]string)}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	config, _ := httpclient.NewConfig().Build()
+	client, _ := httpclient.NewClient(config, &http.Client{}, cauth.NoAuth)
+	query := "query Hero($episode: String) { hero(episode: $episode) { name friends { name } } }"
+
+	t.Run("typed data", func(t *testing.T) {
+		gql, err := NewClient(client, server.URL, "graphql").Build()
+		assert.NoError(t, err)
+		var data hero
+		err = gql.Do(context.Background(), Request{
+			Query: query, OperationName: "Hero", Variables: map[string]interface{}{"episode": "JEDI"},
+		}, &data)
+		assert.NoError(t, err)
+		assert.Equal(t, "JEDI", data.Hero.Name)
+	})
+
+	t.Run("partial data and structured errors", func(t *testing.T) {
+		gql, _ := NewClient(client, server.URL, "graphql").Build()
+		var data hero
+		err := gql.Do(context.Background(), Request{Query: query, OperationName: "Partial"}, &data)
+		assert.Equal(t, "R2-D2", data.Hero.Name)
+		assert.Len(t, data.Hero.Friends, 2)
+
+		var gqlErrors Errors
+		if assert.True(t, errors.As(err, &gqlErrors)) {
+			assert.Len(t, gqlErrors, 1)
+			assert.Equal(t, "friend not found", gqlErrors[0].Message)
+			assert.Equal(t, []interface{}{"hero", "friends", float64(1)}, gqlErrors[0].Path)
+			assert.Equal(t, []Location{{Line: 3, Column: 5}}, gqlErrors[0].Locations)
+			assert.Equal(t, "NOT_FOUND", gqlErrors[0].Extensions["code"])
+		}
+		assert.Equal(t, "graphql: hero.friends.1: friend not found", err.Error())
+	})
+
+	t.Run("errors with an error status", func(t *testing.T) {
+		gql, _ := NewClient(client, server.URL, "graphql").Build()
+		err := gql.Do(context.Background(), Request{Query: "{", OperationName: "Invalid"}, nil)
+		var gqlErrors Errors
+		assert.True(t, errors.As(err, &gqlErrors))
+	})
+
+	t.Run("http error", func(t *testing.T) {
+		gql, _ := NewClient(client, server.URL, "graphql").Build()
+		err := gql.Do(context.Background(), Request{Query: query, OperationName: "Broken"}, nil)
+		var httpErr *HTTPError
+		if assert.True(t, errors.As(err, &httpErr)) {
+			assert.Equal(t, http.StatusBadGateway, httpErr.StatusCode)
+			assert.Equal(t, "bad gateway", httpErr.Body)
+		}
+	})
+
+	t.Run("persisted queries", func(t *testing.T) {
+		gql, _ := NewClient(client, server.URL, "graphql").WithPersistedQueries(true).Build()
+		request := Request{Query: query, OperationName: "Hero", Variables: map[string]interface{}{"episode": "EMPIRE"}}
+		sum := sha256.Sum256([]byte(query))
+
+		standIn.mutex.Lock()
+		standIn.requests = nil
+		standIn.mutex.Unlock()
+		var data hero
+		// the hash is unknown so the query is registered, then the hash alone is enough
+		assert.NoError(t, gql.Do(context.Background(), request, &data))
+		assert.NoError(t, gql.Do(context.Background(), request, &data))
+		assert.Equal(t, "EMPIRE", data.Hero.Name)
+
+		standIn.mutex.Lock()
+		defer standIn.mutex.Unlock()
+		assert.Equal(t, query, standIn.persisted[hex.EncodeToString(sum[:])])
+		if assert.Len(t, standIn.requests, 3) {
+			assert.Empty(t, standIn.requests[0].Query)
+			assert.Equal(t, query, standIn.requests[1].Query)
+			assert.Empty(t, standIn.requests[2].Query)
+		}
+	})
+
+	t.Run("invalid clients and requests", func(t *testing.T) {
+		_, err := NewClient(nil, server.URL, "graphql").Build()
+		assert.Error(t, err)
+		_, err = NewClient(client, "", "graphql").Build()
+		assert.Error(t, err)
+		gql, _ := NewClient(client, server.URL, "graphql").Build()
+		assert.Error(t, gql.Do(context.Background(), Request{}, nil))
+	})
+}
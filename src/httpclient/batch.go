@@ -0,0 +1,190 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBatchSkipped is the error of the batch items which weren't called because the batch was aborted
+var ErrBatchSkipped = errors.New("batch item skipped")
+
+// defaultBatchConcurrency is the number of concurrent calls of a batch unless set
+const defaultBatchConcurrency = 10
+
+// Batch runs a list of Callers with bounded concurrency, built using BatchBuilder
+type Batch struct {
+	callers     []*Caller
+	concurrency int
+	failFast    bool
+	timeout     time.Duration
+	progress    func(BatchProgress)
+}
+
+// BatchBuilder builds the Batch
+type BatchBuilder struct {
+	callers     []*Caller
+	concurrency int
+	failFast    bool
+	timeout     time.Duration
+	progress    func(BatchProgress)
+}
+
+// BatchResult is the result of a batch item, the response body is read into memory
+// so that it can be read after the batch context is done
+type BatchResult struct {
+	Response *http.Response
+	Err      error
+}
+
+// BatchProgress is reported each time a batch item completes
+type BatchProgress struct {
+	// Completed is the number of completed items
+	Completed int
+	// Failed is the number of completed items which failed
+	Failed int
+	// Total is the number of items
+	Total int
+}
+
+// NewBatch creates a BatchBuilder running the callers 10 at a time
+func NewBatch(callers ...*Caller) *BatchBuilder {
+	return &BatchBuilder{
+		callers:     callers,
+		concurrency: defaultBatchConcurrency,
+	}
+}
+
+// WithConcurrency set the max number of concurrent calls
+func (b *BatchBuilder) WithConcurrency(concurrency int) *BatchBuilder {
+	b.concurrency = concurrency
+	return b
+}
+
+// WithFailFast stop calling the remaining items once an item fails
+func (b *BatchBuilder) WithFailFast(failFast bool) *BatchBuilder {
+	b.failFast = failFast
+	return b
+}
+
+// WithTimeout set the timeout of the whole batch, 0 means no timeout
+func (b *BatchBuilder) WithTimeout(timeout time.Duration) *BatchBuilder {
+	b.timeout = timeout
+	return b
+}
+
+// WithProgress call progress each time an item completes, the calls are never concurrent
+func (b *BatchBuilder) WithProgress(progress func(BatchProgress)) *BatchBuilder {
+	b.progress = progress
+	return b
+}
+
+// Build validates the Batch
+func (b *BatchBuilder) Build() (*Batch, error) {
+	for i, caller := range b.callers {
+		if caller == nil {
+			return nil, fmt.Errorf("batch caller %d is nil", i)
+		}
+	}
+	if b.concurrency <= 0 {
+		return nil, errors.New("batch concurrency must be positive")
+	}
+	if b.timeout < 0 {
+		return nil, errors.New("batch timeout can't be negative")
+	}
+	return (*Batch)(b), nil
+}
+
+// Run calls the items and returns their results in the same order. responses with an error status are
+// results, only the call errors fail an item. the error is the first item error when failing fast
+// or the context error if the batch timed out or was canceled, the items which weren't called
+// then fail with ErrBatchSkipped
+func (b *Batch) Run(ctx context.Context) ([]BatchResult, error) {
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+	parent := ctx
+	ctx, abort := context.WithCancel(ctx)
+	defer abort()
+
+	results := make([]BatchResult, len(b.callers))
+	progress := BatchProgress{Total: len(b.callers)}
+	var (
+		mutex    sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	complete := func(i int, result BatchResult) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[i] = result
+		progress.Completed++
+		if result.Err != nil {
+			progress.Failed++
+			if b.failFast && firstErr == nil {
+				firstErr = result.Err
+				abort()
+			}
+		}
+		if b.progress != nil {
+			b.progress(progress)
+		}
+	}
+
+	slots := make(chan struct{}, b.concurrency)
+	for i, caller := range b.callers {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			mutex.Lock()
+			cause := firstErr
+			mutex.Unlock()
+			if cause == nil {
+				cause = ctx.Err()
+			}
+			results[i] = BatchResult{Err: fmt.Errorf("%w: %v", ErrBatchSkipped, cause)}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, caller *Caller) {
+			defer wg.Done()
+			defer func() {
+				<-slots
+			}()
+			resp, err := callBuffered(ctx, caller)
+			complete(i, BatchResult{Response: resp, Err: err})
+		}(i, caller)
+	}
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if firstErr != nil {
+		return results, firstErr
+	}
+	return results, parent.Err()
+}
+
+// callBuffered calls the caller and reads the response body into memory
+func callBuffered(ctx context.Context, caller *Caller) (*http.Response, error) {
+	resp, err := caller.CallWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer DrainAndClose(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
@@ -0,0 +1,136 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch_Run(t *testing.T) {
+	// /items/{id} replies with the id after a delay decreasing with the id so that the
+	// items complete out of order, /items/fail fails the connection and /items/slow blocks
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/items/")
+		switch id {
+		case "fail":
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+		case "slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		default:
+			n, _ := strconv.Atoi(id)
+			time.Sleep(time.Duration(20-n) * time.Millisecond)
+			_, _ = w.Write([]byte(id))
+		}
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	callers := func(ids ...string) []*Caller {
+		callers := make([]*Caller, 0, len(ids))
+		for _, id := range ids {
+			caller, _ := NewCallerBuilder(client, server.URL, "items/{id}", GET).
+				WithPathParams(map[string]string{"id": id}).Build()
+			callers = append(callers, caller)
+		}
+		return callers
+	}
+	body := func(resp *http.Response) string {
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+	ids := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+
+	t.Run("ordered results with bounded concurrency", func(t *testing.T) {
+		atomic.StoreInt32(&maxInFlight, 0)
+		progress := make([]BatchProgress, 0)
+		batch, err := NewBatch(callers(ids...)...).WithConcurrency(4).WithProgress(func(p BatchProgress) {
+			progress = append(progress, p)
+		}).Build()
+		assert.NoError(t, err)
+
+		results, err := batch.Run(context.Background())
+		assert.NoError(t, err)
+		for i, result := range results {
+			assert.NoError(t, result.Err)
+			assert.Equal(t, ids[i], body(result.Response))
+		}
+		assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(4))
+		assert.Len(t, progress, 20)
+		assert.Equal(t, BatchProgress{Completed: 20, Total: 20}, progress[19])
+	})
+
+	t.Run("errors are kept per item", func(t *testing.T) {
+		batch, _ := NewBatch(callers("1", "fail", "2")...).Build()
+		results, err := batch.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "1", body(results[0].Response))
+		assert.Error(t, results[1].Err)
+		assert.Nil(t, results[1].Response)
+		assert.Equal(t, "2", body(results[2].Response))
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		var last BatchProgress
+		batch, _ := NewBatch(callers("fail", "slow", "1", "2", "3")...).WithConcurrency(2).WithFailFast(true).
+			WithProgress(func(p BatchProgress) {
+				last = p
+			}).Build()
+		start := time.Now()
+		results, err := batch.Run(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, results[0].Err, err)
+		assert.Error(t, results[1].Err)
+		for _, result := range results[2:] {
+			assert.True(t, errors.Is(result.Err, ErrBatchSkipped))
+		}
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+		assert.Equal(t, 2, last.Failed)
+	})
+
+	t.Run("aggregate timeout", func(t *testing.T) {
+		batch, _ := NewBatch(callers("1", "slow", "2")...).WithConcurrency(1).
+			WithTimeout(50 * time.Millisecond).Build()
+		results, err := batch.Run(context.Background())
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Equal(t, "1", body(results[0].Response))
+		assert.Error(t, results[1].Err)
+		assert.True(t, errors.Is(results[2].Err, ErrBatchSkipped))
+	})
+
+	t.Run("invalid batches", func(t *testing.T) {
+		_, err := NewBatch(callers("1")...).WithConcurrency(0).Build()
+		assert.Error(t, err)
+		_, err = NewBatch(nil).Build()
+		assert.Error(t, err)
+		_, err = NewBatch().WithTimeout(-time.Second).Build()
+		assert.Error(t, err)
+	})
+}
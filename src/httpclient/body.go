@@ -0,0 +1,85 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrResponseTooLarge is returned when a response body exceeds the max response size,
+// by the call when the Content-Length is known or while reading the body otherwise
+var ErrResponseTooLarge = errors.New("response body exceeds the max size")
+
+// ErrResponseHeadersTooLarge is returned when the response headers exceed the max response header size
+var ErrResponseHeadersTooLarge = errors.New("response headers exceed the max size")
+
+// maxDrainSize is the max number of bytes read from a discarded body to allow reusing the connection
+const maxDrainSize = 64 << 10
+
+// maxResponseSizeCtx is the context key of the max response size of the request,
+// which the coalescing transport enforces while buffering the shared response
+type maxResponseSizeCtx struct{}
+
+// DrainAndClose reads what is left of the body, up to 64KB, and closes it so that the connection
+// goes back to the pool. bodies which are larger are closed without being read, which closes their connection
+func DrainAndClose(body io.ReadCloser) {
+	if body == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, maxDrainSize))
+	_ = body.Close()
+}
+
+// limitResponse rejects the response if its Content-Length exceeds maxSize, otherwise reading more than
+// maxSize bytes from its body fails with ErrResponseTooLarge. 0 means no limit
+func limitResponse(resp *http.Response, maxSize int64) error {
+	if maxSize <= 0 || resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+	if resp.ContentLength > maxSize {
+		// the body isn't worth reading, closing it closes the connection
+		_ = resp.Body.Close()
+		return fmt.Errorf("%w: content length %d is over %d bytes", ErrResponseTooLarge, resp.ContentLength, maxSize)
+	}
+	resp.Body = limitBody(resp.Body, maxSize)
+	return nil
+}
+
+// limitBody fails with ErrResponseTooLarge once more than maxSize bytes are read from the body
+func limitBody(body io.ReadCloser, maxSize int64) io.ReadCloser {
+	return &wrappedBody{
+		Reader: &maxSizeReader{reader: body, remaining: maxSize, err: ErrResponseTooLarge},
+		closer: body,
+	}
+}
+
+// readLimited reads the whole body, failing with ErrResponseTooLarge beyond maxSize bytes if positive
+func readLimited(body io.Reader, maxSize int64) ([]byte, error) {
+	if maxSize > 0 {
+		body = &maxSizeReader{reader: body, remaining: maxSize, err: ErrResponseTooLarge}
+	}
+	return io.ReadAll(body)
+}
+
+// responseTooLarge reports whether err is due to a response over the size limits, which retrying doesn't fix
+func responseTooLarge(err error) bool {
+	return errors.Is(err, ErrResponseTooLarge) || errors.Is(err, ErrResponseHeadersTooLarge) ||
+		errors.Is(err, ErrDecompressedTooLarge)
+}
+
+// headersTooLarge maps the error of the transport rejecting oversized response headers
+// to ErrResponseHeadersTooLarge, other errors are returned as they are
+func headersTooLarge(err error) error {
+	if err == nil {
+		return nil
+	}
+	// the transports don't export these errors: net/http for HTTP/1.1 and its bundled http2 for HTTP/2
+	message := err.Error()
+	if strings.Contains(message, "server response headers exceeded") ||
+		strings.Contains(message, "header list larger than") {
+		return fmt.Errorf("%w: %v", ErrResponseHeadersTooLarge, err)
+	}
+	return err
+}
@@ -0,0 +1,236 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaller_MaxResponseSize(t *testing.T) {
+	// /chunked streams the body without Content-Length, /sized sets it
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("a", 100)
+		w.Header().Set("Content-Type", MediaTypeText)
+		if r.URL.Path == "/chunked" {
+			_, _ = w.Write([]byte(body[:50]))
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(body[50:]))
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		configSize   int64
+		callerSize   *int64
+		route        string
+		wantCallErr  bool
+		wantReadErr  bool
+		wantBodySize int
+	}{
+		{name: "no limit", route: "sized", wantBodySize: 100},
+		{name: "under the limit", configSize: 100, route: "sized", wantBodySize: 100},
+		{name: "under the limit chunked", configSize: 100, route: "chunked", wantBodySize: 100},
+		{name: "content length over the limit", configSize: 99, route: "sized", wantCallErr: true},
+		{name: "chunked over the limit", configSize: 99, route: "chunked", wantReadErr: true},
+		{name: "caller limit", callerSize: int64Ptr(10), route: "chunked", wantReadErr: true},
+		{name: "caller without limit", configSize: 10, callerSize: int64Ptr(0), route: "sized", wantBodySize: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewConfig().WithMaxResponseSize(tt.configSize).Build()
+			assert.NoError(t, err)
+			client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+			builder := NewCallerBuilder(client, server.URL, tt.route, GET)
+			if tt.callerSize != nil {
+				builder.WithMaxResponseSize(*tt.callerSize)
+			}
+			caller, err := builder.Build()
+			assert.NoError(t, err)
+
+			resp, err := caller.Call()
+			if tt.wantCallErr {
+				assert.True(t, errors.Is(err, ErrResponseTooLarge), "unexpected error %v", err)
+				assert.Equal(t, int64(0), client.PoolStats().InFlight)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			var body string
+			err = caller.Decode(resp, &body)
+			if tt.wantReadErr {
+				assert.True(t, errors.Is(err, ErrResponseTooLarge), "unexpected error %v", err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantBodySize, len(body))
+			}
+			assert.Equal(t, int64(0), client.PoolStats().InFlight)
+		})
+	}
+
+	_, err := NewConfig().WithMaxResponseSize(-1).Build()
+	assert.Error(t, err)
+	client, _ := NewClient(&Config{}, &http.Client{}, cauth.NoAuth)
+	_, err = NewCallerBuilder(client, server.URL, "sized", GET).WithMaxResponseSize(-1).Build()
+	assert.Error(t, err)
+}
+
+func TestCaller_MaxResponseSizeNotRetried(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		_, _ = w.Write([]byte(strings.Repeat("a", 1000)))
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().WithRetry(3).WithMaxResponseSize(10).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	caller, _ := NewCallerBuilder(client, server.URL, "route", GET).Build()
+
+	_, err := caller.RetryableCallWithContext(context.Background())
+	assert.True(t, errors.Is(err, ErrResponseTooLarge), "unexpected error %v", err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestCaller_MaxResponseSizeCoalesced(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", MediaTypeText)
+		_, _ = w.Write([]byte(strings.Repeat("a", 10)))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(strings.Repeat("a", 90)))
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().WithCoalescing().WithMaxResponseSize(50).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	caller, _ := NewCallerBuilder(client, server.URL, "route", GET).Build()
+	// the limit of another caller doesn't apply to a caller with a larger one
+	larger, _ := NewCallerBuilder(client, server.URL, "route", GET).WithMaxResponseSize(1000).Build()
+
+	wg := new(sync.WaitGroup)
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var body string
+			_, errs[i] = caller.CallAndDecode(context.Background(), &body)
+		}(i)
+	}
+	var largerBody string
+	var largerErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, largerErr = larger.CallAndDecode(context.Background(), &largerBody)
+	}()
+	close(release)
+	wg.Wait()
+	for _, err := range errs {
+		assert.True(t, errors.Is(err, ErrResponseTooLarge), "unexpected error %v", err)
+	}
+	assert.NoError(t, largerErr)
+	assert.Equal(t, 100, len(largerBody))
+}
+
+func TestCaller_MaxResponseHeaderSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Large", strings.Repeat("a", 4<<10))
+	}))
+	defer server.Close()
+
+	call := func(config *Config) error {
+		client, err := NewClient(config, &http.Client{}, cauth.NoAuth)
+		if err != nil {
+			return err
+		}
+		caller, _ := NewCallerBuilder(client, server.URL, "route", GET).Build()
+		resp, err := caller.Call()
+		if err != nil {
+			return err
+		}
+		DrainAndClose(resp.Body)
+		return nil
+	}
+
+	config, _ := NewConfig().WithMaxResponseHeaderSize(1 << 10).Build()
+	err := call(config)
+	assert.True(t, errors.Is(err, ErrResponseHeadersTooLarge), "unexpected error %v", err)
+
+	config, _ = NewConfig().WithMaxResponseHeaderSize(8 << 10).Build()
+	assert.NoError(t, call(config))
+
+	_, err = NewConfig().WithMaxResponseHeaderSize(-1).Build()
+	assert.Error(t, err)
+	// the header size is a transport setting
+	config, _ = NewConfig().WithMaxResponseHeaderSize(1 << 10).Build()
+	_, err = NewClient(config, &http.Client{Transport: roundTripperFunc(nil)}, cauth.NoAuth)
+	assert.Error(t, err)
+}
+
+func TestDrainAndClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large" {
+			_, _ = w.Write([]byte(strings.Repeat("a", 64*maxDrainSize)))
+			return
+		}
+		_, _ = w.Write([]byte(strings.Repeat("a", 1<<10)))
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	call := func(route string) {
+		caller, _ := NewCallerBuilder(client, server.URL, route, GET).Build()
+		resp, err := caller.Call()
+		if assert.NoError(t, err) {
+			DrainAndClose(resp.Body)
+		}
+	}
+
+	// the drained connection is reused, the one of a body too large to drain is closed
+	call("small")
+	call("small")
+	assert.Equal(t, int64(1), client.PoolStats().DialedConns)
+	assert.Equal(t, int64(1), client.PoolStats().ReusedConns)
+	call("large")
+	call("small")
+	assert.Equal(t, int64(2), client.PoolStats().DialedConns)
+	assert.Equal(t, int64(0), client.PoolStats().InFlight)
+
+	DrainAndClose(nil)
+	body := &closeRecorder{Reader: strings.NewReader("body")}
+	DrainAndClose(body)
+	assert.True(t, body.closed)
+	n, _ := body.Read(make([]byte, 1))
+	assert.Equal(t, 0, n)
+}
+
+// closeRecorder records whether it is closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
@@ -1,6 +1,12 @@
 package httpclient
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+)
 
 // CallerBuilder builds the Caller
 type CallerBuilder struct {
@@ -11,17 +17,33 @@ type CallerBuilder struct {
 	query   map[string]string
 	reqBody []byte
 	client  *Client
+
+	pathParams    map[string]string
+	bodyValue     interface{}
+	bodyMediaType string
+	accept        []string
+
+	// per caller overrides of the client config
+	timeout         *time.Duration
+	numOfRetries    *int
+	authType        cauth.IAuth
+	defaultHeaders  map[string]string
+	maxResponseSize *int64
+
+	idempotencyHeader  string
+	idempotencyKeyFunc IdempotencyKeyFunc
 }
 
 // NewCallerBuilder creates http CallerBuilder
 func NewCallerBuilder(client *Client, host, route string, method HttpMethod) *CallerBuilder {
 	return &CallerBuilder{
-		host:    host,
-		route:   route,
-		method:  method,
-		headers: make(map[string]string),
-		query:   make(map[string]string),
-		client:  client,
+		host:       host,
+		route:      route,
+		method:     method,
+		headers:    make(map[string]string),
+		query:      make(map[string]string),
+		client:     client,
+		pathParams: make(map[string]string),
 	}
 }
 
@@ -45,6 +67,15 @@ func (b *CallerBuilder) WithQueryParam(params map[string]string) *CallerBuilder
 	return b
 }
 
+// WithPathParams add the values of the {name} placeholders in the route template,
+// the values are path escaped
+func (b *CallerBuilder) WithPathParams(params map[string]string) *CallerBuilder {
+	for k, v := range params {
+		b.pathParams[k] = v
+	}
+	return b
+}
+
 // WithRequestBody add requestBody
 func (b *CallerBuilder) WithRequestBody(reqBody []byte) *CallerBuilder {
 	if len(reqBody) != 0 {
@@ -53,6 +84,73 @@ func (b *CallerBuilder) WithRequestBody(reqBody []byte) *CallerBuilder {
 	return b
 }
 
+// WithBody add a request value which is marshaled at Build time
+// using the codec registered in the client config for mediaType
+func (b *CallerBuilder) WithBody(value interface{}, mediaType string) *CallerBuilder {
+	b.bodyValue = value
+	b.bodyMediaType = mediaType
+	return b
+}
+
+// WithAccept set the Accept header to the given media types ordered by preference,
+// when no media type is given all the media types registered in the client config are accepted
+func (b *CallerBuilder) WithAccept(mediaTypes ...string) *CallerBuilder {
+	b.accept = mediaTypes
+	if b.accept == nil {
+		b.accept = make([]string, 0)
+	}
+	return b
+}
+
+// WithTimeout override the config timeout for this caller
+func (b *CallerBuilder) WithTimeout(timeout time.Duration) *CallerBuilder {
+	b.timeout = &timeout
+	return b
+}
+
+// WithRetry override the config retry count for this caller
+func (b *CallerBuilder) WithRetry(numOfRetries int) *CallerBuilder {
+	b.numOfRetries = &numOfRetries
+	return b
+}
+
+// WithMaxResponseSize override the config max response body size for this caller, 0 means no limit
+func (b *CallerBuilder) WithMaxResponseSize(maxSize int64) *CallerBuilder {
+	b.maxResponseSize = &maxSize
+	return b
+}
+
+// WithAuth override the client auth for this caller
+func (b *CallerBuilder) WithAuth(authType cauth.IAuth) *CallerBuilder {
+	b.authType = authType
+	return b
+}
+
+// WithDefaultHeaders replace the config default headers for this caller,
+// headers added using WithHeaders are still sent
+func (b *CallerBuilder) WithDefaultHeaders(headers map[string]string) *CallerBuilder {
+	b.defaultHeaders = make(map[string]string, len(headers))
+	for k, v := range headers {
+		b.defaultHeaders[k] = v
+	}
+	return b
+}
+
+// WithIdempotencyKey send an idempotency key in the header, DefaultIdempotencyHeader if empty, which makes
+// RetryableCall retry non idempotent methods such as POST. the key is derived once per call using keyFunc,
+// a random uuid if nil, unless the header is set using WithHeaders
+func (b *CallerBuilder) WithIdempotencyKey(header string, keyFunc IdempotencyKeyFunc) *CallerBuilder {
+	if header == "" {
+		header = DefaultIdempotencyHeader
+	}
+	if keyFunc == nil {
+		keyFunc = newIdempotencyKey
+	}
+	b.idempotencyHeader = header
+	b.idempotencyKeyFunc = keyFunc
+	return b
+}
+
 // Build : Build http Caller
 func (b *CallerBuilder) Build() (*Caller, error) {
 	if b.client == nil {
@@ -67,15 +165,92 @@ func (b *CallerBuilder) Build() (*Caller, error) {
 	if b.method == "" {
 		return nil, errors.New("http method can't be empty")
 	}
+	if !b.method.isValid() {
+		return nil, fmt.Errorf("invalid http method %q", b.method)
+	}
+	if b.timeout != nil && *b.timeout < 0 {
+		return nil, errors.New("timeout can't be negative")
+	}
+	if b.numOfRetries != nil && *b.numOfRetries < 0 {
+		return nil, errors.New("retries can't be negative")
+	}
+	if b.maxResponseSize != nil && *b.maxResponseSize < 0 {
+		return nil, errors.New("max response size can't be negative")
+	}
+	endpoint, socketPath, err := buildEndpoint(b.host, b.route, b.pathParams)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.negotiate(); err != nil {
+		return nil, err
+	}
 
+	config := b.client.config
 	caller := &Caller{
-		host:    b.host,
-		route:   b.route,
-		method:  b.method,
-		headers: b.headers,
-		query:   b.query,
-		reqBody: b.reqBody,
-		client:  b.client,
+		host:       b.host,
+		route:      b.route,
+		method:     b.method,
+		headers:    b.headers,
+		query:      b.query,
+		reqBody:    b.reqBody,
+		client:     b.client,
+		accept:     b.accept,
+		endpoint:   endpoint,
+		socketPath: socketPath,
+
+		timeout:         config.timeout,
+		numOfRetries:    config.numOfRetries,
+		authType:        b.client.authType,
+		defaultHeaders:  config.defaultHeaders,
+		maxResponseSize: config.maxResponseSize,
+
+		idempotencyHeader:  b.idempotencyHeader,
+		idempotencyKeyFunc: b.idempotencyKeyFunc,
+	}
+	if b.timeout != nil {
+		caller.timeout = *b.timeout
+	}
+	if b.numOfRetries != nil {
+		caller.numOfRetries = *b.numOfRetries
+	}
+	if b.authType != nil {
+		caller.authType = b.authType
+	}
+	if b.defaultHeaders != nil {
+		caller.defaultHeaders = b.defaultHeaders
+	}
+	if b.maxResponseSize != nil {
+		caller.maxResponseSize = *b.maxResponseSize
 	}
 	return caller, nil
 }
+
+// negotiate marshals the request value and sets the Content-Type and Accept headers
+func (b *CallerBuilder) negotiate() error {
+	codecs := b.client.config.codecs
+	if b.bodyValue != nil {
+		codec, err := codecs.Lookup(b.bodyMediaType)
+		if err != nil {
+			return err
+		}
+		body, err := codec.Marshal(b.bodyValue)
+		if err != nil {
+			return fmt.Errorf("unable to marshal request body: %w", err)
+		}
+		b.reqBody = body
+		b.headers["Content-Type"] = b.bodyMediaType
+	}
+	if b.accept == nil {
+		return nil
+	}
+	if len(b.accept) == 0 {
+		b.accept = codecs.MediaTypes()
+	}
+	for _, mediaType := range b.accept {
+		if _, err := codecs.Lookup(mediaType); err != nil {
+			return err
+		}
+	}
+	b.headers["Accept"] = acceptHeader(b.accept)
+	return nil
+}
@@ -3,7 +3,9 @@ package httpclient
 import (
 	"github.com/sghaida/go-stuff/src/cauth"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -153,3 +155,242 @@ func TestNewCallerBuilder(t *testing.T) {
 		})
 	}
 }
+
+func TestCallerBuilder_Endpoint(t *testing.T) {
+	config, _ := NewConfig().Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+	tt := []struct {
+		name         string
+		host         string
+		route        string
+		pathParams   map[string]string
+		expected     string
+		expectsError bool
+	}{
+		{
+			name:     "route without leading slash",
+			host:     "https://example.com",
+			route:    "api/v1/users",
+			expected: "https://example.com/api/v1/users",
+		},
+		{
+			name:     "no double slashes",
+			host:     "https://example.com/",
+			route:    "/api/v1/users",
+			expected: "https://example.com/api/v1/users",
+		},
+		{
+			name:     "host with base path",
+			host:     "https://example.com/base/",
+			route:    "/users",
+			expected: "https://example.com/base/users",
+		},
+		{
+			name:       "path params",
+			host:       "https://example.com",
+			route:      "/users/{id}/orders/{orderId}",
+			pathParams: map[string]string{"id": "42", "orderId": "a/b c"},
+			expected:   "https://example.com/users/42/orders/a%2Fb%20c",
+		},
+		{
+			name:     "route with query",
+			host:     "http://localhost:8080",
+			route:    "users?active=true",
+			expected: "http://localhost:8080/users?active=true",
+		},
+		{
+			name:         "missing path param",
+			host:         "https://example.com",
+			route:        "/users/{id}/orders/{orderId}",
+			pathParams:   map[string]string{"id": "42"},
+			expectsError: true,
+		},
+		{
+			name:         "dot segment path param",
+			host:         "https://example.com",
+			route:        "/users/{id}/orders",
+			pathParams:   map[string]string{"id": ".."},
+			expectsError: true,
+		},
+		{
+			name:       "path param with dots",
+			host:       "https://example.com",
+			route:      "/files/{name}",
+			pathParams: map[string]string{"name": "..report.v1"},
+			expected:   "https://example.com/files/..report.v1",
+		},
+		{
+			name:         "unbalanced braces",
+			host:         "https://example.com",
+			route:        "/users/{id",
+			pathParams:   map[string]string{"id": "42"},
+			expectsError: true,
+		},
+		{
+			name:         "host without scheme",
+			host:         "example.com",
+			route:        "users",
+			expectsError: true,
+		},
+		{
+			name:         "host with query",
+			host:         "https://example.com?a=b",
+			route:        "users",
+			expectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			caller, err := NewCallerBuilder(client, tc.host, tc.route, GET).
+				WithPathParams(tc.pathParams).
+				Build()
+			if tc.expectsError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, caller.endpoint.String())
+		})
+	}
+}
+
+func TestCaller_QueryParams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path + "?" + r.URL.RawQuery))
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	caller, err := NewCallerBuilder(client, server.URL, "users/{id}?active=true", GET).
+		WithPathParams(map[string]string{"id": "a b"}).
+		WithQueryParam(map[string]string{"name": "x&y"}).
+		Build()
+	assert.NoError(t, err)
+
+	resp, err := caller.Call()
+	assert.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "/users/a b?active=true&name=x%26y", string(body))
+}
+
+func TestCallerBuilder_Methods(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+	tt := []struct {
+		name         string
+		method       HttpMethod
+		expectsError bool
+	}{
+		{name: "patch", method: PATCH},
+		{name: "options", method: OPTIONS},
+		{name: "webdav method", method: HttpMethod("PROPFIND")},
+		{name: "method with space", method: HttpMethod("GET ME"), expectsError: true},
+		{name: "method with separator", method: HttpMethod("GET/"), expectsError: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			caller, err := NewCallerBuilder(client, server.URL, "resource", tc.method).Build()
+			if tc.expectsError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			resp, err := caller.Call()
+			assert.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, string(tc.method), resp.Header.Get("X-Method"))
+		})
+	}
+}
+
+func TestCallerBuilder_Overrides(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("X-Authorization", r.Header.Get("Authorization"))
+		w.Header().Set("X-Api-Key", r.Header.Get("x-api-key"))
+		w.Header().Set("X-Client-Id", r.Header.Get("X-Client-Id"))
+		w.Header().Set("X-Tenant", r.Header.Get("X-Tenant"))
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().
+		WithTimeout(1 * time.Second).
+		WithRetry(3).
+		WithHeaders(map[string]string{"X-Client-Id": "default"}).
+		Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NewJWTAuth("token"))
+
+	t.Run("config values are used by default", func(t *testing.T) {
+		caller, err := NewCallerBuilder(client, server.URL, "fast", GET).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 1*time.Second, caller.timeout)
+		assert.Equal(t, 3, caller.numOfRetries)
+
+		resp, err := caller.Call()
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, "Bearer token", resp.Header.Get("X-Authorization"))
+		assert.Equal(t, "default", resp.Header.Get("X-Client-Id"))
+	})
+
+	t.Run("override timeout", func(t *testing.T) {
+		caller, err := NewCallerBuilder(client, server.URL, "slow", GET).WithTimeout(50 * time.Millisecond).Build()
+		assert.NoError(t, err)
+		_, err = caller.Call()
+		assert.Error(t, err)
+	})
+
+	t.Run("override retry", func(t *testing.T) {
+		caller, err := NewCallerBuilder(client, server.URL, "fast", GET).WithRetry(1).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, caller.numOfRetries)
+	})
+
+	t.Run("override auth and default headers", func(t *testing.T) {
+		caller, err := NewCallerBuilder(client, server.URL, "fast", GET).
+			WithAuth(cauth.NewAPIKey("key")).
+			WithDefaultHeaders(map[string]string{"X-Tenant": "tenant"}).
+			Build()
+		assert.NoError(t, err)
+
+		resp, err := caller.Call()
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, "", resp.Header.Get("X-Authorization"))
+		assert.Equal(t, "key", resp.Header.Get("X-Api-Key"))
+		assert.Equal(t, "", resp.Header.Get("X-Client-Id"))
+		assert.Equal(t, "tenant", resp.Header.Get("X-Tenant"))
+	})
+
+	t.Run("request headers override default headers", func(t *testing.T) {
+		caller, _ := NewCallerBuilder(client, server.URL, "fast", GET).
+			WithHeaders(map[string]string{"X-Client-Id": "request"}).
+			Build()
+		resp, err := caller.Call()
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, "request", resp.Header.Get("X-Client-Id"))
+	})
+
+	t.Run("negative overrides", func(t *testing.T) {
+		_, err := NewCallerBuilder(client, server.URL, "fast", GET).WithTimeout(-1).Build()
+		assert.Error(t, err)
+		_, err = NewCallerBuilder(client, server.URL, "fast", GET).WithRetry(-1).Build()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,247 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBulkheadFull is returned when a request is rejected because its bulkhead compartment
+// has no free slot and its wait queue is full or the queue timeout expired
+var ErrBulkheadFull = errors.New("bulkhead full")
+
+// Bulkhead limits the concurrent in flight requests per host or per named group of hosts so that
+// a slow downstream can't exhaust the goroutines and the connections of the others, built using BulkheadBuilder.
+// a request is in flight until its response body is closed or fully read
+type Bulkhead struct {
+	maxConcurrent int
+	maxQueue      int
+	queueTimeout  time.Duration
+	groups        []bulkheadGroup
+
+	mutex        *sync.Mutex
+	compartments map[string]*compartment
+}
+
+// BulkheadBuilder builds the Bulkhead
+type BulkheadBuilder struct {
+	maxConcurrent int
+	maxQueue      int
+	queueTimeout  time.Duration
+	groups        []bulkheadGroup
+}
+
+// bulkheadGroup is a compartment shared by the hosts matching the patterns
+type bulkheadGroup struct {
+	name          string
+	maxConcurrent int
+	patterns      []string
+}
+
+// BulkheadStats are the gauges of a bulkhead compartment
+type BulkheadStats struct {
+	// Limit is the max number of concurrent in flight requests
+	Limit int
+	// InFlight is the number of in flight requests
+	InFlight int64
+	// Queued is the number of requests waiting for a slot
+	Queued int64
+	// Rejected is the total number of rejected requests
+	Rejected int64
+}
+
+// compartment is the semaphore and the gauges of a host or a group
+type compartment struct {
+	slots    chan struct{}
+	inFlight int64
+	queued   int64
+	rejected int64
+}
+
+// NewBulkhead creates a BulkheadBuilder allowing maxConcurrent in flight requests per host,
+// by default requests are rejected right away when all the slots are taken
+func NewBulkhead(maxConcurrent int) *BulkheadBuilder {
+	return &BulkheadBuilder{
+		maxConcurrent: maxConcurrent,
+		groups:        make([]bulkheadGroup, 0),
+	}
+}
+
+// WithMaxQueue set the max number of requests waiting for a slot per host or group
+func (b *BulkheadBuilder) WithMaxQueue(maxQueue int) *BulkheadBuilder {
+	b.maxQueue = maxQueue
+	return b
+}
+
+// WithQueueTimeout set how long a queued request waits for a slot, 0 waits until the request context is done
+func (b *BulkheadBuilder) WithQueueTimeout(timeout time.Duration) *BulkheadBuilder {
+	b.queueTimeout = timeout
+	return b
+}
+
+// WithGroup share a compartment of maxConcurrent slots between the hosts matching the patterns,
+// which are host names or domain suffixes such as *.example.com or .example.com.
+// the groups are matched in the order they are added
+func (b *BulkheadBuilder) WithGroup(name string, maxConcurrent int, hostPatterns ...string) *BulkheadBuilder {
+	patterns := make([]string, 0, len(hostPatterns))
+	for _, pattern := range hostPatterns {
+		patterns = append(patterns, strings.ToLower(pattern))
+	}
+	b.groups = append(b.groups, bulkheadGroup{name: name, maxConcurrent: maxConcurrent, patterns: patterns})
+	return b
+}
+
+// Build validates the Bulkhead
+func (b *BulkheadBuilder) Build() (*Bulkhead, error) {
+	if b.maxConcurrent <= 0 {
+		return nil, errors.New("bulkhead max concurrent requests must be positive")
+	}
+	if b.maxQueue < 0 {
+		return nil, errors.New("bulkhead max queue can't be negative")
+	}
+	if b.queueTimeout < 0 {
+		return nil, errors.New("bulkhead queue timeout can't be negative")
+	}
+	for _, group := range b.groups {
+		if group.name == "" {
+			return nil, errors.New("bulkhead group name can't be empty")
+		}
+		if group.maxConcurrent <= 0 {
+			return nil, fmt.Errorf("bulkhead group %q max concurrent requests must be positive", group.name)
+		}
+		if len(group.patterns) == 0 {
+			return nil, fmt.Errorf("bulkhead group %q has no hosts", group.name)
+		}
+	}
+	return &Bulkhead{
+		maxConcurrent: b.maxConcurrent,
+		maxQueue:      b.maxQueue,
+		queueTimeout:  b.queueTimeout,
+		groups:        append([]bulkheadGroup(nil), b.groups...),
+		mutex:         new(sync.Mutex),
+		compartments:  make(map[string]*compartment),
+	}, nil
+}
+
+// Stats returns the gauges of the compartments by host or group name
+func (b *Bulkhead) Stats() map[string]BulkheadStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	stats := make(map[string]BulkheadStats, len(b.compartments))
+	for name, c := range b.compartments {
+		stats[name] = BulkheadStats{
+			Limit:    cap(c.slots),
+			InFlight: atomic.LoadInt64(&c.inFlight),
+			Queued:   atomic.LoadInt64(&c.queued),
+			Rejected: atomic.LoadInt64(&c.rejected),
+		}
+	}
+	return stats
+}
+
+// compartment returns the compartment of the host, creating it on first use
+func (b *Bulkhead) compartment(host string) *compartment {
+	name, limit := host, b.maxConcurrent
+	hostname := strings.ToLower((&url.URL{Host: host}).Hostname())
+	for _, group := range b.groups {
+		if matchesAnyHostPattern(group.patterns, hostname) {
+			name, limit = group.name, group.maxConcurrent
+			break
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	c, ok := b.compartments[name]
+	if !ok {
+		c = &compartment{slots: make(chan struct{}, limit)}
+		b.compartments[name] = c
+	}
+	return c
+}
+
+// acquire takes a slot of the compartment, waiting in the queue if allowed
+func (b *Bulkhead) acquire(ctx context.Context, c *compartment) error {
+	select {
+	case c.slots <- struct{}{}:
+		atomic.AddInt64(&c.inFlight, 1)
+		return nil
+	default:
+	}
+
+	if atomic.AddInt64(&c.queued, 1) > int64(b.maxQueue) {
+		atomic.AddInt64(&c.queued, -1)
+		atomic.AddInt64(&c.rejected, 1)
+		return fmt.Errorf("%w: %d requests in flight and %d queued", ErrBulkheadFull, cap(c.slots), b.maxQueue)
+	}
+	defer atomic.AddInt64(&c.queued, -1)
+
+	var timeout <-chan time.Time
+	if b.queueTimeout > 0 {
+		timer := time.NewTimer(b.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case c.slots <- struct{}{}:
+		atomic.AddInt64(&c.inFlight, 1)
+		return nil
+	case <-timeout:
+		atomic.AddInt64(&c.rejected, 1)
+		return fmt.Errorf("%w: no slot after waiting %s", ErrBulkheadFull, b.queueTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot of the compartment
+func (c *compartment) release() {
+	atomic.AddInt64(&c.inFlight, -1)
+	<-c.slots
+}
+
+// bulkheadTransport sends the requests through the bulkhead
+type bulkheadTransport struct {
+	next     http.RoundTripper
+	bulkhead *Bulkhead
+}
+
+// RoundTrip sends the request once its compartment has a free slot, which is released
+// when the response body is closed or fully read
+func (t *bulkheadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := t.bulkhead.compartment(req.URL.Host)
+	if err := t.bulkhead.acquire(req.Context(), c); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+	resp.Body = wrapBody(resp.Body, c.release)
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the next transport
+func (t *bulkheadTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+// matchesAnyHostPattern matches a host against host names or *.domain or .domain suffixes
+func matchesAnyHostPattern(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if matchesHostPattern(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
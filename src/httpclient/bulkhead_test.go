@@ -0,0 +1,149 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Bulkhead(t *testing.T) {
+	// the slow server blocks until released, the fast one replies right away
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	bulkhead, err := NewBulkhead(2).WithMaxQueue(1).WithQueueTimeout(50 * time.Millisecond).Build()
+	assert.NoError(t, err)
+	config, _ := NewConfig().WithBulkhead(bulkhead).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	slowHost := slow.Listener.Addr().String()
+
+	call := func(host string) error {
+		caller, _ := NewCallerBuilder(client, host, "route", GET).Build()
+		resp, err := caller.Call()
+		if err != nil {
+			return err
+		}
+		DrainAndClose(resp.Body)
+		return nil
+	}
+	waitFor := func(condition func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !condition() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// take the two slots of the slow host
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, call(slow.URL))
+		}()
+	}
+	waitFor(func() bool { return bulkhead.Stats()[slowHost].InFlight == 2 })
+
+	t.Run("queue timeout", func(t *testing.T) {
+		start := time.Now()
+		err := call(slow.URL)
+		assert.True(t, errors.Is(err, ErrBulkheadFull))
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		queued := make(chan error, 1)
+		go func() {
+			queued <- call(slow.URL)
+		}()
+		waitFor(func() bool { return bulkhead.Stats()[slowHost].Queued == 1 })
+		assert.True(t, errors.Is(call(slow.URL), ErrBulkheadFull))
+		assert.True(t, errors.Is(<-queued, ErrBulkheadFull))
+	})
+
+	t.Run("other hosts are not affected", func(t *testing.T) {
+		assert.NoError(t, call(fast.URL))
+	})
+
+	t.Run("gauges", func(t *testing.T) {
+		stats := bulkhead.Stats()[slowHost]
+		assert.Equal(t, BulkheadStats{Limit: 2, InFlight: 2, Queued: 0, Rejected: 3}, stats)
+	})
+
+	t.Run("slots are released when the bodies are closed", func(t *testing.T) {
+		close(release)
+		wg.Wait()
+		assert.Equal(t, int64(0), bulkhead.Stats()[slowHost].InFlight)
+		assert.NoError(t, call(slow.URL))
+	})
+}
+
+func TestBulkhead_Groups(t *testing.T) {
+	bulkhead, err := NewBulkhead(5).WithGroup("partners", 1, "*.partner.com", "legacy.example.com").Build()
+	assert.NoError(t, err)
+
+	tt := []struct {
+		host     string
+		expected string
+		limit    int
+	}{
+		{host: "api.partner.com:443", expected: "partners", limit: 1},
+		{host: "LEGACY.example.com", expected: "partners", limit: 1},
+		{host: "example.com:8080", expected: "example.com:8080", limit: 5},
+	}
+	for _, tc := range tt {
+		t.Run(tc.host, func(t *testing.T) {
+			c := bulkhead.compartment(tc.host)
+			assert.Equal(t, tc.limit, cap(c.slots))
+			_, ok := bulkhead.Stats()[tc.expected]
+			assert.True(t, ok)
+		})
+	}
+
+	t.Run("queued request gives up with its context", func(t *testing.T) {
+		bulkhead, _ := NewBulkhead(1).WithMaxQueue(1).Build()
+		c := bulkhead.compartment("example.com")
+		assert.NoError(t, bulkhead.acquire(context.Background(), c))
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.True(t, errors.Is(bulkhead.acquire(ctx, c), context.DeadlineExceeded))
+		c.release()
+		assert.NoError(t, bulkhead.acquire(context.Background(), c))
+	})
+
+	t.Run("building again doesn't reset the bulkhead", func(t *testing.T) {
+		builder := NewBulkhead(1)
+		bulkhead, _ := builder.Build()
+		assert.NoError(t, bulkhead.acquire(context.Background(), bulkhead.compartment("example.com")))
+		other, err := builder.WithGroup("partners", 2, "*.partner.com").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), bulkhead.Stats()["example.com"].InFlight)
+		assert.Empty(t, other.Stats())
+		assert.Empty(t, bulkhead.groups)
+	})
+
+	t.Run("invalid bulkheads", func(t *testing.T) {
+		_, err := NewBulkhead(0).Build()
+		assert.Error(t, err)
+		_, err = NewBulkhead(1).WithMaxQueue(-1).Build()
+		assert.Error(t, err)
+		_, err = NewBulkhead(1).WithGroup("", 1, "example.com").Build()
+		assert.Error(t, err)
+		_, err = NewBulkhead(1).WithGroup("empty", 1).Build()
+		assert.Error(t, err)
+		_, err = NewBulkhead(1).WithGroup("zero", 0, "example.com").Build()
+		assert.Error(t, err)
+	})
+}
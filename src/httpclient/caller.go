@@ -5,16 +5,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/sghaida/go-stuff/src/cauth"
 	"github.com/sghaida/go-stuff/src/retry"
 	"io"
 	"net/http"
-)
-
-// TODO 3: update the retryable logic to include error codes to retry
-const (
-	maxIdleConns        = 100
-	maxConnsPerHost     = 100
-	maxIdleConnsPerHost = 100
+	"net/url"
+	"time"
 )
 
 // Caller built using CallerBuilder
@@ -26,6 +22,22 @@ type Caller struct {
 	query   map[string]string
 	reqBody []byte
 	client  *Client
+	accept  []string
+	// endpoint is the host joined with the expanded route
+	endpoint *url.URL
+	// socketPath is set for unix:// hosts
+	socketPath string
+
+	// the client config values, unless overridden using the CallerBuilder
+	timeout         time.Duration
+	numOfRetries    int
+	authType        cauth.IAuth
+	defaultHeaders  map[string]string
+	maxResponseSize int64
+
+	// idempotencyHeader is empty unless the caller sends an idempotency key
+	idempotencyHeader  string
+	idempotencyKeyFunc IdempotencyKeyFunc
 }
 
 // Call : do request http call with background context
@@ -38,55 +50,201 @@ func (c *Caller) Call() (*http.Response, error) {
 // CallWithContext do request http call with context
 func (c *Caller) CallWithContext(ctx context.Context) (*http.Response, error) {
 
+	config := c.client.config
+
+	// compress the request body if it reaches the threshold
+	reqBody := c.reqBody
+	var contentEncoding ContentEncoding
+	if config.requestEncoding != "" && len(reqBody) > 0 && len(reqBody) >= config.compressionThreshold {
+		compressed, err := compress(config.requestEncoding, reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("unable to compress request body: %w", err)
+		}
+		reqBody = compressed
+		contentEncoding = config.requestEncoding
+	}
 	// read request body
-	body := io.NopCloser(bytes.NewReader(c.reqBody))
+	body := bytes.NewReader(reqBody)
 
-	// create the http request
-	url := fmt.Sprintf("%s/%s", c.host, c.route)
-	req, err := http.NewRequest(string(c.method), url, body)
+	// the timeout covers the call and reading the response body
+	cancel := context.CancelFunc(func() {})
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	}
 
-	req = req.WithContext(ctx)
+	if c.socketPath != "" {
+		ctx = withUnixSocket(ctx, c.socketPath)
+	}
+	if c.maxResponseSize > 0 && config.coalesce {
+		ctx = context.WithValue(ctx, maxResponseSizeCtx{}, c.maxResponseSize)
+	}
+
+	// create the http request
+	req, err := http.NewRequestWithContext(ctx, string(c.method), c.endpoint.String(), body)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	if c.socketPath != "" {
+		req.Host = "localhost"
+	}
 
 	// add the default headers  (from the config) if available
-	for key, value := range c.client.config.defaultHeaders {
+	for key, value := range c.defaultHeaders {
 		req.Header.Add(key, value)
 	}
-	// add extra headers passed by the request
+	// add extra headers passed by the request, overriding the default ones
 	for key, value := range c.headers {
-		req.Header.Add(key, value)
+		req.Header.Set(key, value)
 	}
-	auth, err := c.client.getAuthHeader()
+	auth, err := getAuthHeader(c.authType)
 	if err != nil {
-		// TODO wrap the error
-		return nil, errors.New("unable to extract auth header")
+		cancel()
+		return nil, fmt.Errorf("unable to extract auth header: %w", err)
 	}
 	// add auth header
 	key, value := auth.GetAuthKeyValue()
 	// skip no-auth case
 	if key != "" && value != "" {
 		req.Header.Add(key, value)
+		if config.coalesce {
+			req = req.WithContext(context.WithValue(req.Context(), authHeaderKeyCtx{}, key))
+		}
+	}
+	// the idempotency key is shared by the attempts of a RetryableCall
+	if c.idempotencyHeader != "" {
+		idempotencyKey, err := c.idempotencyKey(ctx)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		req.Header.Set(c.idempotencyHeader, idempotencyKey)
+	}
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", string(contentEncoding))
+	}
+	// ask for the encodings we decode ourselves so that the max decompressed size is enforced
+	if config.maxDecompressedSize > 0 && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
 	}
 	// add query values
 	q := req.URL.Query()
 	for k, v := range c.query {
 		q.Add(k, v)
 	}
+	req.URL.RawQuery = q.Encode()
 
 	resp, err := c.client.client.Do(req)
-
-	return resp, err
+	if err == nil {
+		resp, err = c.followRedirects(req, resp, reqBody, key)
+	}
+	if err != nil {
+		cancel()
+		return nil, headersTooLarge(err)
+	}
+	// release the timeout context once the body is closed
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	if err := decompressResponse(resp, config.maxDecompressedSize); err != nil {
+		return nil, err
+	}
+	if err := limitResponse(resp, c.maxResponseSize); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
-// RetryableCall do http call with retry logic.
+// RetryableCall do http call with retry logic. POST, PATCH and CONNECT calls are retried only when sent
+// WithIdempotencyKey, they used to be retried on every error like the idempotent methods
 func (c *Caller) RetryableCall() (*http.Response, error) {
+	return c.RetryableCallWithContext(context.Background())
+}
+
+// RetryableCallWithContext do http call with context and retry logic. transport errors and the 429 and 5xx
+// gateway statuses are retried for idempotent methods and for calls carrying an idempotency key,
+// other calls are tried once. all the attempts share the same idempotency key. when the retries are
+// exhausted the last response is returned
+func (c *Caller) RetryableCallWithContext(ctx context.Context) (*http.Response, error) {
+	ctx, err := c.withIdempotencyKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	retryable := c.isRetryable()
 
-	retryable := retry.NewRetry(c.client.config.numOfRetries, retry.DefaultInitialDelay, retry.DefaultMaxDelay)
-	toExecute := func() (interface{}, error) {
-		return c.Call()
+	var last *http.Response
+	toExecute := func(ctx context.Context) (interface{}, error) {
+		// the response of the previous attempt is discarded
+		if last != nil {
+			DrainAndClose(last.Body)
+			last = nil
+		}
+		resp, err := c.CallWithContext(ctx)
+		if err != nil {
+			if !retryable || responseTooLarge(err) {
+				return nil, retry.Terminate(err)
+			}
+			return nil, err
+		}
+		if retryable && retryableStatuses[resp.StatusCode] {
+			last = resp
+			return nil, &retryableStatusError{resp: resp}
+		}
+		return resp, nil
 	}
-	resp, err := retryable.Run(toExecute)
+	resp, err := retry.NewRetry(c.numOfRetries, retry.DefaultInitialDelay, retry.DefaultMaxDelay).
+		RunWithContext(ctx, toExecute)
 
+	var statusErr *retryableStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.resp, nil
+	}
 	response, _ := resp.(*http.Response)
 	return response, err
+}
+
+// CallAndDecode do request http call with context and decode the response body into v
+// using the codec registered for the response Content-Type. the response body is consumed and closed,
+// the returned response can be used to check the status code
+func (c *Caller) CallAndDecode(ctx context.Context, v interface{}) (*http.Response, error) {
+	resp, err := c.CallWithContext(ctx)
+	if err != nil {
+		return resp, err
+	}
+	return resp, c.Decode(resp, v)
+}
+
+// Decode reads and closes the response body and decodes it into v using the codec registered for the
+// response Content-Type. when the response has no Content-Type, the single accepted media type is used
+func (c *Caller) Decode(resp *http.Response, v interface{}) error {
+	defer DrainAndClose(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read response body: %w", err)
+	}
+	if len(body) == 0 {
+		return nil
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		if len(c.accept) != 1 {
+			return fmt.Errorf("%w: response has no Content-Type", ErrUnsupportedMediaType)
+		}
+		contentType = c.accept[0]
+	}
+	codec, err := c.client.config.codecs.Lookup(contentType)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(body, v)
+}
+
+// cancelBody cancels the call context once the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
 
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
 }
@@ -11,34 +11,96 @@ type Client struct {
 	config   *Config
 	client   http.Client
 	authType cauth.IAuth
+	stats    *poolStats
+	// transport is the configured transport before any wrapping
+	transport http.RoundTripper
 }
 
-// NewClient create new http Client
+// NewClient create new http Client, the given http client is copied and its transport is cloned
+// and configured using the config. transports other than *http.Transport are used as they are
 func NewClient(config *Config, client *http.Client, authType cauth.IAuth) (*Client, error) {
-	// set up the transport layer
-	// allow 100 concurrent connection in the connection pool
-	if client.Transport == nil {
-		t := http.Transport{}
-		client.Transport = &t
-	}
-	t := client.Transport.(*http.Transport).Clone()
-	t.MaxIdleConns = maxIdleConns
-	t.MaxConnsPerHost = maxConnsPerHost
-	t.MaxIdleConnsPerHost = maxIdleConnsPerHost
-	// override transport
-	client.Transport = t
-
 	if config == nil {
 		return nil, errors.New("config is empty")
 	}
 	if authType == nil {
 		return nil, errors.New("auth type is not defined")
 	}
-	return &Client{client: *client, config: config, authType: authType}, nil
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	// set up the transport layer
+	stats := new(poolStats)
+	var transport http.RoundTripper
+	switch t := client.Transport.(type) {
+	case nil:
+		base, _ := http.DefaultTransport.(*http.Transport)
+		tr, err := newTransport(base, config, stats)
+		if err != nil {
+			return nil, err
+		}
+		transport = tr
+	case *http.Transport:
+		tr, err := newTransport(t, config, stats)
+		if err != nil {
+			return nil, err
+		}
+		transport = tr
+	default:
+		if config.transport.isSet() || config.tls.isSet() {
+			return nil, errTransportOptions
+		}
+		transport = t
+	}
+
+	httpClient := *client
+	httpClient.Transport = &statsTransport{next: transport, stats: stats}
+	if config.faults != nil {
+		httpClient.Transport = &faultTransport{next: httpClient.Transport, faults: config.faults}
+	}
+	if config.limiter != nil {
+		httpClient.Transport = &limiterTransport{next: httpClient.Transport, limiter: config.limiter}
+	}
+	if config.bulkhead != nil {
+		httpClient.Transport = &bulkheadTransport{next: httpClient.Transport, bulkhead: config.bulkhead}
+	}
+	if config.coalesce {
+		httpClient.Transport = newCoalescingTransport(httpClient.Transport, config.coalesceHeaders, stats, config.timeout)
+	}
+	if config.cookieJar != nil {
+		httpClient.Jar = config.cookieJar
+	}
+	// redirects are followed by the Caller according to the config redirect policy
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &Client{
+		client:    httpClient,
+		config:    config,
+		authType:  authType,
+		stats:     stats,
+		transport: transport,
+	}, nil
+}
+
+// CloseIdleConnections closes the idle connections of the client transport
+func (c *Client) CloseIdleConnections() {
+	closeIdleConnections(c.transport)
+}
+
+// PoolStats returns the connection pool statistics
+func (c *Client) PoolStats() PoolStats {
+	return c.stats.snapshot()
 }
 
 func (c *Client) getAuthHeader() (cauth.AuthHeader, error) {
-	switch authData := c.authType.(type) {
+	return getAuthHeader(c.authType)
+}
+
+// getAuthHeader extracts the auth header of the given auth type
+func getAuthHeader(authType cauth.IAuth) (cauth.AuthHeader, error) {
+	switch authData := authType.(type) {
 	case cauth.ISomeAuth:
 		return authData.GetAuthData()
 	case cauth.INoAuth:
@@ -47,3 +109,8 @@ func (c *Client) getAuthHeader() (cauth.AuthHeader, error) {
 		return cauth.NewAuthHeader("", ""), errors.New("unsupported auth type")
 	}
 }
+
+// Jar returns the cookie jar of the client or nil if cookies aren't stored
+func (c *Client) Jar() http.CookieJar {
+	return c.client.Jar
+}
@@ -0,0 +1,255 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// coalesceHeaders are always part of the coalescing key as they select the caller or the representation
+var coalesceHeaders = []string{"Authorization", "Cookie", "Accept", "Accept-Encoding", "Range"}
+
+// authHeaderKeyCtx is the context key of the auth header name of the request,
+// which is part of the coalescing key
+type authHeaderKeyCtx struct{}
+
+// coalescingTransport collapses concurrent identical GET and HEAD requests into one upstream call,
+// the buffered response is shared by all the waiting requests
+type coalescingTransport struct {
+	next    http.RoundTripper
+	headers []string
+	stats   *poolStats
+	// timeout bounds the upstream call for the requests without a deadline, 0 means no bound
+	timeout time.Duration
+
+	mutex *sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is an upstream call shared by its waiters, it is canceled at the latest deadline of its waiters
+type coalescedCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	// deadline is enforced by timer unless a waiter has no deadline
+	deadline  time.Time
+	timer     *time.Timer
+	unbounded bool
+	expired   int32
+
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+// newCoalescingTransport creates a coalescingTransport keying the requests by method, url,
+// the selected headers and coalesceHeaders. timeout is the deadline of the requests which have none
+func newCoalescingTransport(next http.RoundTripper, headers []string, stats *poolStats,
+	timeout time.Duration) *coalescingTransport {
+	keyHeaders := make([]string, 0, len(headers)+len(coalesceHeaders))
+	for _, header := range append(headers, coalesceHeaders...) {
+		keyHeaders = append(keyHeaders, http.CanonicalHeaderKey(header))
+	}
+	return &coalescingTransport{
+		next:    next,
+		headers: keyHeaders,
+		stats:   stats,
+		timeout: timeout,
+		mutex:   new(sync.Mutex),
+		calls:   make(map[string]*coalescedCall),
+	}
+}
+
+// RoundTrip joins the in flight call of an identical request or starts a new one
+func (t *coalescingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.canCoalesce(req) {
+		return t.next.RoundTrip(req)
+	}
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	key := t.key(req)
+	deadline, ok := req.Context().Deadline()
+	if !ok && t.timeout > 0 {
+		deadline = time.Now().Add(t.timeout)
+	}
+	t.mutex.Lock()
+	call, ok := t.calls[key]
+	if ok {
+		atomic.AddInt64(&t.stats.coalescedRequests, 1)
+	} else {
+		// the upstream call outlives the request which started it as long as there are waiters
+		ctx, cancel := context.WithCancel(detachedContext{req.Context()})
+		call = &coalescedCall{done: make(chan struct{}), cancel: cancel}
+		t.calls[key] = call
+		upstream := req.Clone(ctx)
+		upstream.Body = nil
+		go t.do(key, call, upstream)
+	}
+	call.waiters++
+	call.waitUntil(deadline)
+	t.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return nil, call.err
+		}
+		return call.response(req), nil
+	case <-req.Context().Done():
+		t.leave(key, call)
+		return nil, req.Context().Err()
+	}
+}
+
+// CloseIdleConnections closes the idle connections of the next transport
+func (t *coalescingTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+// canCoalesce reports whether the request is a GET or HEAD without a body which doesn't upgrade the connection
+func (t *coalescingTransport) canCoalesce(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	return req.Header.Get("Upgrade") == ""
+}
+
+// key identifies identical requests, the requests with another max response size aren't identical
+// as the shared body is buffered up to the max size
+func (t *coalescingTransport) key(req *http.Request) string {
+	headers := t.headers
+	if authKey, ok := req.Context().Value(authHeaderKeyCtx{}).(string); ok {
+		headers = append([]string{http.CanonicalHeaderKey(authKey)}, headers...)
+	}
+	sorted := make([]string, len(headers))
+	copy(sorted, headers)
+	sort.Strings(sorted)
+
+	var key strings.Builder
+	key.WriteString(req.Method + " " + req.URL.String())
+	if maxSize, ok := req.Context().Value(maxResponseSizeCtx{}).(int64); ok && maxSize > 0 {
+		key.WriteString("\nmax response size: " + strconv.FormatInt(maxSize, 10))
+	}
+	for i, header := range sorted {
+		if i > 0 && header == sorted[i-1] {
+			continue
+		}
+		key.WriteString("\n" + header + ": " + strings.Join(req.Header.Values(header), ", "))
+	}
+	return key.String()
+}
+
+// do sends the upstream request and buffers the response
+func (t *coalescingTransport) do(key string, call *coalescedCall, req *http.Request) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		maxSize, _ := req.Context().Value(maxResponseSizeCtx{}).(int64)
+		call.body, err = readLimited(resp.Body, maxSize)
+		DrainAndClose(resp.Body)
+		call.resp = resp
+	}
+	if err != nil && atomic.LoadInt32(&call.expired) == 1 {
+		err = fmt.Errorf("coalesced request: %w", context.DeadlineExceeded)
+	}
+	call.err = err
+
+	t.mutex.Lock()
+	if t.calls[key] == call {
+		delete(t.calls, key)
+	}
+	if call.timer != nil {
+		call.timer.Stop()
+	}
+	t.mutex.Unlock()
+	call.cancel()
+	close(call.done)
+}
+
+// leave removes a waiter whose request is done, the upstream call is canceled once all the waiters left
+func (t *coalescingTransport) leave(key string, call *coalescedCall) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	call.waiters--
+	if call.waiters > 0 {
+		return
+	}
+	if t.calls[key] == call {
+		delete(t.calls, key)
+	}
+	call.cancel()
+}
+
+// waitUntil extends the upstream call up to the deadline of a new waiter, a zero deadline lifts the bound.
+// it is called with the transport lock held
+func (c *coalescedCall) waitUntil(deadline time.Time) {
+	if c.unbounded {
+		return
+	}
+	if deadline.IsZero() {
+		c.unbounded = true
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		return
+	}
+	if c.timer == nil {
+		c.deadline = deadline
+		c.timer = time.AfterFunc(time.Until(deadline), c.expire)
+		return
+	}
+	if deadline.After(c.deadline) {
+		c.deadline = deadline
+		c.timer.Reset(time.Until(deadline))
+	}
+}
+
+// expire cancels the upstream call once the deadline of all its waiters passed
+func (c *coalescedCall) expire() {
+	atomic.StoreInt32(&c.expired, 1)
+	c.cancel()
+}
+
+// response returns a copy of the shared response with its own body reader
+func (c *coalescedCall) response(req *http.Request) *http.Response {
+	resp := *c.resp
+	resp.Header = c.resp.Header.Clone()
+	resp.Trailer = c.resp.Trailer.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(c.body))
+	resp.ContentLength = int64(len(c.body))
+	resp.Request = req
+	return &resp
+}
+
+// detachedContext keeps the values of its parent but is never canceled
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
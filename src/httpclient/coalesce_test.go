@@ -0,0 +1,200 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Coalescing(t *testing.T) {
+	// the server blocks the requests until released and replies with the tenant header
+	var hits int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Header().Set("X-Tenant", r.Header.Get("X-Tenant"))
+		_, _ = w.Write([]byte("cached value " + r.Header.Get("X-Tenant")))
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().WithCoalescing("X-Tenant").Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+	type result struct {
+		body   string
+		tenant string
+		err    error
+	}
+	call := func(ctx context.Context, method HttpMethod, tenant string) result {
+		caller, _ := NewCallerBuilder(client, server.URL, "cache", method).
+			WithHeaders(map[string]string{"X-Tenant": tenant}).Build()
+		resp, err := caller.CallWithContext(ctx)
+		if err != nil {
+			return result{err: err}
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		body, err := io.ReadAll(resp.Body)
+		// changing the shared response doesn't affect the other waiters
+		tenant = resp.Header.Get("X-Tenant")
+		resp.Header.Set("X-Tenant", "changed")
+		return result{body: string(body), tenant: tenant, err: err}
+	}
+	waitFor := func(condition func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !condition() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("identical requests share one upstream call", func(t *testing.T) {
+		const waiters = 20
+		results := make(chan result, waiters+2)
+		var wg sync.WaitGroup
+		for i := 0; i < waiters; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results <- call(context.Background(), GET, "a")
+			}()
+		}
+		// a different header value and a POST are sent upstream
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			results <- call(context.Background(), GET, "b")
+		}()
+		go func() {
+			defer wg.Done()
+			results <- call(context.Background(), POST, "a")
+		}()
+		// a waiter giving up doesn't cancel the shared call
+		ctx, cancel := context.WithCancel(context.Background())
+		canceled := make(chan result, 1)
+		go func() {
+			canceled <- call(ctx, GET, "a")
+		}()
+
+		waitFor(func() bool {
+			return client.PoolStats().CoalescedRequests == waiters && atomic.LoadInt32(&hits) == 3
+		})
+		cancel()
+		assert.Error(t, (<-canceled).err)
+		close(release)
+		wg.Wait()
+		close(results)
+
+		counts := make(map[string]int)
+		for r := range results {
+			assert.NoError(t, r.err)
+			counts[r.body]++
+			assert.Equal(t, r.body, "cached value "+r.tenant)
+		}
+		assert.Equal(t, map[string]int{"cached value a": waiters + 1, "cached value b": 1}, counts)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+		assert.Equal(t, int64(3), client.PoolStats().TotalRequests)
+	})
+
+	t.Run("requests after the call completes are sent upstream", func(t *testing.T) {
+		before := atomic.LoadInt32(&hits)
+		assert.Equal(t, "cached value a", call(context.Background(), GET, "a").body)
+		assert.Equal(t, before+1, atomic.LoadInt32(&hits))
+	})
+
+	t.Run("the upstream call is canceled when all the waiters leave", func(t *testing.T) {
+		blocked := make(chan struct{})
+		canceled := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(blocked)
+			<-r.Context().Done()
+			close(canceled)
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-blocked
+			cancel()
+		}()
+		caller, _ := NewCallerBuilder(client, server.URL, "slow", GET).Build()
+		_, err := caller.CallWithContext(ctx)
+		assert.Error(t, err)
+		select {
+		case <-canceled:
+		case <-time.After(5 * time.Second):
+			t.Error("upstream call was not canceled")
+		}
+	})
+}
+
+func TestCoalescingTransport_Deadline(t *testing.T) {
+	// the upstream replies once released or fails with its context
+	release := make(chan struct{})
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		select {
+		case <-release:
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	})
+	roundTrip := func(transport *coalescingTransport, timeout time.Duration) error {
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/items", nil)
+		_, err := transport.RoundTrip(req)
+		return err
+	}
+
+	t.Run("bounded by the timeout without a deadline", func(t *testing.T) {
+		transport := newCoalescingTransport(next, nil, &poolStats{}, 50*time.Millisecond)
+		done := make(chan error, 1)
+		go func() {
+			done <- roundTrip(transport, 0)
+		}()
+		select {
+		case err := <-done:
+			assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the upstream call isn't bounded")
+		}
+	})
+
+	t.Run("extended to the latest deadline of the waiters", func(t *testing.T) {
+		transport := newCoalescingTransport(next, nil, &poolStats{}, 0)
+		first := make(chan error, 1)
+		go func() {
+			first <- roundTrip(transport, 200*time.Millisecond)
+		}()
+		assert.Eventually(t, func() bool {
+			transport.mutex.Lock()
+			defer transport.mutex.Unlock()
+			return len(transport.calls) == 1
+		}, time.Second, time.Millisecond)
+		second := make(chan error, 1)
+		go func() {
+			second <- roundTrip(transport, 5*time.Second)
+		}()
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt64(&transport.stats.coalescedRequests) == 1
+		}, time.Second, time.Millisecond)
+		assert.True(t, errors.Is(<-first, context.DeadlineExceeded))
+		close(release)
+		assert.NoError(t, <-second)
+	})
+}
@@ -0,0 +1,232 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedMediaType is returned when there is no codec registered for a media type
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Codec marshals request values and unmarshals response bodies for a single media type
+type Codec interface {
+	// MediaType returns the media type handled by the codec e.g. application/json
+	MediaType() string
+	// Marshal encodes v into the request body
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes the response body into v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// CodecRegistry holds the codecs keyed by media type
+type CodecRegistry struct {
+	codecs map[string]Codec
+	order  []string
+	mutex  *sync.RWMutex
+}
+
+// NewCodecRegistry creates a registry holding the given codecs
+func NewCodecRegistry(codecs ...Codec) *CodecRegistry {
+	r := &CodecRegistry{
+		codecs: make(map[string]Codec),
+		order:  make([]string, 0),
+		mutex:  new(sync.RWMutex),
+	}
+	for _, codec := range codecs {
+		r.Register(codec)
+	}
+	return r
+}
+
+// DefaultCodecs creates a registry with the JSON, XML, text and form codecs
+func DefaultCodecs() *CodecRegistry {
+	return NewCodecRegistry(JSONCodec, XMLCodec, TextCodec, FormCodec).
+		Register(XMLCodec, MediaTypeTextXML)
+}
+
+// Register adds the codec under its own media type and any extra media types,
+// replacing codecs which were registered before under the same media type
+func (r *CodecRegistry) Register(codec Codec, mediaTypes ...string) *CodecRegistry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, mediaType := range append([]string{codec.MediaType()}, mediaTypes...) {
+		mediaType = strings.ToLower(mediaType)
+		if _, ok := r.codecs[mediaType]; !ok {
+			r.order = append(r.order, mediaType)
+		}
+		r.codecs[mediaType] = codec
+	}
+	return r
+}
+
+// Lookup finds the codec for a Content-Type header value, parameters such as charset are ignored.
+// structured syntax suffixes e.g. application/problem+json fall back to the codec of the suffix
+func (r *CodecRegistry) Lookup(contentType string) (Codec, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedMediaType, contentType)
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if codec, ok := r.codecs[mediaType]; ok {
+		return codec, nil
+	}
+	if idx := strings.LastIndex(mediaType, "+"); idx != -1 {
+		if codec, ok := r.codecs["application/"+mediaType[idx+1:]]; ok {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedMediaType, mediaType)
+}
+
+// MediaTypes returns the registered media types in registration order
+func (r *CodecRegistry) MediaTypes() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	mediaTypes := make([]string, len(r.order))
+	copy(mediaTypes, r.order)
+	return mediaTypes
+}
+
+// acceptHeader builds the Accept header value, earlier media types get the higher quality
+func acceptHeader(mediaTypes []string) string {
+	values := make([]string, 0, len(mediaTypes))
+	for i, mediaType := range mediaTypes {
+		if i == 0 {
+			values = append(values, mediaType)
+			continue
+		}
+		q := 1.0 - float64(i)*0.1
+		if q < 0.1 {
+			q = 0.1
+		}
+		values = append(values, fmt.Sprintf("%s;q=%.1f", mediaType, q))
+	}
+	return strings.Join(values, ", ")
+}
+
+// JSONCodec encodes and decodes application/json bodies
+var JSONCodec Codec = jsonCodec{}
+
+// XMLCodec encodes and decodes application/xml bodies
+var XMLCodec Codec = xmlCodec{}
+
+// TextCodec encodes and decodes text/plain bodies from and into strings or byte slices
+var TextCodec Codec = textCodec{}
+
+// FormCodec encodes and decodes application/x-www-form-urlencoded bodies from and into url.Values
+// map[string]string or map[string][]string
+var FormCodec Codec = formCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) MediaType() string {
+	return MediaTypeJSON
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) MediaType() string {
+	return MediaTypeXML
+}
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+type textCodec struct{}
+
+func (textCodec) MediaType() string {
+	return MediaTypeText
+}
+
+func (textCodec) Marshal(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case string:
+		return []byte(value), nil
+	case []byte:
+		return value, nil
+	case fmt.Stringer:
+		return []byte(value.String()), nil
+	default:
+		return nil, fmt.Errorf("text codec can't marshal %T", v)
+	}
+}
+
+func (textCodec) Unmarshal(data []byte, v interface{}) error {
+	switch value := v.(type) {
+	case *string:
+		*value = string(data)
+	case *[]byte:
+		*value = append((*value)[:0], data...)
+	default:
+		return fmt.Errorf("text codec can't unmarshal into %T", v)
+	}
+	return nil
+}
+
+type formCodec struct{}
+
+func (formCodec) MediaType() string {
+	return MediaTypeForm
+}
+
+func (formCodec) Marshal(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case url.Values:
+		return []byte(value.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(value).Encode()), nil
+	case map[string]string:
+		values := make(url.Values, len(value))
+		for k, val := range value {
+			values.Set(k, val)
+		}
+		return []byte(values.Encode()), nil
+	default:
+		return nil, fmt.Errorf("form codec can't marshal %T", v)
+	}
+}
+
+func (formCodec) Unmarshal(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case *url.Values:
+		*value = values
+	case *map[string][]string:
+		*value = values
+	case *map[string]string:
+		*value = make(map[string]string, len(values))
+		for k := range values {
+			(*value)[k] = values.Get(k)
+		}
+	default:
+		return fmt.Errorf("form codec can't unmarshal into %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	XMLName xml.Name `json:"-" xml:"user"`
+	Name    string   `json:"name" xml:"name"`
+	Age     int      `json:"age" xml:"age"`
+}
+
+type upperCodec struct{}
+
+func (upperCodec) MediaType() string                     { return "application/x-upper" }
+func (upperCodec) Marshal(v interface{}) ([]byte, error) { return []byte("UPPER:" + v.(string)), nil }
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*string)) = string(data)
+	return nil
+}
+
+func TestCodecRegistry_Lookup(t *testing.T) {
+	registry := DefaultCodecs().Register(upperCodec{})
+
+	tt := []struct {
+		name         string
+		contentType  string
+		expected     string
+		expectsError bool
+	}{
+		{name: "json", contentType: "application/json", expected: MediaTypeJSON},
+		{name: "json with charset", contentType: "application/json; charset=utf-8", expected: MediaTypeJSON},
+		{name: "json suffix", contentType: "application/problem+json", expected: MediaTypeJSON},
+		{name: "text xml", contentType: "text/xml", expected: MediaTypeXML},
+		{name: "form", contentType: "application/x-www-form-urlencoded", expected: MediaTypeForm},
+		{name: "custom codec", contentType: "application/x-upper", expected: "application/x-upper"},
+		{name: "unknown media type", contentType: "application/msgpack", expectsError: true},
+		{name: "malformed media type", contentType: ";;", expectsError: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			codec, err := registry.Lookup(tc.contentType)
+			if tc.expectsError {
+				assert.True(t, errors.Is(err, ErrUnsupportedMediaType))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, codec.MediaType())
+		})
+	}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		data, err := TextCodec.Marshal("hello")
+		assert.NoError(t, err)
+		var out string
+		assert.NoError(t, TextCodec.Unmarshal(data, &out))
+		assert.Equal(t, "hello", out)
+		_, err = TextCodec.Marshal(1)
+		assert.Error(t, err)
+	})
+
+	t.Run("form", func(t *testing.T) {
+		data, err := FormCodec.Marshal(map[string]string{"a": "1", "b": "x y"})
+		assert.NoError(t, err)
+		assert.Equal(t, "a=1&b=x+y", string(data))
+		var out url.Values
+		assert.NoError(t, FormCodec.Unmarshal(data, &out))
+		assert.Equal(t, "x y", out.Get("b"))
+	})
+
+	t.Run("xml", func(t *testing.T) {
+		data, err := XMLCodec.Marshal(user{Name: "test", Age: 11})
+		assert.NoError(t, err)
+		var out user
+		assert.NoError(t, XMLCodec.Unmarshal(data, &out))
+		assert.Equal(t, "test", out.Name)
+	})
+}
+
+func TestCaller_CallAndDecode(t *testing.T) {
+	// echo the request body back using the Content-Type requested by the Accept header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		codecs := DefaultCodecs()
+		var u user
+		reqCodec, _ := codecs.Lookup(r.Header.Get("Content-Type"))
+		_ = reqCodec.Unmarshal(body, &u)
+		u.Age++
+
+		mediaType := strings.TrimSpace(strings.Split(strings.Split(r.Header.Get("Accept"), ",")[0], ";")[0])
+		respCodec, _ := codecs.Lookup(mediaType)
+		out, _ := respCodec.Marshal(u)
+		w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+		_, _ = w.Write(out)
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+	tt := []struct {
+		name        string
+		contentType string
+		accept      []string
+	}{
+		{name: "json to json", contentType: MediaTypeJSON, accept: []string{MediaTypeJSON}},
+		{name: "json to xml", contentType: MediaTypeJSON, accept: []string{MediaTypeXML, MediaTypeJSON}},
+		{name: "xml to json", contentType: MediaTypeXML, accept: []string{MediaTypeJSON}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			caller, err := NewCallerBuilder(client, server.URL, "users", POST).
+				WithBody(user{Name: "test", Age: 11}, tc.contentType).
+				WithAccept(tc.accept...).
+				Build()
+			assert.NoError(t, err)
+
+			var out user
+			resp, err := caller.CallAndDecode(context.Background(), &out)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, user{XMLName: out.XMLName, Name: "test", Age: 12}, out)
+		})
+	}
+
+	t.Run("unregistered body media type", func(t *testing.T) {
+		_, err := NewCallerBuilder(client, server.URL, "users", POST).
+			WithBody("value", "application/msgpack").
+			Build()
+		assert.True(t, errors.Is(err, ErrUnsupportedMediaType))
+	})
+
+	t.Run("unregistered accept media type", func(t *testing.T) {
+		_, err := NewCallerBuilder(client, server.URL, "users", POST).
+			WithAccept("application/msgpack").
+			Build()
+		assert.True(t, errors.Is(err, ErrUnsupportedMediaType))
+	})
+
+	t.Run("accept all registered media types", func(t *testing.T) {
+		caller, err := NewCallerBuilder(client, server.URL, "users", GET).WithAccept().Build()
+		assert.NoError(t, err)
+		assert.Equal(t, acceptHeader(config.codecs.MediaTypes()), caller.headers["Accept"])
+	})
+}
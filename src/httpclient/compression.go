@@ -0,0 +1,131 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrDecompressedTooLarge is returned while reading a compressed response body
+// which inflates beyond the configured max decompressed size
+var ErrDecompressedTooLarge = errors.New("decompressed response body exceeds the max size")
+
+// ContentEncoding is the compression applied to the request body
+type ContentEncoding string
+
+const (
+	// Gzip compress using gzip
+	Gzip ContentEncoding = "gzip"
+	// Deflate compress using zlib wrapped deflate
+	Deflate ContentEncoding = "deflate"
+)
+
+// compress encodes the body using the given content encoding
+func compress(encoding ContentEncoding, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Deflate:
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressResponse replaces the body of gzip or deflate encoded responses with a decoding reader.
+// Go's transport only decodes gzip transparently when it sets Accept-Encoding itself,
+// so responses to requests carrying a custom Accept-Encoding are decoded here.
+// maxSize limits the decoded body size, 0 means no limit
+func decompressResponse(resp *http.Response, maxSize int64) error {
+	if resp == nil || resp.Uncompressed || resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+
+	var reader io.Reader
+	switch encoding {
+	case string(Gzip), "x-gzip":
+		gr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			_ = resp.Body.Close()
+			return fmt.Errorf("unable to decode gzip response body: %w", err)
+		}
+		reader = gr
+	case string(Deflate):
+		reader = newDeflateReader(resp.Body)
+	default:
+		return nil
+	}
+	if maxSize > 0 {
+		reader = &maxSizeReader{reader: reader, remaining: maxSize, err: ErrDecompressedTooLarge}
+	}
+
+	resp.Body = &wrappedBody{Reader: reader, closer: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// newDeflateReader reads zlib wrapped deflate as the RFC says,
+// falling back to raw deflate which is what some servers send
+func newDeflateReader(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+		if zr, err := zlib.NewReader(br); err == nil {
+			return zr
+		}
+	}
+	return flate.NewReader(br)
+}
+
+// maxSizeReader fails with err once more than remaining bytes are read
+type maxSizeReader struct {
+	reader    io.Reader
+	remaining int64
+	err       error
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	if m.remaining < 0 {
+		return 0, m.err
+	}
+	// read one byte more than allowed to detect the overflow
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+	n, err := m.reader.Read(p)
+	m.remaining -= int64(n)
+	if m.remaining < 0 {
+		return n + int(m.remaining), m.err
+	}
+	return n, err
+}
+
+// wrappedBody reads from the wrapping reader and closes the original body
+type wrappedBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (w *wrappedBody) Close() error {
+	return w.closer.Close()
+}
@@ -0,0 +1,145 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaller_RequestCompression(t *testing.T) {
+	// reply with the decoded request body and its encoding
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reader io.Reader = r.Body
+		switch r.Header.Get("Content-Encoding") {
+		case "gzip":
+			reader, _ = gzip.NewReader(r.Body)
+		case "deflate":
+			reader, _ = zlib.NewReader(r.Body)
+		}
+		body, _ := io.ReadAll(reader)
+		w.Header().Set("X-Request-Encoding", r.Header.Get("Content-Encoding"))
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	payload := []byte(strings.Repeat("compress me ", 100))
+
+	tt := []struct {
+		name             string
+		encoding         ContentEncoding
+		threshold        int
+		body             []byte
+		expectedEncoding string
+	}{
+		{name: "gzip above threshold", encoding: Gzip, threshold: 100, body: payload, expectedEncoding: "gzip"},
+		{name: "deflate above threshold", encoding: Deflate, threshold: 100, body: payload, expectedEncoding: "deflate"},
+		{name: "below threshold", encoding: Gzip, threshold: 10000, body: payload, expectedEncoding: ""},
+		{name: "compression disabled", encoding: "", threshold: 0, body: payload, expectedEncoding: ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := NewConfig().WithRequestCompression(tc.encoding, tc.threshold).Build()
+			assert.NoError(t, err)
+			client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+			caller, _ := NewCallerBuilder(client, server.URL, "echo", POST).WithRequestBody(tc.body).Build()
+
+			resp, err := caller.Call()
+			assert.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tc.body, body)
+			assert.Equal(t, tc.expectedEncoding, resp.Header.Get("X-Request-Encoding"))
+		})
+	}
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		_, err := NewConfig().WithRequestCompression("br", 0).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestCaller_ResponseDecompression(t *testing.T) {
+	payload := []byte(strings.Repeat("a", 10000))
+
+	encode := func(encoding string) []byte {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch encoding {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		case "raw-deflate":
+			w, _ = flate.NewWriter(&buf, flate.BestCompression)
+		}
+		_, _ = w.Write(payload)
+		_ = w.Close()
+		return buf.Bytes()
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.TrimPrefix(r.URL.Path, "/")
+		body := encode(encoding)
+		if encoding == "raw-deflate" {
+			encoding = "deflate"
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	tt := []struct {
+		name           string
+		route          string
+		acceptEncoding string
+		maxSize        int64
+		expectsError   bool
+	}{
+		{name: "custom accept encoding gzip", route: "gzip", acceptEncoding: "gzip"},
+		{name: "custom accept encoding deflate", route: "deflate", acceptEncoding: "deflate"},
+		{name: "raw deflate", route: "raw-deflate", acceptEncoding: "deflate"},
+		{name: "within max size", route: "gzip", maxSize: 10000},
+		{name: "decompression bomb", route: "gzip", maxSize: 1000, expectsError: true},
+		{name: "decompression bomb custom accept encoding", route: "deflate",
+			acceptEncoding: "deflate", maxSize: 1000, expectsError: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			config, _ := NewConfig().WithMaxDecompressedSize(tc.maxSize).Build()
+			client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+			headers := map[string]string{}
+			if tc.acceptEncoding != "" {
+				headers["Accept-Encoding"] = tc.acceptEncoding
+			}
+			caller, _ := NewCallerBuilder(client, server.URL, tc.route, GET).WithHeaders(headers).Build()
+
+			resp, err := caller.Call()
+			assert.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			body, err := io.ReadAll(resp.Body)
+			if tc.expectsError {
+				assert.True(t, errors.Is(err, ErrDecompressedTooLarge))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, payload, body)
+			assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+		})
+	}
+}
@@ -1,9 +1,16 @@
 package httpclient
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"time"
+
+	"github.com/sghaida/go-stuff/src/eventloop"
 )
 
 // Config holds the HttpCaller config
@@ -12,6 +19,25 @@ type Config struct {
 	numOfRetries   int
 	jsonSchema     json.RawMessage
 	defaultHeaders map[string]string
+	codecs         *CodecRegistry
+
+	requestEncoding      ContentEncoding
+	compressionThreshold int
+	maxDecompressedSize  int64
+	maxResponseSize      int64
+
+	tls       tlsOptions
+	transport transportOptions
+
+	redirectPolicy *RedirectPolicy
+	cookieJar      http.CookieJar
+
+	coalesce        bool
+	coalesceHeaders []string
+	bulkhead        *Bulkhead
+	limiter         *AdaptiveLimiter
+	faults          *FaultInjector
+	eventLoop       *eventloop.Queue
 }
 
 func newConfig(c *ConfigBuilder) *Config {
@@ -25,6 +51,25 @@ type ConfigBuilder struct {
 	numOfRetries   int
 	jsonSchema     json.RawMessage
 	defaultHeaders map[string]string
+	codecs         *CodecRegistry
+
+	requestEncoding      ContentEncoding
+	compressionThreshold int
+	maxDecompressedSize  int64
+	maxResponseSize      int64
+
+	tls       tlsOptions
+	transport transportOptions
+
+	redirectPolicy *RedirectPolicy
+	cookieJar      http.CookieJar
+
+	coalesce        bool
+	coalesceHeaders []string
+	bulkhead        *Bulkhead
+	limiter         *AdaptiveLimiter
+	faults          *FaultInjector
+	eventLoop       *eventloop.Queue
 }
 
 // Build builds HttpCaller Config
@@ -36,12 +81,38 @@ func (c *ConfigBuilder) Build() (*Config, error) {
 		return nil, errors.New("timeout can't be negative")
 	}
 
+	if c.requestEncoding != "" && c.requestEncoding != Gzip && c.requestEncoding != Deflate {
+		return nil, fmt.Errorf("unsupported request content encoding %q", c.requestEncoding)
+	}
+	if c.compressionThreshold < 0 {
+		return nil, errors.New("compression threshold can't be negative")
+	}
+	if c.maxDecompressedSize < 0 {
+		return nil, errors.New("max decompressed size can't be negative")
+	}
+	if c.maxResponseSize < 0 {
+		return nil, errors.New("max response size can't be negative")
+	}
+
+	if err := c.tls.validate(); err != nil {
+		return nil, err
+	}
+	if err := c.transport.validate(); err != nil {
+		return nil, err
+	}
+
 	if c.defaultHeaders == nil {
 		c.defaultHeaders = make(map[string]string)
 	}
 	if c.jsonSchema == nil {
 		c.jsonSchema = json.RawMessage("{}")
 	}
+	if c.codecs == nil {
+		c.codecs = DefaultCodecs()
+	}
+	if c.redirectPolicy == nil {
+		c.redirectPolicy, _ = NewRedirectPolicy().Build()
+	}
 
 	conf := newConfig(c)
 	return conf, nil
@@ -75,3 +146,213 @@ func (c *ConfigBuilder) WithHeaders(headers map[string]string) *ConfigBuilder {
 	c.defaultHeaders = headers
 	return c
 }
+
+// WithCodecs set the codecs used to marshal request values and unmarshal responses
+func (c *ConfigBuilder) WithCodecs(codecs *CodecRegistry) *ConfigBuilder {
+	c.codecs = codecs
+	return c
+}
+
+// WithRequestCompression compress request bodies of at least minSize bytes using the given encoding
+func (c *ConfigBuilder) WithRequestCompression(encoding ContentEncoding, minSize int) *ConfigBuilder {
+	c.requestEncoding = encoding
+	c.compressionThreshold = minSize
+	return c
+}
+
+// WithMaxDecompressedSize limit the size of decompressed response bodies, reading beyond it fails with
+// ErrDecompressedTooLarge. unless Accept-Encoding is set on the request, gzip and deflate are requested
+// so that the limit also covers the responses which Go's transport would otherwise decode itself
+func (c *ConfigBuilder) WithMaxDecompressedSize(maxSize int64) *ConfigBuilder {
+	c.maxDecompressedSize = maxSize
+	return c
+}
+
+// WithMaxResponseSize limit the size of response bodies, the calls fail with ErrResponseTooLarge when the
+// Content-Length is over it, reading beyond it fails with ErrResponseTooLarge otherwise. the limit applies
+// to the decompressed bodies
+func (c *ConfigBuilder) WithMaxResponseSize(maxSize int64) *ConfigBuilder {
+	c.maxResponseSize = maxSize
+	return c
+}
+
+// WithMaxResponseHeaderSize limit the size of the response headers, the calls fail with ErrResponseHeadersTooLarge
+// beyond it. Go's transport allows 1MB by default
+func (c *ConfigBuilder) WithMaxResponseHeaderSize(maxSize int64) *ConfigBuilder {
+	c.transport.maxResponseHeaderBytes = maxSize
+	return c
+}
+
+// WithCACertFiles trust the CA certificates in the given PEM files instead of the system roots
+func (c *ConfigBuilder) WithCACertFiles(files ...string) *ConfigBuilder {
+	c.tls.caFiles = append(c.tls.caFiles, files...)
+	return c
+}
+
+// WithClientCertFile present the client certificate in the given PEM files for mTLS
+func (c *ConfigBuilder) WithClientCertFile(certFile, keyFile string) *ConfigBuilder {
+	c.tls.certFile = certFile
+	c.tls.keyFile = keyFile
+	return c
+}
+
+// WithMinTLSVersion set the minimum TLS version e.g. tls.VersionTLS13, defaults to TLS 1.2
+func (c *ConfigBuilder) WithMinTLSVersion(version uint16) *ConfigBuilder {
+	c.tls.minVersion = version
+	return c
+}
+
+// WithCipherSuites restrict the TLS 1.2 cipher suites
+func (c *ConfigBuilder) WithCipherSuites(suites ...uint16) *ConfigBuilder {
+	c.tls.cipherSuites = suites
+	return c
+}
+
+// WithServerName override the server name used for SNI and certificate verification
+func (c *ConfigBuilder) WithServerName(serverName string) *ConfigBuilder {
+	c.tls.serverName = serverName
+	return c
+}
+
+// WithPinnedPublicKeys only accept server certificate chains containing one of the public keys,
+// pins are the base64 sha256 hashes of the SPKI optionally prefixed by sha256/ see SPKIHash
+func (c *ConfigBuilder) WithPinnedPublicKeys(pins ...string) *ConfigBuilder {
+	c.tls.pins = append(c.tls.pins, pins...)
+	return c
+}
+
+// WithCertReloadInterval check the CA and client certificate files for changes at most once per interval
+// and reload them when they are rotated on disk
+func (c *ConfigBuilder) WithCertReloadInterval(interval time.Duration) *ConfigBuilder {
+	c.tls.reloadInterval = interval
+	return c
+}
+
+// WithMaxIdleConns set the max number of idle connections across all hosts, defaults to 100
+func (c *ConfigBuilder) WithMaxIdleConns(n int) *ConfigBuilder {
+	c.transport.maxIdleConns = n
+	return c
+}
+
+// WithMaxConnsPerHost set the max number of connections per host, defaults to 100
+func (c *ConfigBuilder) WithMaxConnsPerHost(n int) *ConfigBuilder {
+	c.transport.maxConnsPerHost = n
+	return c
+}
+
+// WithMaxIdleConnsPerHost set the max number of idle connections per host, defaults to 100
+func (c *ConfigBuilder) WithMaxIdleConnsPerHost(n int) *ConfigBuilder {
+	c.transport.maxIdleConnsPerHost = n
+	return c
+}
+
+// WithIdleConnTimeout set how long idle connections are kept in the pool
+func (c *ConfigBuilder) WithIdleConnTimeout(timeout time.Duration) *ConfigBuilder {
+	c.transport.idleConnTimeout = timeout
+	return c
+}
+
+// WithDialTimeout set the timeout of establishing new connections
+func (c *ConfigBuilder) WithDialTimeout(timeout time.Duration) *ConfigBuilder {
+	c.transport.dialTimeout = timeout
+	return c
+}
+
+// WithTLSHandshakeTimeout set the timeout of the TLS handshake
+func (c *ConfigBuilder) WithTLSHandshakeTimeout(timeout time.Duration) *ConfigBuilder {
+	c.transport.tlsHandshakeTimeout = timeout
+	return c
+}
+
+// WithKeepAlive set the TCP keep-alive period, a negative period disables keep-alive
+func (c *ConfigBuilder) WithKeepAlive(period time.Duration) *ConfigBuilder {
+	c.transport.keepAlive = period
+	return c
+}
+
+// WithHTTP2 enable or disable HTTP/2 over TLS, enabled by default
+func (c *ConfigBuilder) WithHTTP2(enabled bool) *ConfigBuilder {
+	c.transport.disableHTTP2 = !enabled
+	return c
+}
+
+// WithH2C send http:// requests using HTTP/2 over clear text with prior knowledge
+func (c *ConfigBuilder) WithH2C(enabled bool) *ConfigBuilder {
+	c.transport.h2c = enabled
+	return c
+}
+
+// WithProxyURL send all the requests through the given proxy, see WithProxy for per host proxies
+// no proxy rules and proxy auth
+func (c *ConfigBuilder) WithProxyURL(proxyURL *url.URL) *ConfigBuilder {
+	c.transport.proxyURL = proxyURL
+	return c
+}
+
+// WithDialer dial the connections using the given function instead of a net.Dialer,
+// the dial timeout and keep-alive settings are ignored. e.g. to connect over net.Pipe in tests
+func (c *ConfigBuilder) WithDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) *ConfigBuilder {
+	c.transport.dialer = dial
+	return c
+}
+
+// WithUnixSocket send all the requests over the unix socket at path whatever the request host is,
+// to target a socket per caller use a unix:///path/to/socket host instead
+func (c *ConfigBuilder) WithUnixSocket(path string) *ConfigBuilder {
+	c.transport.unixSocket = path
+	return c
+}
+
+// WithProxy select the proxy of each request using the given Proxy instead of the environment variables
+func (c *ConfigBuilder) WithProxy(proxy *Proxy) *ConfigBuilder {
+	c.transport.proxy = proxy
+	return c
+}
+
+// WithRedirectPolicy set how redirects are followed, see NewRedirectPolicy for the defaults
+func (c *ConfigBuilder) WithRedirectPolicy(policy *RedirectPolicy) *ConfigBuilder {
+	c.redirectPolicy = policy
+	return c
+}
+
+// WithCookieJar store the cookies of the responses and send them with the requests, see NewCookieJar
+func (c *ConfigBuilder) WithCookieJar(jar http.CookieJar) *ConfigBuilder {
+	c.cookieJar = jar
+	return c
+}
+
+// WithCoalescing collapse concurrent identical GET and HEAD requests into one upstream call whose buffered
+// response is shared by all of them. requests are identical if they have the same url and the same values
+// of the given headers and of the Authorization, Cookie, Accept, Accept-Encoding, Range and auth headers
+func (c *ConfigBuilder) WithCoalescing(headers ...string) *ConfigBuilder {
+	c.coalesce = true
+	c.coalesceHeaders = headers
+	return c
+}
+
+// WithBulkhead limit the concurrent in flight requests per host or group of hosts, see NewBulkhead
+func (c *ConfigBuilder) WithBulkhead(bulkhead *Bulkhead) *ConfigBuilder {
+	c.bulkhead = bulkhead
+	return c
+}
+
+// WithAdaptiveLimiter limit the concurrent requests per host using a limit adjusted from the latency
+// and the errors, see NewAdaptiveLimiter
+func (c *ConfigBuilder) WithAdaptiveLimiter(limiter *AdaptiveLimiter) *ConfigBuilder {
+	c.limiter = limiter
+	return c
+}
+
+// WithFaultInjector inject the faults of the injector into the requests to test the resilience
+// of the callers, see NewFaultInjector
+func (c *ConfigBuilder) WithFaultInjector(faults *FaultInjector) *ConfigBuilder {
+	c.faults = faults
+	return c
+}
+
+// WithEventLoop run the async calls through the started event loop queue instead of their own goroutines,
+// the queue executes one event at a time so the calls share its scheduling with the other events
+func (c *ConfigBuilder) WithEventLoop(queue *eventloop.Queue) *ConfigBuilder {
+	c.eventLoop = queue
+	return c
+}
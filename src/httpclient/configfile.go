@@ -0,0 +1,439 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables overriding the config files
+// e.g. HTTPCLIENT_PAYMENTS_TIMEOUT overrides the timeout of the payments client
+const DefaultEnvPrefix = "HTTPCLIENT"
+
+// ConfigFile is a JSON or YAML file of named client configs
+type ConfigFile struct {
+	Clients map[string]*ClientFileConfig `yaml:"clients"`
+}
+
+// ClientFileConfig is the config of a named client, durations are strings such as 5s or 1m30s
+type ClientFileConfig struct {
+	BaseURL string `yaml:"baseURL"`
+	Timeout string `yaml:"timeout"`
+	// Retries is the number of retries after the first attempt, 0 or omitted means a single attempt
+	Retries int               `yaml:"retries"`
+	Headers map[string]string `yaml:"headers"`
+	Auth    AuthFileConfig    `yaml:"auth"`
+	TLS     TLSFileConfig     `yaml:"tls"`
+	Pool    PoolFileConfig    `yaml:"pool"`
+	// MaxResponseSize and MaxResponseHeaderSize are in bytes, 0 keeps the defaults
+	MaxResponseSize       int64 `yaml:"maxResponseSize"`
+	MaxResponseHeaderSize int64 `yaml:"maxResponseHeaderSize"`
+}
+
+// AuthFileConfig is the auth of a client, the secrets are references to an environment
+// variable env:NAME or to a file file:PATH so that they are never written in the config files
+type AuthFileConfig struct {
+	// Type is one of none, basic, jwt and apikey
+	Type     string `yaml:"type"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+	Key      string `yaml:"key"`
+}
+
+// TLSFileConfig is the TLS config of a client
+type TLSFileConfig struct {
+	CAFiles  []string `yaml:"caFiles"`
+	CertFile string   `yaml:"certFile"`
+	KeyFile  string   `yaml:"keyFile"`
+	// MinVersion is one of 1.0, 1.1, 1.2 and 1.3
+	MinVersion string `yaml:"minVersion"`
+	// CipherSuites are the names of the cipher suites e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	CipherSuites     []string `yaml:"cipherSuites"`
+	ServerName       string   `yaml:"serverName"`
+	PinnedPublicKeys []string `yaml:"pinnedPublicKeys"`
+	ReloadInterval   string   `yaml:"reloadInterval"`
+}
+
+// PoolFileConfig is the connection pool config of a client
+type PoolFileConfig struct {
+	MaxIdleConns        int    `yaml:"maxIdleConns"`
+	MaxIdleConnsPerHost int    `yaml:"maxIdleConnsPerHost"`
+	MaxConnsPerHost     int    `yaml:"maxConnsPerHost"`
+	IdleConnTimeout     string `yaml:"idleConnTimeout"`
+	DialTimeout         string `yaml:"dialTimeout"`
+	TLSHandshakeTimeout string `yaml:"tlsHandshakeTimeout"`
+	KeepAlive           string `yaml:"keepAlive"`
+	HTTP2               *bool  `yaml:"http2"`
+}
+
+// ConfigError is a config value which is invalid, Key is the path of the value in the config file
+// e.g. clients.payments.timeout or the environment variable which overrides it
+type ConfigError struct {
+	Key string
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Key, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrors are all the invalid values of a config file
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return "invalid config: " + strings.Join(messages, "; ")
+}
+
+// tlsVersions are the TLS versions by name
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// LoadConfigFile reads a JSON or YAML config file, unknown keys are rejected
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+	var file ConfigFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// applyEnv overrides the scalar and list values of the clients using the environment variables
+// named after the prefix, the client name and the key path e.g. HTTPCLIENT_PAYMENTS_TLS_SERVER_NAME,
+// lists are comma separated
+func (f *ConfigFile) applyEnv(prefix string, lookupEnv func(string) (string, bool)) error {
+	var errs ConfigErrors
+	for name, client := range f.Clients {
+		if client == nil {
+			continue
+		}
+		envPrefix := prefix + "_" + envName(name)
+		errs = append(errs, overrideFromEnv(reflect.ValueOf(client).Elem(), envPrefix, lookupEnv)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// overrideFromEnv sets the fields of the struct from the environment variables, recursively
+func overrideFromEnv(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) ConfigErrors {
+	var errs ConfigErrors
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		key := prefix + "_" + envName(strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0])
+		if field.Kind() == reflect.Struct {
+			errs = append(errs, overrideFromEnv(field, key, lookupEnv)...)
+			continue
+		}
+		value, ok := lookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setFromString(field, value); err != nil {
+			errs = append(errs, &ConfigError{Key: key, Err: err})
+		}
+	}
+	return errs
+}
+
+// setFromString parses the value into the field
+func setFromString(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(n)
+	case reflect.Ptr:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.Set(reflect.ValueOf(&b))
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return errors.New("can't be set from the environment")
+	}
+	return nil
+}
+
+// envName converts a key to an environment variable name e.g. baseURL to BASE_URL
+func envName(key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			b.WriteRune('_')
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// configBuilder validates the client config and returns its ConfigBuilder and auth,
+// the errors point at the keys of the client prefixed by key
+func (c *ClientFileConfig) configBuilder(key string, lookupEnv func(string) (string, bool)) (*ConfigBuilder, cauth.IAuth, error) {
+	var errs ConfigErrors
+	invalid := func(subKey string, err error) {
+		errs = append(errs, &ConfigError{Key: key + "." + subKey, Err: err})
+	}
+	duration := func(subKey, value string) time.Duration {
+		if value == "" {
+			return 0
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			invalid(subKey, fmt.Errorf("invalid duration %q", value))
+			return 0
+		}
+		if d < 0 {
+			invalid(subKey, errors.New("can't be negative"))
+		}
+		return d
+	}
+	notNegative := func(subKey string, n int64) {
+		if n < 0 {
+			invalid(subKey, errors.New("can't be negative"))
+		}
+	}
+
+	builder := NewConfig().WithHeaders(c.Headers)
+	if c.BaseURL == "" {
+		invalid("baseURL", errors.New("is required"))
+	} else if _, _, err := parseHost(c.BaseURL); err != nil {
+		invalid("baseURL", err)
+	}
+	builder.WithTimeout(duration("timeout", c.Timeout))
+	notNegative("retries", int64(c.Retries))
+	// WithRetry takes the number of attempts
+	builder.WithRetry(c.Retries + 1)
+	notNegative("maxResponseSize", c.MaxResponseSize)
+	builder.WithMaxResponseSize(c.MaxResponseSize)
+	notNegative("maxResponseHeaderSize", c.MaxResponseHeaderSize)
+	builder.WithMaxResponseHeaderSize(c.MaxResponseHeaderSize)
+
+	auth, err := c.Auth.auth(lookupEnv)
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		invalid("auth."+configErr.Key, configErr.Err)
+	}
+
+	t := c.TLS
+	// the files are loaded here so that the errors point at them
+	if len(t.CAFiles) > 0 {
+		pool := x509.NewCertPool()
+		for i, file := range t.CAFiles {
+			if err := appendCAFile(pool, file); err != nil {
+				invalid(fmt.Sprintf("tls.caFiles[%d]", i), err)
+			}
+		}
+		builder.WithCACertFiles(t.CAFiles...)
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		invalid("tls.keyFile", errors.New("certFile and keyFile must be set together"))
+	} else if t.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			invalid("tls.certFile", fmt.Errorf("unable to load client certificate: %w", err))
+		}
+		builder.WithClientCertFile(t.CertFile, t.KeyFile)
+	}
+	if t.MinVersion != "" {
+		version, ok := tlsVersions[t.MinVersion]
+		if !ok {
+			invalid("tls.minVersion", fmt.Errorf("unsupported version %q, expected 1.0, 1.1, 1.2 or 1.3", t.MinVersion))
+		}
+		builder.WithMinTLSVersion(version)
+	}
+	if len(t.CipherSuites) > 0 {
+		suites := make([]uint16, 0, len(t.CipherSuites))
+		for i, name := range t.CipherSuites {
+			id, ok := cipherSuiteID(name)
+			if !ok {
+				invalid(fmt.Sprintf("tls.cipherSuites[%d]", i), fmt.Errorf("unknown cipher suite %q", name))
+			}
+			suites = append(suites, id)
+		}
+		builder.WithCipherSuites(suites...)
+	}
+	if t.ServerName != "" {
+		builder.WithServerName(t.ServerName)
+	}
+	if len(t.PinnedPublicKeys) > 0 {
+		builder.WithPinnedPublicKeys(t.PinnedPublicKeys...)
+	}
+	if interval := duration("tls.reloadInterval", t.ReloadInterval); interval > 0 {
+		builder.WithCertReloadInterval(interval)
+	}
+
+	p := c.Pool
+	notNegative("pool.maxIdleConns", int64(p.MaxIdleConns))
+	notNegative("pool.maxIdleConnsPerHost", int64(p.MaxIdleConnsPerHost))
+	notNegative("pool.maxConnsPerHost", int64(p.MaxConnsPerHost))
+	if p.MaxIdleConns > 0 {
+		builder.WithMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.MaxIdleConnsPerHost > 0 {
+		builder.WithMaxIdleConnsPerHost(p.MaxIdleConnsPerHost)
+	}
+	if p.MaxConnsPerHost > 0 {
+		builder.WithMaxConnsPerHost(p.MaxConnsPerHost)
+	}
+	if d := duration("pool.idleConnTimeout", p.IdleConnTimeout); d > 0 {
+		builder.WithIdleConnTimeout(d)
+	}
+	if d := duration("pool.dialTimeout", p.DialTimeout); d > 0 {
+		builder.WithDialTimeout(d)
+	}
+	if d := duration("pool.tlsHandshakeTimeout", p.TLSHandshakeTimeout); d > 0 {
+		builder.WithTLSHandshakeTimeout(d)
+	}
+	if d := duration("pool.keepAlive", p.KeepAlive); d > 0 {
+		builder.WithKeepAlive(d)
+	}
+	if p.HTTP2 != nil {
+		builder.WithHTTP2(*p.HTTP2)
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return builder, auth, nil
+}
+
+// auth returns the auth of the config resolving the secret references,
+// the errors are *ConfigError pointing at the auth keys
+func (a AuthFileConfig) auth(lookupEnv func(string) (string, bool)) (cauth.IAuth, error) {
+	// the secrets which are used by each type
+	used := map[string]bool{}
+	switch cauth.AuthType(a.Type) {
+	case "", cauth.None:
+	case cauth.AuthBasic:
+		used["username"], used["password"] = true, true
+	case cauth.AuthJwt:
+		used["token"] = true
+	case cauth.AuthApiKey:
+		used["key"] = true
+	default:
+		return nil, &ConfigError{Key: "type", Err: fmt.Errorf("unsupported auth type %q, expected none, basic, jwt or apikey", a.Type)}
+	}
+
+	values := map[string]string{"username": a.Username, "password": a.Password, "token": a.Token, "key": a.Key}
+	for _, key := range []string{"username", "password", "token", "key"} {
+		if values[key] == "" && used[key] {
+			return nil, &ConfigError{Key: key, Err: fmt.Errorf("is required by %s auth", a.Type)}
+		}
+		if values[key] != "" && !used[key] {
+			return nil, &ConfigError{Key: key, Err: fmt.Errorf("is not used by %s auth", a.Type)}
+		}
+	}
+
+	resolve := func(key string) (string, error) {
+		secret, err := resolveSecret(values[key], lookupEnv)
+		if err != nil {
+			return "", &ConfigError{Key: key, Err: err}
+		}
+		return secret, nil
+	}
+	switch cauth.AuthType(a.Type) {
+	case cauth.AuthBasic:
+		password, err := resolve("password")
+		if err != nil {
+			return nil, err
+		}
+		return cauth.NewBasicAuth(a.Username, password), nil
+	case cauth.AuthJwt:
+		token, err := resolve("token")
+		if err != nil {
+			return nil, err
+		}
+		return cauth.NewJWTAuth(token), nil
+	case cauth.AuthApiKey:
+		key, err := resolve("key")
+		if err != nil {
+			return nil, err
+		}
+		return cauth.NewAPIKey(key), nil
+	}
+	return cauth.NoAuth, nil
+}
+
+// resolveSecret returns the secret of a reference env:NAME or file:PATH
+func resolveSecret(ref string, lookupEnv func(string) (string, bool)) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		secret, ok := lookupEnv(name)
+		if !ok || secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret file: %w", err)
+		}
+		secret := strings.TrimSpace(string(data))
+		if secret == "" {
+			return "", errors.New("secret file is empty")
+		}
+		return secret, nil
+	}
+	return "", errors.New("must be a reference env:NAME or file:PATH")
+}
+
+// cipherSuiteID returns the id of a cipher suite by name
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			if suite.Name == name {
+				return suite.ID, true
+			}
+		}
+	}
+	return 0, false
+}
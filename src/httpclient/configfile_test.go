@@ -0,0 +1,355 @@
+package httpclient
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfigFile writes a config file in a temporary directory and returns its path
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// mapEnv looks up the environment variables in a map
+func mapEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+// configErrorKeys returns the keys of the ConfigErrors of err
+func configErrorKeys(err error) []string {
+	var errs ConfigErrors
+	if errors.As(err, &errs) {
+		keys := make([]string, 0, len(errs))
+		for _, e := range errs {
+			keys = append(keys, e.Key)
+		}
+		return keys
+	}
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return []string{configErr.Key}
+	}
+	return nil
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			file: "clients.yaml",
+			content: `
+clients:
+  payments:
+    baseURL: https://payments.example.com
+    timeout: 5s
+    retries: 3
+    headers:
+      X-Team: billing
+    auth:
+      type: jwt
+      token: env:PAYMENTS_TOKEN
+    pool:
+      maxIdleConnsPerHost: 20
+      http2: true
+`,
+		},
+		{
+			name: "json",
+			file: "clients.json",
+			content: `{"clients": {"payments": {"baseURL": "https://payments.example.com", "timeout": "5s", "retries": 3,
+				"headers": {"X-Team": "billing"}, "auth": {"type": "jwt", "token": "env:PAYMENTS_TOKEN"},
+				"pool": {"maxIdleConnsPerHost": 20, "http2": true}}}}`,
+		},
+		{
+			name:    "unknown key",
+			file:    "clients.yaml",
+			content: "clients:\n  payments:\n    baseURL: https://payments.example.com\n    timeuot: 5s\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid type",
+			file:    "clients.yaml",
+			content: "clients:\n  payments:\n    retries: many\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := LoadConfigFile(writeConfigFile(t, tt.file, tt.content))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			payments := file.Clients["payments"]
+			if assert.NotNil(t, payments) {
+				assert.Equal(t, "https://payments.example.com", payments.BaseURL)
+				assert.Equal(t, "5s", payments.Timeout)
+				assert.Equal(t, 3, payments.Retries)
+				assert.Equal(t, map[string]string{"X-Team": "billing"}, payments.Headers)
+				assert.Equal(t, AuthFileConfig{Type: "jwt", Token: "env:PAYMENTS_TOKEN"}, payments.Auth)
+				assert.Equal(t, 20, payments.Pool.MaxIdleConnsPerHost)
+				if assert.NotNil(t, payments.Pool.HTTP2) {
+					assert.True(t, *payments.Pool.HTTP2)
+				}
+			}
+		})
+	}
+
+	_, err := LoadConfigFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestConfigFile_applyEnv(t *testing.T) {
+	file := &ConfigFile{Clients: map[string]*ClientFileConfig{
+		"payments-api": {BaseURL: "https://payments.example.com", Timeout: "5s"},
+	}}
+	err := file.applyEnv("HTTPCLIENT", mapEnv(map[string]string{
+		"HTTPCLIENT_PAYMENTS_API_BASE_URL":          "https://staging.example.com",
+		"HTTPCLIENT_PAYMENTS_API_RETRIES":           "4",
+		"HTTPCLIENT_PAYMENTS_API_MAX_RESPONSE_SIZE": "1048576",
+		"HTTPCLIENT_PAYMENTS_API_TLS_CA_FILES":      "a.pem, b.pem",
+		"HTTPCLIENT_PAYMENTS_API_TLS_SERVER_NAME":   "payments.internal",
+		"HTTPCLIENT_PAYMENTS_API_POOL_HTTP2":        "false",
+		"HTTPCLIENT_PAYMENTS_API_AUTH_TYPE":         "apikey",
+		"HTTPCLIENT_PAYMENTS_API_AUTH_KEY":          "env:PAYMENTS_KEY",
+		"HTTPCLIENT_OTHER_TIMEOUT":                  "1s",
+		"HTTPCLIENT_PAYMENTS_API_POOL_MAX_IDLE_CON": "ignored",
+	}))
+	assert.NoError(t, err)
+	payments := file.Clients["payments-api"]
+	assert.Equal(t, "https://staging.example.com", payments.BaseURL)
+	assert.Equal(t, "5s", payments.Timeout)
+	assert.Equal(t, 4, payments.Retries)
+	assert.Equal(t, int64(1<<20), payments.MaxResponseSize)
+	assert.Equal(t, []string{"a.pem", "b.pem"}, payments.TLS.CAFiles)
+	assert.Equal(t, "payments.internal", payments.TLS.ServerName)
+	if assert.NotNil(t, payments.Pool.HTTP2) {
+		assert.False(t, *payments.Pool.HTTP2)
+	}
+	assert.Equal(t, AuthFileConfig{Type: "apikey", Key: "env:PAYMENTS_KEY"}, payments.Auth)
+
+	err = file.applyEnv("HTTPCLIENT", mapEnv(map[string]string{
+		"HTTPCLIENT_PAYMENTS_API_RETRIES":    "many",
+		"HTTPCLIENT_PAYMENTS_API_POOL_HTTP2": "maybe",
+		"HTTPCLIENT_PAYMENTS_API_HEADERS":    "X-Team=billing",
+	}))
+	assert.ElementsMatch(t, []string{
+		"HTTPCLIENT_PAYMENTS_API_RETRIES",
+		"HTTPCLIENT_PAYMENTS_API_POOL_HTTP2",
+		"HTTPCLIENT_PAYMENTS_API_HEADERS",
+	}, configErrorKeys(err))
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "payments", want: "PAYMENTS"},
+		{key: "baseURL", want: "BASE_URL"},
+		{key: "caFiles", want: "CA_FILES"},
+		{key: "maxIdleConnsPerHost", want: "MAX_IDLE_CONNS_PER_HOST"},
+		{key: "http2", want: "HTTP2"},
+		{key: "payments-api.v2", want: "PAYMENTS_API_V2"},
+		{key: "HTTPServer", want: "HTTP_SERVER"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, envName(tt.key))
+		})
+	}
+}
+
+func TestClientFileConfig_configBuilder(t *testing.T) {
+	secretFile := writeConfigFile(t, "password", "s3cret\n")
+	env := mapEnv(map[string]string{"TOKEN": "t0ken", "EMPTY": ""})
+
+	tests := []struct {
+		name     string
+		config   ClientFileConfig
+		wantKeys []string
+		wantAuth cauth.IAuth
+	}{
+		{
+			name: "valid",
+			config: ClientFileConfig{
+				BaseURL: "https://payments.example.com",
+				Timeout: "2s",
+				Retries: 2,
+				Auth:    AuthFileConfig{Type: "jwt", Token: "env:TOKEN"},
+				TLS:     TLSFileConfig{MinVersion: "1.2", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}},
+				Pool:    PoolFileConfig{MaxConnsPerHost: 10, DialTimeout: "1s"},
+			},
+			wantAuth: cauth.NewJWTAuth("t0ken"),
+		},
+		{
+			name: "secret file",
+			config: ClientFileConfig{
+				BaseURL: "https://payments.example.com",
+				Auth:    AuthFileConfig{Type: "basic", Username: "billing", Password: "file:" + secretFile},
+			},
+			wantAuth: cauth.NewBasicAuth("billing", "s3cret"),
+		},
+		{
+			name:     "no auth",
+			config:   ClientFileConfig{BaseURL: "https://payments.example.com"},
+			wantAuth: cauth.NoAuth,
+		},
+		{
+			name: "invalid values",
+			config: ClientFileConfig{
+				BaseURL:         "payments",
+				Timeout:         "soon",
+				Retries:         -1,
+				MaxResponseSize: -1,
+				TLS: TLSFileConfig{
+					CertFile:     "cert.pem",
+					MinVersion:   "1.4",
+					CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_UNKNOWN"},
+				},
+				Pool: PoolFileConfig{MaxIdleConns: -1, KeepAlive: "-1s"},
+			},
+			wantKeys: []string{
+				"clients.payments.baseURL",
+				"clients.payments.timeout",
+				"clients.payments.retries",
+				"clients.payments.maxResponseSize",
+				"clients.payments.tls.keyFile",
+				"clients.payments.tls.minVersion",
+				"clients.payments.tls.cipherSuites[1]",
+				"clients.payments.pool.maxIdleConns",
+				"clients.payments.pool.keepAlive",
+			},
+		},
+		{
+			name: "unreadable tls files",
+			config: ClientFileConfig{
+				BaseURL: "https://payments.example.com",
+				TLS: TLSFileConfig{
+					CAFiles:  []string{secretFile, secretFile + ".missing"},
+					CertFile: secretFile + ".missing",
+					KeyFile:  secretFile,
+				},
+			},
+			wantKeys: []string{
+				"clients.payments.tls.caFiles[0]",
+				"clients.payments.tls.caFiles[1]",
+				"clients.payments.tls.certFile",
+			},
+		},
+		{
+			name:     "missing base url",
+			config:   ClientFileConfig{},
+			wantKeys: []string{"clients.payments.baseURL"},
+		},
+		{
+			name: "unsupported auth",
+			config: ClientFileConfig{
+				BaseURL: "https://payments.example.com",
+				Auth:    AuthFileConfig{Type: "oauth"},
+			},
+			wantKeys: []string{"clients.payments.auth.type"},
+		},
+		{
+			name: "missing secret",
+			config: ClientFileConfig{
+				BaseURL: "https://payments.example.com",
+				Auth:    AuthFileConfig{Type: "basic", Username: "billing"},
+			},
+			wantKeys: []string{"clients.payments.auth.password"},
+		},
+		{
+			name: "unused secret",
+			config: ClientFileConfig{
+				BaseURL: "https://payments.example.com",
+				Auth:    AuthFileConfig{Type: "apikey", Key: "env:TOKEN", Token: "env:TOKEN"},
+			},
+			wantKeys: []string{"clients.payments.auth.token"},
+		},
+		{
+			name: "plain secret",
+			config: ClientFileConfig{
+				BaseURL: "https://payments.example.com",
+				Auth:    AuthFileConfig{Type: "jwt", Token: "t0ken"},
+			},
+			wantKeys: []string{"clients.payments.auth.token"},
+		},
+		{
+			name: "unset env secret",
+			config: ClientFileConfig{
+				BaseURL: "https://payments.example.com",
+				Auth:    AuthFileConfig{Type: "jwt", Token: "env:EMPTY"},
+			},
+			wantKeys: []string{"clients.payments.auth.token"},
+		},
+		{
+			name: "missing secret file",
+			config: ClientFileConfig{
+				BaseURL: "https://payments.example.com",
+				Auth:    AuthFileConfig{Type: "apikey", Key: "file:" + secretFile + ".missing"},
+			},
+			wantKeys: []string{"clients.payments.auth.key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder, auth, err := tt.config.configBuilder("clients.payments", env)
+			if len(tt.wantKeys) > 0 {
+				assert.Equal(t, tt.wantKeys, configErrorKeys(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAuth, auth)
+			config, err := builder.Build()
+			assert.NoError(t, err)
+			if tt.config.Timeout != "" {
+				assert.Equal(t, 2*time.Second, config.timeout)
+			}
+		})
+	}
+}
+
+func TestClientFileConfig_retries(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantTries int
+	}{
+		{name: "omitted", content: "clients:\n  payments:\n    baseURL: https://payments.example.com\n", wantTries: 1},
+		{name: "no retry", content: "clients:\n  payments:\n    baseURL: https://payments.example.com\n    retries: 0\n",
+			wantTries: 1},
+		{name: "retries", content: "clients:\n  payments:\n    baseURL: https://payments.example.com\n    retries: 2\n",
+			wantTries: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := LoadConfigFile(writeConfigFile(t, "clients.yaml", tt.content))
+			assert.NoError(t, err)
+			builder, _, err := file.Clients["payments"].configBuilder("clients.payments", mapEnv(nil))
+			assert.NoError(t, err)
+			config, err := builder.Build()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantTries, config.numOfRetries)
+		})
+	}
+}
@@ -2,14 +2,45 @@ package httpclient
 
 import (
 	"net/http"
+	"strings"
 )
 
+// HttpMethod is the request method, any valid method token can be used e.g. HttpMethod("PROPFIND")
 type HttpMethod string
 
 const (
-	HEAD   HttpMethod = http.MethodHead
-	GET    HttpMethod = http.MethodGet
-	POST   HttpMethod = http.MethodPost
-	PUT    HttpMethod = http.MethodPut
-	DELETE HttpMethod = http.MethodDelete
+	HEAD    HttpMethod = http.MethodHead
+	GET     HttpMethod = http.MethodGet
+	POST    HttpMethod = http.MethodPost
+	PUT     HttpMethod = http.MethodPut
+	PATCH   HttpMethod = http.MethodPatch
+	DELETE  HttpMethod = http.MethodDelete
+	OPTIONS HttpMethod = http.MethodOptions
+	CONNECT HttpMethod = http.MethodConnect
+	TRACE   HttpMethod = http.MethodTrace
 )
+
+// media types handled by the default codecs
+const (
+	MediaTypeJSON    = "application/json"
+	MediaTypeXML     = "application/xml"
+	MediaTypeTextXML = "text/xml"
+	MediaTypeText    = "text/plain"
+	MediaTypeForm    = "application/x-www-form-urlencoded"
+)
+
+// isValid reports whether the method is a valid token as defined in RFC 7230
+func (m HttpMethod) isValid() bool {
+	if m == "" {
+		return false
+	}
+	for _, r := range m {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
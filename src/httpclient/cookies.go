@@ -0,0 +1,162 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CookieJar is a public suffix aware cookie jar which optionally persists the cookies to a file
+// so that sessions survive process restarts
+type CookieJar struct {
+	jar     *cookiejar.Jar
+	path    string
+	mutex   *sync.Mutex
+	cookies map[string]persistedCookie
+}
+
+// persistedCookie is a cookie and the url it was received from
+type persistedCookie struct {
+	URL      string        `json:"url"`
+	Name     string        `json:"name"`
+	Value    string        `json:"value"`
+	Domain   string        `json:"domain,omitempty"`
+	Path     string        `json:"path,omitempty"`
+	Expires  time.Time     `json:"expires,omitempty"`
+	Secure   bool          `json:"secure,omitempty"`
+	HttpOnly bool          `json:"httpOnly,omitempty"`
+	SameSite http.SameSite `json:"sameSite,omitempty"`
+}
+
+// NewCookieJar creates a cookie jar using the public suffix list to scope the cookie domains.
+// when path is not empty the cookies are loaded from the file and saved to it whenever they change
+func NewCookieJar(path string) (*CookieJar, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	j := &CookieJar{
+		jar:     jar,
+		path:    path,
+		mutex:   new(sync.Mutex),
+		cookies: make(map[string]persistedCookie),
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// SetCookies stores the cookies received from u and persists them if the jar has a file
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+	if j.path == "" {
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	now := time.Now()
+	for _, cookie := range cookies {
+		pc := persistedCookie{
+			URL:      u.Scheme + "://" + u.Host + u.EscapedPath(),
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  cookie.Expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+			SameSite: cookie.SameSite,
+		}
+		if cookie.MaxAge > 0 {
+			pc.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+		key := fmt.Sprintf("%s|%s|%s|%s", u.Hostname(), cookie.Domain, cookie.Path, cookie.Name)
+		if cookie.MaxAge < 0 || (!pc.Expires.IsZero() && !pc.Expires.After(now)) {
+			delete(j.cookies, key)
+			continue
+		}
+		j.cookies[key] = pc
+	}
+	// the jar keeps working in memory if the file can't be written
+	_ = j.save()
+}
+
+// Cookies returns the cookies to send to u
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// load replays the cookies saved in the file, skipping the expired ones
+func (j *CookieJar) load() error {
+	if j.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read cookie file: %w", err)
+	}
+	cookies := make(map[string]persistedCookie)
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return fmt.Errorf("unable to parse cookie file: %w", err)
+	}
+
+	now := time.Now()
+	for key, pc := range cookies {
+		if !pc.Expires.IsZero() && !pc.Expires.After(now) {
+			continue
+		}
+		u, err := url.Parse(pc.URL)
+		if err != nil {
+			continue
+		}
+		j.jar.SetCookies(u, []*http.Cookie{{
+			Name:     pc.Name,
+			Value:    pc.Value,
+			Domain:   pc.Domain,
+			Path:     pc.Path,
+			Expires:  pc.Expires,
+			Secure:   pc.Secure,
+			HttpOnly: pc.HttpOnly,
+			SameSite: pc.SameSite,
+		}})
+		j.cookies[key] = pc
+	}
+	return nil
+}
+
+// save writes the cookies to a temporary file which replaces the cookie file
+func (j *CookieJar) save() error {
+	data, err := json.MarshalIndent(j.cookies, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), j.path)
+}
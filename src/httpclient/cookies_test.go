@@ -0,0 +1,110 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCookieJar_Scoping(t *testing.T) {
+	jar, err := NewCookieJar("")
+	assert.NoError(t, err)
+
+	origin, _ := url.Parse("https://shop.example.co.uk/login")
+	jar.SetCookies(origin, []*http.Cookie{
+		{Name: "public", Value: "1", Domain: "co.uk"},
+		{Name: "domain", Value: "2", Domain: "example.co.uk"},
+		{Name: "host", Value: "3"},
+	})
+
+	tt := []struct {
+		name     string
+		target   string
+		expected []string
+	}{
+		{name: "origin host", target: "https://shop.example.co.uk/", expected: []string{"domain", "host"}},
+		{name: "sibling sub domain", target: "https://www.example.co.uk/", expected: []string{"domain"}},
+		{name: "public suffix", target: "https://other.co.uk/", expected: []string{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			target, _ := url.Parse(tc.target)
+			names := make([]string, 0)
+			for _, cookie := range jar.Cookies(target) {
+				names = append(names, cookie.Name)
+			}
+			assert.ElementsMatch(t, tc.expected, names)
+		})
+	}
+}
+
+func TestCookieJar_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	origin, _ := url.Parse("http://example.com/")
+
+	jar, err := NewCookieJar(path)
+	assert.NoError(t, err)
+	jar.SetCookies(origin, []*http.Cookie{
+		{Name: "session", Value: "abc", MaxAge: 3600},
+		{Name: "expired", Value: "old", Expires: time.Now().Add(-time.Hour)},
+		{Name: "deleted", Value: "x"},
+	})
+	jar.SetCookies(origin, []*http.Cookie{{Name: "deleted", MaxAge: -1}})
+
+	reloaded, err := NewCookieJar(path)
+	assert.NoError(t, err)
+	cookies := reloaded.Cookies(origin)
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, "abc", cookies[0].Value)
+
+	t.Run("malformed file", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+		_, err := NewCookieJar(path)
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_CookieJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			http.Redirect(w, r, "/whoami", http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/again" {
+			http.Redirect(w, r, "/cookies", http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/cookies" {
+			_, _ = w.Write([]byte(strings.Join(r.Header.Values("Cookie"), "; ")))
+			return
+		}
+		cookie, err := r.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(cookie.Value))
+	}))
+	defer server.Close()
+
+	jar, _ := NewCookieJar("")
+	config, _ := NewConfig().WithCookieJar(jar).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+	// the cookie set by the redirect response is sent when following it
+	assert.Equal(t, "abc", callBody(t, client, server.URL, "login"))
+	assert.Equal(t, "abc", callBody(t, client, server.URL, "whoami"))
+	// the cookies of the jar aren't sent twice after a redirect to the same host
+	assert.Equal(t, "session=abc", callBody(t, client, server.URL, "again"))
+}
@@ -0,0 +1,68 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// unixSocketKey is the context key holding the unix socket path of unix:// hosts
+type unixSocketKey struct{}
+
+// unixSocketPath returns the socket path of unix:// hosts e.g. unix:///var/run/sidecar.sock
+func unixSocketPath(host *url.URL) (string, error) {
+	path := host.Path
+	if host.Opaque != "" {
+		path = host.Opaque
+	}
+	if path == "" || host.Host != "" {
+		return "", fmt.Errorf("malformed host %q: expected unix:///path/to/socket", host.String())
+	}
+	return path, nil
+}
+
+// unixSocketHost derives the url host of a socket path, sockets get distinct hosts
+// so that their connections are pooled separately
+func unixSocketHost(path string) string {
+	hash := sha256.Sum256([]byte(path))
+	return fmt.Sprintf("unix-%x.localhost", hash[:8])
+}
+
+// withUnixSocket sets the socket path the request is sent to, an empty path dials the url host
+func withUnixSocket(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, unixSocketKey{}, path)
+}
+
+// unixSocketDial dials the socket path of unix:// hosts found in the context,
+// any other address is dialed using dial
+func unixSocketDial(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if path, ok := ctx.Value(unixSocketKey{}).(string); ok && path != "" {
+			return dial(ctx, "unix", path)
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// fixedSocketDial dials the given unix socket whatever the address is
+func fixedSocketDial(dial dialFunc, path string) dialFunc {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dial(ctx, "unix", path)
+	}
+}
+
+// directUnixSocket never proxies requests to unix:// hosts
+func directUnixSocket(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	if proxy == nil {
+		return nil
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if path, ok := req.Context().Value(unixSocketKey{}).(string); ok && path != "" {
+			return nil, nil
+		}
+		return proxy(req)
+	}
+}
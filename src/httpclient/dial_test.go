@@ -0,0 +1,114 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveUnixSocket serves an http server replying with name over a unix socket
+func serveUnixSocket(t *testing.T, path, name string) {
+	listener, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(name + " " + r.Host + " " + r.URL.Path))
+	})}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+}
+
+// pipeListener accepts the server side of the in-process connections created by dial
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) dial(ctx context.Context, _, _ string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	close(l.done)
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+func TestCaller_UnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.sock")
+	second := filepath.Join(dir, "second.sock")
+	serveUnixSocket(t, first, "first")
+	serveUnixSocket(t, second, "second")
+
+	config, _ := NewConfig().Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+	t.Run("socket per caller", func(t *testing.T) {
+		assert.Equal(t, "first localhost /v1/ping", callBody(t, client, "unix://"+first, "v1/ping"))
+		assert.Equal(t, "second localhost /v1/ping", callBody(t, client, "unix://"+second, "/v1/ping"))
+		assert.Equal(t, "first localhost /v1/ping", callBody(t, client, "unix://"+first, "v1/ping"))
+	})
+
+	t.Run("socket for the whole client", func(t *testing.T) {
+		config, _ := NewConfig().WithUnixSocket(second).Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+		assert.Equal(t, "second sidecar /ping", callBody(t, client, "http://sidecar", "ping"))
+	})
+
+	t.Run("malformed socket host", func(t *testing.T) {
+		_, err := NewCallerBuilder(client, "unix://socket/path", "ping", GET).Build()
+		assert.Error(t, err)
+		_, err = NewCallerBuilder(client, "unix://", "ping", GET).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigBuilder_WithDialer(t *testing.T) {
+	listener := newPipeListener()
+	server := &http.Server{Handler: protoHandler}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+
+	config, _ := NewConfig().WithDialer(listener.dial).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	assert.Equal(t, "HTTP/1.1 /in-process", callBody(t, client, "http://pipe.internal", "in-process"))
+	assert.Equal(t, int64(1), client.PoolStats().DialedConns)
+}
@@ -0,0 +1,419 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrFaultInjected is returned for the requests whose connection is dropped by a FaultInjector
+var ErrFaultInjected = errors.New("fault injected")
+
+// FaultHeader is set on the synthetic responses of a FaultInjector to the name of the rule
+const FaultHeader = "X-Fault-Injected"
+
+// FaultRule injects faults into the requests matching its route. the rates are the ratio,
+// between 0 and 1, of the matching requests a fault is injected into, each fault is drawn on its own
+type FaultRule struct {
+	// Name identifies the rule in the stats, it must be unique
+	Name string
+	// Methods, Hosts and PathPrefix restrict the requests matching the rule, empty values match
+	// all the requests. Hosts are host names or domain suffixes such as *.example.com or .example.com
+	Methods    []HttpMethod
+	Hosts      []string
+	PathPrefix string
+
+	// Latency delays the requests by Latency plus a random jitter up to LatencyJitter
+	Latency       time.Duration
+	LatencyJitter time.Duration
+	LatencyRate   float64
+	// Status replies a synthetic response of the status code without sending the request
+	Status     int
+	StatusRate float64
+	// DropRate fails the requests with ErrFaultInjected as if the connection was dropped without sending them
+	DropRate float64
+	// TruncateAfter cuts the response bodies after the given number of bytes with io.ErrUnexpectedEOF
+	TruncateAfter int64
+	TruncateRate  float64
+	// CorruptRate inverts the bits of the response bodies
+	CorruptRate float64
+}
+
+// FaultStats are the counters of a fault rule
+type FaultStats struct {
+	// Matched is the number of requests matching the rule
+	Matched int64
+	Delayed int64
+	// Statuses is the number of synthetic responses
+	Statuses  int64
+	Dropped   int64
+	Truncated int64
+	Corrupted int64
+}
+
+// FaultInjector injects latency, synthetic statuses, dropped connections, truncated and corrupted bodies
+// into the requests of a Client to test its resilience, built using FaultInjectorBuilder.
+// the rules can be changed and the injection switched on and off while the client is used
+type FaultInjector struct {
+	rules   []FaultRule
+	seed    int64
+	enabled bool
+
+	mutex  *sync.Mutex
+	random *rand.Rand
+	stats  map[string]*FaultStats
+}
+
+// FaultInjectorBuilder builds the FaultInjector
+type FaultInjectorBuilder struct {
+	rules   []FaultRule
+	seed    int64
+	enabled bool
+}
+
+// faultPlan are the faults drawn for a request
+type faultPlan struct {
+	rule     string
+	delay    time.Duration
+	drop     bool
+	status   int
+	truncate bool
+	keep     int64
+	corrupt  bool
+}
+
+// NewFaultInjector creates a FaultInjectorBuilder applying the first matching rule to each request,
+// the injection is enabled by default
+func NewFaultInjector(rules ...FaultRule) *FaultInjectorBuilder {
+	return &FaultInjectorBuilder{
+		rules:   rules,
+		seed:    time.Now().UnixNano(),
+		enabled: true,
+	}
+}
+
+// WithSeed set the seed of the random draws of the faults, so that a test injects the same faults on each run
+func (b *FaultInjectorBuilder) WithSeed(seed int64) *FaultInjectorBuilder {
+	b.seed = seed
+	return b
+}
+
+// WithEnabled set whether the faults are injected until Enable or Disable is called
+func (b *FaultInjectorBuilder) WithEnabled(enabled bool) *FaultInjectorBuilder {
+	b.enabled = enabled
+	return b
+}
+
+// Build validates the FaultInjector
+func (b *FaultInjectorBuilder) Build() (*FaultInjector, error) {
+	rules, err := normalizeFaultRules(b.rules)
+	if err != nil {
+		return nil, err
+	}
+	return &FaultInjector{
+		rules:   rules,
+		seed:    b.seed,
+		enabled: b.enabled,
+		mutex:   new(sync.Mutex),
+		random:  rand.New(rand.NewSource(b.seed)),
+		stats:   make(map[string]*FaultStats),
+	}, nil
+}
+
+// Enable starts injecting the faults
+func (f *FaultInjector) Enable() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.enabled = true
+}
+
+// Disable stops injecting the faults, the requests are sent as they are
+func (f *FaultInjector) Disable() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.enabled = false
+}
+
+// Enabled reports whether the faults are injected
+func (f *FaultInjector) Enabled() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.enabled
+}
+
+// SetRules replaces the rules, the stats of the rules are kept
+func (f *FaultInjector) SetRules(rules ...FaultRule) error {
+	rules, err := normalizeFaultRules(rules)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.rules = rules
+	return nil
+}
+
+// Rules returns the current rules
+func (f *FaultInjector) Rules() []FaultRule {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]FaultRule(nil), f.rules...)
+}
+
+// Stats returns the counters of the rules by name
+func (f *FaultInjector) Stats() map[string]FaultStats {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	stats := make(map[string]FaultStats, len(f.stats))
+	for name, s := range f.stats {
+		stats[name] = *s
+	}
+	return stats
+}
+
+// normalizeFaultRules validates the rules and returns a copy with lower case host patterns
+func normalizeFaultRules(rules []FaultRule) ([]FaultRule, error) {
+	normalized := make([]FaultRule, 0, len(rules))
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("fault rule name can't be empty")
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("fault rule %q is defined twice", rule.Name)
+		}
+		names[rule.Name] = true
+
+		for _, method := range rule.Methods {
+			if !method.isValid() {
+				return nil, fmt.Errorf("fault rule %q has an invalid method %q", rule.Name, method)
+			}
+		}
+		rates := []struct {
+			name string
+			rate float64
+		}{
+			{"latency", rule.LatencyRate}, {"status", rule.StatusRate}, {"drop", rule.DropRate},
+			{"truncate", rule.TruncateRate}, {"corrupt", rule.CorruptRate},
+		}
+		for _, r := range rates {
+			if r.rate < 0 || r.rate > 1 {
+				return nil, fmt.Errorf("fault rule %q %s rate must be between 0 and 1", rule.Name, r.name)
+			}
+		}
+		if rule.Latency < 0 || rule.LatencyJitter < 0 {
+			return nil, fmt.Errorf("fault rule %q latency can't be negative", rule.Name)
+		}
+		if rule.StatusRate > 0 && (rule.Status < 100 || rule.Status > 599) {
+			return nil, fmt.Errorf("fault rule %q has an invalid status %d", rule.Name, rule.Status)
+		}
+		if rule.TruncateAfter < 0 {
+			return nil, fmt.Errorf("fault rule %q truncate after can't be negative", rule.Name)
+		}
+
+		hosts := make([]string, 0, len(rule.Hosts))
+		for _, host := range rule.Hosts {
+			hosts = append(hosts, strings.ToLower(host))
+		}
+		rule.Hosts = hosts
+		rule.Methods = append([]HttpMethod(nil), rule.Methods...)
+		normalized = append(normalized, rule)
+	}
+	return normalized, nil
+}
+
+// matches reports whether the request matches the route of the rule
+func (r *FaultRule) matches(req *http.Request) bool {
+	if len(r.Methods) > 0 {
+		found := false
+		for _, method := range r.Methods {
+			if strings.EqualFold(string(method), req.Method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.Hosts) > 0 {
+		hostname := strings.ToLower((&url.URL{Host: req.URL.Host}).Hostname())
+		if !matchesAnyHostPattern(r.Hosts, hostname) {
+			return false
+		}
+	}
+	return strings.HasPrefix(req.URL.Path, r.PathPrefix)
+}
+
+// plan draws the faults of the first rule matching the request and counts them
+func (f *FaultInjector) plan(req *http.Request) (faultPlan, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.enabled {
+		return faultPlan{}, false
+	}
+	for i := range f.rules {
+		rule := &f.rules[i]
+		if !rule.matches(req) {
+			continue
+		}
+		stats, ok := f.stats[rule.Name]
+		if !ok {
+			stats = new(FaultStats)
+			f.stats[rule.Name] = stats
+		}
+		stats.Matched++
+
+		p := faultPlan{rule: rule.Name}
+		if f.draw(rule.LatencyRate) {
+			p.delay = rule.Latency
+			if rule.LatencyJitter > 0 {
+				p.delay += time.Duration(f.random.Int63n(int64(rule.LatencyJitter)))
+			}
+			stats.Delayed++
+		}
+		switch {
+		case f.draw(rule.DropRate):
+			p.drop = true
+			stats.Dropped++
+		case f.draw(rule.StatusRate):
+			p.status = rule.Status
+			stats.Statuses++
+		default:
+			if f.draw(rule.TruncateRate) {
+				p.truncate, p.keep = true, rule.TruncateAfter
+				stats.Truncated++
+			}
+			if f.draw(rule.CorruptRate) {
+				p.corrupt = true
+				stats.Corrupted++
+			}
+		}
+		return p, true
+	}
+	return faultPlan{}, false
+}
+
+// draw returns true with the probability of the rate
+func (f *FaultInjector) draw(rate float64) bool {
+	return rate > 0 && f.random.Float64() < rate
+}
+
+// faultTransport injects the faults of the injector into the requests
+type faultTransport struct {
+	next   http.RoundTripper
+	faults *FaultInjector
+}
+
+// RoundTrip delays, fails or replies to the request as drawn by the injector, or sends it
+// and truncates or corrupts its response body
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, ok := t.faults.plan(req)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	closeBody := func() {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+	}
+
+	if p.delay > 0 {
+		timer := time.NewTimer(p.delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			closeBody()
+			return nil, req.Context().Err()
+		}
+	}
+	if p.drop {
+		closeBody()
+		return nil, fmt.Errorf("%w: rule %q dropped the connection", ErrFaultInjected, p.rule)
+	}
+	if p.status != 0 {
+		closeBody()
+		header := make(http.Header)
+		header.Set(FaultHeader, p.rule)
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", p.status, http.StatusText(p.status)),
+			StatusCode: p.status,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     header,
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if p.truncate {
+		resp.Body = keepWriter(&truncatedBody{ReadCloser: resp.Body, remaining: p.keep}, resp.Body)
+	}
+	if p.corrupt {
+		resp.Body = keepWriter(&corruptedBody{ReadCloser: resp.Body}, resp.Body)
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the next transport
+func (t *faultTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+// keepWriter returns the faulty body writable when the body it wraps is writable,
+// which is the case of the connection of the protocol upgrades e.g. websocket
+func keepWriter(faulty, body io.ReadCloser) io.ReadCloser {
+	if w, ok := body.(io.Writer); ok {
+		return &readWriteBody{ReadCloser: faulty, Writer: w}
+	}
+	return faulty
+}
+
+// readWriteBody is a body which writes to the connection it reads
+type readWriteBody struct {
+	io.ReadCloser
+	io.Writer
+}
+
+// truncatedBody fails with io.ErrUnexpectedEOF once the remaining bytes are read
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// corruptedBody inverts the bits of the bytes it reads
+type corruptedBody struct {
+	io.ReadCloser
+}
+
+func (b *corruptedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	for i := 0; i < n; i++ {
+		p[i] ^= 0xff
+	}
+	return n, err
+}
@@ -0,0 +1,312 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultInjector_Build(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []FaultRule
+		wantErr bool
+	}{
+		{name: "no rules"},
+		{name: "valid", rules: []FaultRule{
+			{Name: "slow", Latency: time.Second, LatencyRate: 0.5},
+			{Name: "unavailable", Methods: []HttpMethod{GET}, Status: 503, StatusRate: 1},
+		}},
+		{name: "empty name", rules: []FaultRule{{DropRate: 1}}, wantErr: true},
+		{name: "duplicate name", rules: []FaultRule{{Name: "a"}, {Name: "a"}}, wantErr: true},
+		{name: "invalid method", rules: []FaultRule{{Name: "a", Methods: []HttpMethod{"GE T"}}}, wantErr: true},
+		{name: "rate above 1", rules: []FaultRule{{Name: "a", DropRate: 1.5}}, wantErr: true},
+		{name: "negative rate", rules: []FaultRule{{Name: "a", CorruptRate: -0.1}}, wantErr: true},
+		{name: "negative latency", rules: []FaultRule{{Name: "a", Latency: -time.Second}}, wantErr: true},
+		{name: "invalid status", rules: []FaultRule{{Name: "a", Status: 99, StatusRate: 1}}, wantErr: true},
+		{name: "negative truncate", rules: []FaultRule{{Name: "a", TruncateAfter: -1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			faults, err := NewFaultInjector(tt.rules...).Build()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, len(tt.rules), len(faults.Rules()))
+		})
+	}
+
+	// building again creates another injector
+	builder := NewFaultInjector(FaultRule{Name: "drop", DropRate: 1}).WithEnabled(false)
+	faults, _ := builder.Build()
+	faults.Enable()
+	other, err := builder.Build()
+	assert.NoError(t, err)
+	assert.True(t, faults.Enabled())
+	assert.False(t, other.Enabled())
+	assert.NotSame(t, faults.mutex, other.mutex)
+}
+
+func TestClient_FaultInjector(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+
+	faults, err := NewFaultInjector().WithSeed(1).Build()
+	assert.NoError(t, err)
+	config, _ := NewConfig().WithRetry(3).WithFaultInjector(faults).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+	call := func(ctx context.Context, method HttpMethod, route string) (*http.Response, string, error) {
+		if route == "" {
+			route = "items"
+		}
+		caller, err := NewCallerBuilder(client, server.URL, route, method).Build()
+		if err != nil {
+			return nil, "", err
+		}
+		resp, err := caller.RetryableCallWithContext(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp, string(body), err
+	}
+
+	tests := []struct {
+		name         string
+		rule         FaultRule
+		method       HttpMethod
+		route        string
+		timeout      time.Duration
+		wantStatus   int
+		wantBody     string
+		wantErr      error
+		wantRequests int32
+		wantStats    FaultStats
+	}{
+		{
+			name:         "synthetic status is retried",
+			rule:         FaultRule{Name: "rule", Status: http.StatusServiceUnavailable, StatusRate: 1},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantStats:    FaultStats{Matched: 3, Statuses: 3},
+			wantRequests: 0,
+		},
+		{
+			name:         "dropped connection",
+			rule:         FaultRule{Name: "rule", DropRate: 1},
+			wantErr:      ErrFaultInjected,
+			wantStats:    FaultStats{Matched: 3, Dropped: 3},
+			wantRequests: 0,
+		},
+		{
+			name:         "latency",
+			rule:         FaultRule{Name: "rule", Latency: time.Second, LatencyRate: 1},
+			timeout:      50 * time.Millisecond,
+			wantErr:      context.DeadlineExceeded,
+			wantStats:    FaultStats{Matched: 1, Delayed: 1},
+			wantRequests: 0,
+		},
+		{
+			name:         "truncated body",
+			rule:         FaultRule{Name: "rule", TruncateAfter: 4, TruncateRate: 1},
+			wantErr:      io.ErrUnexpectedEOF,
+			wantStats:    FaultStats{Matched: 1, Truncated: 1},
+			wantRequests: 1,
+		},
+		{
+			name:         "corrupted body",
+			rule:         FaultRule{Name: "rule", CorruptRate: 1},
+			wantStatus:   http.StatusOK,
+			wantBody:     invert("hello world"),
+			wantStats:    FaultStats{Matched: 1, Corrupted: 1},
+			wantRequests: 1,
+		},
+		{
+			name:         "unmatched method",
+			rule:         FaultRule{Name: "rule", Methods: []HttpMethod{POST}, DropRate: 1},
+			wantStatus:   http.StatusOK,
+			wantBody:     "hello world",
+			wantRequests: 1,
+		},
+		{
+			name:         "unmatched path",
+			rule:         FaultRule{Name: "rule", PathPrefix: "/items", DropRate: 1},
+			route:        "orders",
+			wantStatus:   http.StatusOK,
+			wantBody:     "hello world",
+			wantRequests: 1,
+		},
+		{
+			name:         "unmatched host",
+			rule:         FaultRule{Name: "rule", Hosts: []string{"*.example.com"}, DropRate: 1},
+			wantStatus:   http.StatusOK,
+			wantBody:     "hello world",
+			wantRequests: 1,
+		},
+		{
+			name:         "matched route",
+			rule:         FaultRule{Name: "rule", Methods: []HttpMethod{GET}, Hosts: []string{"127.0.0.1"}, PathPrefix: "/items", DropRate: 1},
+			route:        "items/1",
+			wantErr:      ErrFaultInjected,
+			wantStats:    FaultStats{Matched: 3, Dropped: 3},
+			wantRequests: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			faults.stats = make(map[string]*FaultStats)
+			atomic.StoreInt32(&requests, 0)
+			assert.NoError(t, faults.SetRules(tt.rule))
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			method := tt.method
+			if method == "" {
+				method = GET
+			}
+			resp, body, err := call(ctx, method, tt.route)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "unexpected error %v", err)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantStatus, resp.StatusCode)
+				assert.Equal(t, tt.wantBody, body)
+			}
+			assert.Equal(t, tt.wantRequests, atomic.LoadInt32(&requests))
+			assert.Equal(t, tt.wantStats, faults.Stats()["rule"])
+		})
+	}
+}
+
+// invert inverts the bits of the bytes of s
+func invert(s string) string {
+	b := []byte(s)
+	for i := range b {
+		b[i] ^= 0xff
+	}
+	return string(b)
+}
+
+func TestFaultInjector_Runtime(t *testing.T) {
+	faults, err := NewFaultInjector(FaultRule{Name: "unavailable", Status: http.StatusBadGateway, StatusRate: 1}).
+		WithEnabled(false).Build()
+	assert.NoError(t, err)
+	transport := &faultTransport{
+		next: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}),
+		faults: faults,
+	}
+	status := func() int {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/items", nil)
+		resp, err := transport.RoundTrip(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	assert.False(t, faults.Enabled())
+	assert.Equal(t, http.StatusOK, status())
+	faults.Enable()
+	assert.True(t, faults.Enabled())
+	assert.Equal(t, http.StatusBadGateway, status())
+	faults.Disable()
+	assert.Equal(t, http.StatusOK, status())
+	assert.Equal(t, FaultStats{Matched: 1, Statuses: 1}, faults.Stats()["unavailable"])
+
+	faults.Enable()
+	assert.Error(t, faults.SetRules(FaultRule{Name: "invalid", DropRate: 2}))
+	assert.Equal(t, "unavailable", faults.Rules()[0].Name)
+	assert.NoError(t, faults.SetRules())
+	assert.Equal(t, http.StatusOK, status())
+}
+
+func TestFaultInjector_UpgradeBody(t *testing.T) {
+	faults, err := NewFaultInjector(FaultRule{Name: "faulty", TruncateAfter: 5, TruncateRate: 1, CorruptRate: 1}).
+		Build()
+	assert.NoError(t, err)
+	conn := &readWriteCloser{Reader: strings.NewReader("upgraded")}
+	transport := &faultTransport{
+		next: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusSwitchingProtocols, Body: conn, Request: req}, nil
+		}),
+		faults: faults,
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/ws", nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+
+	// the faulty body of an upgrade is still the connection
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if assert.True(t, ok) {
+		_, err = rwc.Write([]byte("hello"))
+		assert.NoError(t, err)
+		assert.Equal(t, 5, conn.written)
+		body, err := io.ReadAll(rwc)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Equal(t, 5, len(body))
+		assert.NotEqual(t, "upgra", string(body))
+	}
+	assert.Equal(t, FaultStats{Matched: 1, Truncated: 1, Corrupted: 1}, faults.Stats()["faulty"])
+}
+
+// readWriteCloser is a connection reading from the reader and discarding the writes
+type readWriteCloser struct {
+	io.Reader
+	written int
+}
+
+func (c *readWriteCloser) Write(p []byte) (int, error) {
+	c.written += len(p)
+	return len(p), nil
+}
+
+func (c *readWriteCloser) Close() error {
+	return nil
+}
+
+func TestFaultInjector_Rates(t *testing.T) {
+	faults, err := NewFaultInjector(FaultRule{
+		Name:        "flaky",
+		Latency:     10 * time.Millisecond,
+		LatencyRate: 0.2,
+		DropRate:    0.1,
+		StatusRate:  0.3,
+		Status:      http.StatusInternalServerError,
+	}).WithSeed(42).Build()
+	assert.NoError(t, err)
+
+	req := &http.Request{Method: http.MethodGet, URL: &url.URL{Host: "example.com", Path: "/"}}
+	for i := 0; i < 10000; i++ {
+		p, ok := faults.plan(req)
+		assert.True(t, ok)
+		if p.delay > 0 {
+			assert.Equal(t, 10*time.Millisecond, p.delay)
+		}
+	}
+	stats := faults.Stats()["flaky"]
+	assert.Equal(t, int64(10000), stats.Matched)
+	assert.InDelta(t, 2000, stats.Delayed, 200)
+	assert.InDelta(t, 1000, stats.Dropped, 150)
+	// the status is only drawn for the requests which aren't dropped
+	assert.InDelta(t, 2700, stats.Statuses, 200)
+}
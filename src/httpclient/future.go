@@ -0,0 +1,217 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sghaida/go-stuff/src/eventloop"
+)
+
+// ErrNoFutures is returned by the combinators when they are given no futures
+var ErrNoFutures = errors.New("no futures")
+
+// Future is the pending result of an async call
+type Future struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	resp   *http.Response
+	err    error
+}
+
+// newFuture creates a pending future whose context is canceled by Cancel
+func newFuture(ctx context.Context) (*Future, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Future{done: make(chan struct{}), cancel: cancel}, ctx
+}
+
+// settle sets the result of the future
+func (f *Future) settle(resp *http.Response, err error) {
+	f.resp, f.err = resp, err
+	close(f.done)
+}
+
+// CallAsync do request http call with context without blocking, the call runs on its own goroutine
+// or through the eventloop.Queue of the config if set
+func (c *Caller) CallAsync(ctx context.Context) *Future {
+	future, ctx := newFuture(ctx)
+	call := func() (*http.Response, error) {
+		return c.CallWithContext(ctx)
+	}
+
+	queue := c.client.config.eventLoop
+	if queue == nil {
+		go func() {
+			future.settle(call())
+		}()
+		return future
+	}
+
+	replies := make(chan eventloop.EventReply, 1)
+	queue.Emmit(eventloop.Event{EventType: eventloop.RequireFeedback, Channel: replies}, func() eventloop.EventReply {
+		resp, err := call()
+		return eventloop.EventReply{Payload: resp, Error: err}
+	})
+	go func() {
+		select {
+		case reply := <-replies:
+			resp, _ := reply.Payload.(*http.Response)
+			future.settle(resp, reply.Error)
+		case <-ctx.Done():
+			// the call is skipped or fails right away once it is dequeued
+			future.settle(nil, ctx.Err())
+			go discardReply(replies)
+		}
+	}()
+	return future
+}
+
+// discardReply closes the body of a reply nobody waits for
+func discardReply(replies <-chan eventloop.EventReply) {
+	if reply, ok := <-replies; ok {
+		if resp, _ := reply.Payload.(*http.Response); resp != nil {
+			DrainAndClose(resp.Body)
+		}
+	}
+}
+
+// Done returns a channel closed once the future is settled
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Await waits for the response of the call or until the context is done,
+// in which case the call goes on and its result can be awaited again
+func (f *Future) Await(ctx context.Context) (*http.Response, error) {
+	select {
+	case <-f.done:
+		return f.resp, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Cancel cancels the call if it is still in flight
+func (f *Future) Cancel() {
+	f.cancel()
+}
+
+// Then returns a future settled with the result of next once this future succeeds e.g. to call
+// another service with the response, errors are passed through without calling next.
+// canceling the returned future cancels this future as well
+func (f *Future) Then(next func(resp *http.Response) (*http.Response, error)) *Future {
+	future, ctx := newFuture(context.Background())
+	cancel := future.cancel
+	future.cancel = func() {
+		cancel()
+		f.Cancel()
+	}
+	go func() {
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			future.settle(nil, ctx.Err())
+			f.discard()
+			return
+		}
+		if f.err != nil {
+			future.settle(nil, f.err)
+			return
+		}
+		future.settle(next(f.resp))
+	}()
+	return future
+}
+
+// discard cancels the future and closes the body of its response if any
+func (f *Future) discard() {
+	f.Cancel()
+	go func() {
+		<-f.done
+		if f.resp != nil {
+			DrainAndClose(f.resp.Body)
+		}
+	}()
+}
+
+// All waits for all the futures and returns their responses in the same order,
+// on the first error the other futures are canceled and their responses are closed
+func All(ctx context.Context, futures ...*Future) ([]*http.Response, error) {
+	responses := make([]*http.Response, len(futures))
+	settled := settledFutures(futures)
+	for range futures {
+		select {
+		case i := <-settled:
+			if futures[i].err != nil {
+				discardAll(futures)
+				return nil, futures[i].err
+			}
+			responses[i] = futures[i].resp
+		case <-ctx.Done():
+			discardAll(futures)
+			return nil, ctx.Err()
+		}
+	}
+	return responses, nil
+}
+
+// Any returns the first successful response and cancels the other futures,
+// if all the futures fail the errors are combined
+func Any(ctx context.Context, futures ...*Future) (*http.Response, error) {
+	if len(futures) == 0 {
+		return nil, ErrNoFutures
+	}
+	settled := settledFutures(futures)
+	failures := make([]string, 0, len(futures))
+	for range futures {
+		select {
+		case i := <-settled:
+			if futures[i].err != nil {
+				failures = append(failures, futures[i].err.Error())
+				continue
+			}
+			discardAll(append(append([]*Future{}, futures[:i]...), futures[i+1:]...))
+			return futures[i].resp, nil
+		case <-ctx.Done():
+			discardAll(futures)
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("all the futures failed: %s", strings.Join(failures, "; "))
+}
+
+// Race returns the result of the first settled future, successful or not, and cancels the other futures
+func Race(ctx context.Context, futures ...*Future) (*http.Response, error) {
+	if len(futures) == 0 {
+		return nil, ErrNoFutures
+	}
+	select {
+	case i := <-settledFutures(futures):
+		discardAll(append(append([]*Future{}, futures[:i]...), futures[i+1:]...))
+		return futures[i].resp, futures[i].err
+	case <-ctx.Done():
+		discardAll(futures)
+		return nil, ctx.Err()
+	}
+}
+
+// settledFutures returns a channel receiving the index of each future once it is settled
+func settledFutures(futures []*Future) <-chan int {
+	settled := make(chan int, len(futures))
+	for i, f := range futures {
+		go func(i int, f *Future) {
+			<-f.done
+			settled <- i
+		}(i, f)
+	}
+	return settled
+}
+
+// discardAll discards the futures
+func discardAll(futures []*Future) {
+	for _, f := range futures {
+		f.discard()
+	}
+}
@@ -0,0 +1,180 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/sghaida/go-stuff/src/eventloop"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	eventLoop     *eventloop.Queue
+	eventLoopOnce sync.Once
+)
+
+// testEventLoop starts a single event loop as the event loops of a process share their channels
+func testEventLoop() *eventloop.Queue {
+	eventLoopOnce.Do(func() {
+		eventLoop = eventloop.InitializeEventLoop()
+		eventLoop.Start()
+	})
+	return eventLoop
+}
+
+func TestCaller_CallAsync(t *testing.T) {
+	// /sleep/{duration} replies with the duration after sleeping, /fail replies with 500
+	// and /block waits until the request is canceled
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/block":
+			<-r.Context().Done()
+		case r.URL.Path == "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			duration, _ := time.ParseDuration(strings.TrimPrefix(r.URL.Path, "/sleep/"))
+			time.Sleep(duration)
+			_, _ = w.Write([]byte(duration.String()))
+		}
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	async := func(ctx context.Context, route string) *Future {
+		caller, _ := NewCallerBuilder(client, server.URL, route, GET).Build()
+		return caller.CallAsync(ctx)
+	}
+	// fail is a future settled with an error
+	fail := func(route string) *Future {
+		return async(context.Background(), route).Then(func(resp *http.Response) (*http.Response, error) {
+			DrainAndClose(resp.Body)
+			return nil, errors.New("failed " + route)
+		})
+	}
+	body := func(resp *http.Response) string {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+	ctx := context.Background()
+
+	t.Run("await", func(t *testing.T) {
+		future := async(ctx, "sleep/10ms")
+		resp, err := future.Await(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "10ms", body(resp))
+		<-future.Done()
+	})
+
+	t.Run("await timeout", func(t *testing.T) {
+		future := async(ctx, "sleep/100ms")
+		short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err := future.Await(short)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		// the call goes on
+		resp, err := future.Await(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "100ms", body(resp))
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		future := async(ctx, "block")
+		future.Cancel()
+		_, err := future.Await(ctx)
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("then", func(t *testing.T) {
+		future := async(ctx, "sleep/1ms").Then(func(resp *http.Response) (*http.Response, error) {
+			return async(ctx, "sleep/"+strings.Replace(body(resp), "1", "10", 1)).Await(ctx)
+		})
+		resp, err := future.Await(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "10ms", body(resp))
+
+		_, err = fail("fail").Then(func(resp *http.Response) (*http.Response, error) {
+			t.Error("next called after an error")
+			return resp, nil
+		}).Await(ctx)
+		assert.EqualError(t, err, "failed fail")
+	})
+
+	t.Run("then cancel", func(t *testing.T) {
+		parent := async(ctx, "block")
+		future := parent.Then(func(resp *http.Response) (*http.Response, error) {
+			return resp, nil
+		})
+		future.Cancel()
+		_, err := parent.Await(ctx)
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("all", func(t *testing.T) {
+		responses, err := All(ctx, async(ctx, "sleep/30ms"), async(ctx, "sleep/1ms"), async(ctx, "sleep/10ms"))
+		assert.NoError(t, err)
+		bodies := make([]string, 0)
+		for _, resp := range responses {
+			bodies = append(bodies, body(resp))
+		}
+		assert.Equal(t, []string{"30ms", "1ms", "10ms"}, bodies)
+
+		blocked := async(ctx, "block")
+		_, err = All(ctx, blocked, fail("fail"))
+		assert.EqualError(t, err, "failed fail")
+		_, err = blocked.Await(ctx)
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("any", func(t *testing.T) {
+		blocked := async(ctx, "block")
+		resp, err := Any(ctx, fail("fail"), async(ctx, "sleep/10ms"), blocked)
+		assert.NoError(t, err)
+		assert.Equal(t, "10ms", body(resp))
+		_, err = blocked.Await(ctx)
+		assert.True(t, errors.Is(err, context.Canceled))
+
+		_, err = Any(ctx, fail("a"), fail("b"))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed a")
+		assert.Contains(t, err.Error(), "failed b")
+
+		_, err = Any(ctx)
+		assert.True(t, errors.Is(err, ErrNoFutures))
+	})
+
+	t.Run("race", func(t *testing.T) {
+		blocked := async(ctx, "block")
+		resp, err := Race(ctx, blocked, async(ctx, "sleep/1ms"))
+		assert.NoError(t, err)
+		assert.Equal(t, "1ms", body(resp))
+		_, err = blocked.Await(ctx)
+		assert.True(t, errors.Is(err, context.Canceled))
+
+		_, err = Race(ctx, async(ctx, "block"), fail("fail"))
+		assert.EqualError(t, err, "failed fail")
+	})
+
+	t.Run("event loop", func(t *testing.T) {
+		config, _ := NewConfig().WithEventLoop(testEventLoop()).Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+		caller, _ := NewCallerBuilder(client, server.URL, "sleep/1ms", GET).Build()
+
+		responses, err := All(ctx, caller.CallAsync(ctx), caller.CallAsync(ctx))
+		assert.NoError(t, err)
+		for _, resp := range responses {
+			assert.Equal(t, "1ms", body(resp))
+		}
+	})
+}
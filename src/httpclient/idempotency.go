@@ -0,0 +1,92 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// DefaultIdempotencyHeader is the header carrying the idempotency key unless another one is set
+const DefaultIdempotencyHeader = "Idempotency-Key"
+
+// IdempotencyKeyFunc derives the idempotency key of a logical call e.g. from a business id in the body.
+// it is called once per Call or RetryableCall and the key is reused by all the attempts
+type IdempotencyKeyFunc func(method HttpMethod, endpoint *url.URL, body []byte) (string, error)
+
+// idempotencyKeyCtx is the context key of the idempotency key shared by the attempts of a call
+type idempotencyKeyCtx struct{}
+
+// newIdempotencyKey is the default IdempotencyKeyFunc generating a random uuid
+func newIdempotencyKey(HttpMethod, *url.URL, []byte) (string, error) {
+	return uuid.New().String(), nil
+}
+
+// retryableStatuses are the response status codes which are retried by RetryableCall
+var retryableStatuses = map[int]bool{
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// isIdempotent reports whether sending the request more than once has the same effect as sending it once
+func (m HttpMethod) isIdempotent() bool {
+	switch m {
+	case GET, HEAD, OPTIONS, TRACE, PUT, DELETE:
+		return true
+	}
+	return false
+}
+
+// isRetryable reports whether the call can be safely retried, which is the case for idempotent
+// methods and for calls carrying an idempotency key
+func (c *Caller) isRetryable() bool {
+	return c.method.isIdempotent() || c.idempotencyHeader != ""
+}
+
+// idempotencyKey returns the key of the call from the context, the request headers
+// or derives a new one using the key func
+func (c *Caller) idempotencyKey(ctx context.Context) (string, error) {
+	if key, ok := ctx.Value(idempotencyKeyCtx{}).(string); ok {
+		return key, nil
+	}
+	for name, value := range c.headers {
+		if http.CanonicalHeaderKey(name) == http.CanonicalHeaderKey(c.idempotencyHeader) {
+			return value, nil
+		}
+	}
+	endpoint := *c.endpoint
+	key, err := c.idempotencyKeyFunc(c.method, &endpoint, c.reqBody)
+	if err != nil {
+		return "", fmt.Errorf("unable to derive idempotency key: %w", err)
+	}
+	if key == "" {
+		return "", fmt.Errorf("unable to derive idempotency key: empty key")
+	}
+	return key, nil
+}
+
+// withIdempotencyKey returns a context sharing the idempotency key of the call with all its attempts
+func (c *Caller) withIdempotencyKey(ctx context.Context) (context.Context, error) {
+	if c.idempotencyHeader == "" {
+		return ctx, nil
+	}
+	key, err := c.idempotencyKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key), nil
+}
+
+// retryableStatusError is returned to the retry loop for responses with a retryable status
+type retryableStatusError struct {
+	resp *http.Response
+}
+
+func (e *retryableStatusError) Error() string {
+	return fmt.Sprintf("retryable response status %d", e.resp.StatusCode)
+}
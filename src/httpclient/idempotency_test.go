@@ -0,0 +1,166 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaller_RetryableCall(t *testing.T) {
+	// the server fails the first attempts of each route with 503 and records the idempotency keys
+	var (
+		mutex    sync.Mutex
+		attempts map[string]int
+		keys     map[string][]string
+	)
+	reset := func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts = make(map[string]int)
+		keys = make(map[string][]string)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts[r.URL.Path]++
+		keys[r.URL.Path] = append(keys[r.URL.Path], r.Header.Get(DefaultIdempotencyHeader)+r.Header.Get("X-Request-Key"))
+		if r.URL.Path == "/down" || attempts[r.URL.Path] < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	config, _ := NewConfig().WithRetry(3).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	bodyKey := func(_ HttpMethod, _ *url.URL, body []byte) (string, error) {
+		return "payment-" + string(body), nil
+	}
+
+	tt := []struct {
+		name         string
+		method       HttpMethod
+		build        func(b *CallerBuilder) *CallerBuilder
+		status       int
+		attempts     int
+		expectedKeys string
+	}{
+		{name: "keyed POST is retried with the same key", method: POST,
+			build: func(b *CallerBuilder) *CallerBuilder {
+				return b.WithIdempotencyKey("", nil)
+			}, status: http.StatusCreated, attempts: 3},
+		{name: "POST without a key is tried once", method: POST, status: http.StatusServiceUnavailable, attempts: 1},
+		{name: "GET is retried without a key", method: GET, status: http.StatusCreated, attempts: 3},
+		{name: "custom header and key func", method: POST,
+			build: func(b *CallerBuilder) *CallerBuilder {
+				return b.WithIdempotencyKey("X-Request-Key", bodyKey)
+			}, status: http.StatusCreated, attempts: 3, expectedKeys: "payment-42"},
+		{name: "key set in the headers", method: PATCH,
+			build: func(b *CallerBuilder) *CallerBuilder {
+				return b.WithIdempotencyKey("", bodyKey).WithHeaders(map[string]string{"idempotency-key": "fixed"})
+			}, status: http.StatusCreated, attempts: 3, expectedKeys: "fixed"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reset()
+			builder := NewCallerBuilder(client, server.URL, "pay", tc.method).WithRequestBody([]byte("42"))
+			if tc.build != nil {
+				builder = tc.build(builder)
+			}
+			caller, err := builder.Build()
+			assert.NoError(t, err)
+
+			resp, err := caller.RetryableCall()
+			assert.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, tc.status, resp.StatusCode)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			assert.Equal(t, tc.attempts, attempts["/pay"])
+			sent := keys["/pay"]
+			for _, key := range sent {
+				assert.Equal(t, sent[0], key)
+			}
+			if tc.expectedKeys != "" {
+				assert.Equal(t, tc.expectedKeys, sent[0])
+			}
+			if tc.build != nil {
+				assert.NotEmpty(t, sent[0])
+			}
+		})
+	}
+
+	t.Run("each call has its own key", func(t *testing.T) {
+		reset()
+		caller, _ := NewCallerBuilder(client, server.URL, "single", POST).WithIdempotencyKey("", nil).Build()
+		for i := 0; i < 2; i++ {
+			resp, err := caller.Call()
+			assert.NoError(t, err)
+			_ = resp.Body.Close()
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Len(t, keys["/single"], 2)
+		assert.NotEqual(t, keys["/single"][0], keys["/single"][1])
+	})
+
+	t.Run("last response when the retries are exhausted", func(t *testing.T) {
+		reset()
+		caller, _ := NewCallerBuilder(client, server.URL, "down", GET).Build()
+		resp, err := caller.RetryableCall()
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, 3, attempts["/down"])
+	})
+
+	t.Run("transport errors", func(t *testing.T) {
+		var dials int32
+		config, _ := NewConfig().WithRetry(3).WithDialer(func(context.Context, string, string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return nil, errors.New("connection refused")
+		}).Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+		// an unkeyed POST used to be retried on every error like the GET, it is now tried once
+		caller, _ := NewCallerBuilder(client, server.URL, "pay", POST).Build()
+		_, err := caller.RetryableCall()
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&dials))
+
+		caller, _ = NewCallerBuilder(client, server.URL, "pay", GET).Build()
+		_, err = caller.RetryableCall()
+		assert.Error(t, err)
+		assert.Equal(t, int32(4), atomic.LoadInt32(&dials))
+
+		caller, _ = NewCallerBuilder(client, server.URL, "pay", POST).WithIdempotencyKey("", nil).Build()
+		_, err = caller.RetryableCall()
+		assert.Error(t, err)
+		assert.Equal(t, int32(7), atomic.LoadInt32(&dials))
+	})
+
+	t.Run("key func error", func(t *testing.T) {
+		caller, _ := NewCallerBuilder(client, server.URL, "pay", POST).
+			WithIdempotencyKey("", func(HttpMethod, *url.URL, []byte) (string, error) {
+				return "", errors.New("no business id")
+			}).Build()
+		_, err := caller.RetryableCall()
+		assert.Error(t, err)
+		_, err = caller.Call()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,308 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrLimitExceeded is returned when a request is rejected because its host reached the adaptive concurrency limit
+var ErrLimitExceeded = errors.New("concurrency limit exceeded")
+
+// LimitSample describes a completed request
+type LimitSample struct {
+	// RTT is the time until the response headers were received
+	RTT time.Duration
+	// InFlight is the number of in flight requests when the request was sent
+	InFlight int
+	// Dropped is true if the request failed or the host replied with an overload status
+	Dropped bool
+}
+
+// LimitAlgorithm computes the concurrency limit of a host from the completed requests,
+// each host has its own LimitAlgorithm
+type LimitAlgorithm interface {
+	// Update returns the new limit given the current limit and a completed request
+	Update(limit int, sample LimitSample) int
+}
+
+// aimdLimit is the additive increase multiplicative decrease LimitAlgorithm
+type aimdLimit struct {
+	backoffRatio float64
+	timeout      time.Duration
+}
+
+// NewAIMDLimit creates a LimitAlgorithm which increases the limit by one after each successful request
+// and multiplies it by backoffRatio e.g. 0.9 after each dropped request or request slower than timeout,
+// a zero timeout only backs off on drops. a backoffRatio out of the 0-1 range uses 0.9
+func NewAIMDLimit(backoffRatio float64, timeout time.Duration) LimitAlgorithm {
+	if backoffRatio <= 0 || backoffRatio >= 1 {
+		backoffRatio = 0.9
+	}
+	return &aimdLimit{backoffRatio: backoffRatio, timeout: timeout}
+}
+
+// Update implements LimitAlgorithm
+func (a *aimdLimit) Update(limit int, sample LimitSample) int {
+	if sample.Dropped || (a.timeout > 0 && sample.RTT > a.timeout) {
+		return int(float64(limit) * a.backoffRatio)
+	}
+	// only grow the limit when it is actually used
+	if sample.InFlight*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// gradientLimit is a Vegas like LimitAlgorithm comparing the latency to the lowest latency seen
+type gradientLimit struct {
+	tolerance float64
+	smoothing float64
+	// probeInterval is the number of samples after which the min rtt is reset to follow latency changes
+	probeInterval int
+
+	minRTT  time.Duration
+	samples int
+	limit   float64
+}
+
+// NewGradientLimit creates a LimitAlgorithm which shrinks the limit when the latency grows above tolerance
+// times the lowest latency seen e.g. 2 and grows it by the square root of the limit while the latency is
+// stable, smoothing between 0 and 1 e.g. 0.2 sets how fast the limit follows the measurements.
+// a tolerance below 1 uses 2 and a smoothing out of range uses 0.2
+func NewGradientLimit(tolerance, smoothing float64) LimitAlgorithm {
+	if tolerance < 1 {
+		tolerance = 2
+	}
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+	return &gradientLimit{tolerance: tolerance, smoothing: smoothing, probeInterval: 1000}
+}
+
+// Update implements LimitAlgorithm
+func (g *gradientLimit) Update(limit int, sample LimitSample) int {
+	// the limiter clamps the returned limit to its bounds, g.limit follows it so that it doesn't grow past them
+	if g.limit == 0 || int(g.limit) != limit {
+		g.limit = float64(limit)
+	}
+	if sample.Dropped {
+		g.limit = math.Max(1, g.limit*0.5)
+		return int(g.limit)
+	}
+	g.samples++
+	if g.samples%g.probeInterval == 0 {
+		g.minRTT = 0
+	}
+	if g.minRTT == 0 || sample.RTT < g.minRTT {
+		g.minRTT = sample.RTT
+	}
+	if sample.RTT <= 0 {
+		return limit
+	}
+
+	gradient := math.Max(0.5, math.Min(1, g.tolerance*float64(g.minRTT)/float64(sample.RTT)))
+	next := g.limit*gradient + math.Sqrt(g.limit)
+	// only grow the limit when it is actually used
+	if next > g.limit && sample.InFlight*2 < limit {
+		return limit
+	}
+	g.limit = g.limit*(1-g.smoothing) + next*g.smoothing
+	return int(g.limit)
+}
+
+// AdaptiveLimiter limits the concurrent requests per host using a LimitAlgorithm which adjusts the limit
+// from the observed latency and drops, built using AdaptiveLimiterBuilder. requests above the limit are
+// rejected right away with ErrLimitExceeded, a request is in flight until its response body is closed or fully read
+type AdaptiveLimiter struct {
+	newAlgorithm func() LimitAlgorithm
+	initialLimit int
+	minLimit     int
+	maxLimit     int
+
+	mutex *sync.Mutex
+	hosts map[string]*hostLimit
+}
+
+// AdaptiveLimiterBuilder builds the AdaptiveLimiter
+type AdaptiveLimiterBuilder struct {
+	newAlgorithm func() LimitAlgorithm
+	initialLimit int
+	minLimit     int
+	maxLimit     int
+}
+
+// AdaptiveLimitStats are the gauges of the adaptive limit of a host
+type AdaptiveLimitStats struct {
+	// Limit is the current concurrency limit
+	Limit int
+	// InFlight is the number of in flight requests
+	InFlight int
+	// Rejected is the total number of rejected requests
+	Rejected int64
+}
+
+// hostLimit is the adaptive limit of a host
+type hostLimit struct {
+	mutex     *sync.Mutex
+	algorithm LimitAlgorithm
+	limit     int
+	inFlight  int
+	rejected  int64
+}
+
+// NewAdaptiveLimiter creates an AdaptiveLimiterBuilder, newAlgorithm creates the LimitAlgorithm of each host
+// e.g. func() LimitAlgorithm { return NewGradientLimit(2, 0.2) }. the limits start at 20 and stay between 1 and 1000
+func NewAdaptiveLimiter(newAlgorithm func() LimitAlgorithm) *AdaptiveLimiterBuilder {
+	return &AdaptiveLimiterBuilder{
+		newAlgorithm: newAlgorithm,
+		initialLimit: 20,
+		minLimit:     1,
+		maxLimit:     1000,
+	}
+}
+
+// WithInitialLimit set the limit of a host before any request completed
+func (b *AdaptiveLimiterBuilder) WithInitialLimit(limit int) *AdaptiveLimiterBuilder {
+	b.initialLimit = limit
+	return b
+}
+
+// WithLimits set the bounds of the limits
+func (b *AdaptiveLimiterBuilder) WithLimits(minLimit, maxLimit int) *AdaptiveLimiterBuilder {
+	b.minLimit = minLimit
+	b.maxLimit = maxLimit
+	return b
+}
+
+// Build validates the AdaptiveLimiter
+func (b *AdaptiveLimiterBuilder) Build() (*AdaptiveLimiter, error) {
+	if b.newAlgorithm == nil {
+		return nil, errors.New("limit algorithm is not defined")
+	}
+	if b.minLimit <= 0 {
+		return nil, errors.New("min limit must be positive")
+	}
+	if b.maxLimit < b.minLimit {
+		return nil, fmt.Errorf("max limit %d is less than min limit %d", b.maxLimit, b.minLimit)
+	}
+	if b.initialLimit < b.minLimit || b.initialLimit > b.maxLimit {
+		return nil, fmt.Errorf("initial limit %d is out of the %d-%d bounds", b.initialLimit, b.minLimit, b.maxLimit)
+	}
+	return &AdaptiveLimiter{
+		newAlgorithm: b.newAlgorithm,
+		initialLimit: b.initialLimit,
+		minLimit:     b.minLimit,
+		maxLimit:     b.maxLimit,
+		mutex:        new(sync.Mutex),
+		hosts:        make(map[string]*hostLimit),
+	}, nil
+}
+
+// Stats returns the gauges of the hosts
+func (l *AdaptiveLimiter) Stats() map[string]AdaptiveLimitStats {
+	l.mutex.Lock()
+	hosts := make(map[string]*hostLimit, len(l.hosts))
+	for host, h := range l.hosts {
+		hosts[host] = h
+	}
+	l.mutex.Unlock()
+
+	stats := make(map[string]AdaptiveLimitStats, len(hosts))
+	for host, h := range hosts {
+		h.mutex.Lock()
+		stats[host] = AdaptiveLimitStats{Limit: h.limit, InFlight: h.inFlight, Rejected: h.rejected}
+		h.mutex.Unlock()
+	}
+	return stats
+}
+
+// host returns the limit of the host, creating it on first use
+func (l *AdaptiveLimiter) host(host string) *hostLimit {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostLimit{mutex: new(sync.Mutex), algorithm: l.newAlgorithm(), limit: l.initialLimit}
+		l.hosts[host] = h
+	}
+	return h
+}
+
+// acquire takes a slot if the host is below its limit, it returns the number of in flight requests
+func (h *hostLimit) acquire() (int, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.inFlight >= h.limit {
+		h.rejected++
+		return 0, fmt.Errorf("%w: %d requests in flight", ErrLimitExceeded, h.inFlight)
+	}
+	h.inFlight++
+	return h.inFlight, nil
+}
+
+// update adjusts the limit of the host using the sample, within the limiter bounds
+func (l *AdaptiveLimiter) update(h *hostLimit, sample LimitSample) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	limit := h.algorithm.Update(h.limit, sample)
+	if limit < l.minLimit {
+		limit = l.minLimit
+	}
+	if limit > l.maxLimit {
+		limit = l.maxLimit
+	}
+	h.limit = limit
+}
+
+// release frees the slot of a completed request
+func (h *hostLimit) release() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.inFlight--
+}
+
+// limiterTransport sends the requests through the adaptive limiter
+type limiterTransport struct {
+	next    http.RoundTripper
+	limiter *AdaptiveLimiter
+}
+
+// RoundTrip sends the request if its host is below the limit and feeds the outcome to the limit algorithm,
+// errors and the statuses retried by RetryableCall count as drops
+func (t *limiterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h := t.limiter.host(req.URL.Host)
+	inFlight, err := h.acquire()
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	sample := LimitSample{RTT: time.Since(start), InFlight: inFlight}
+	if err != nil {
+		// requests canceled by the caller say nothing about the host
+		if !errors.Is(req.Context().Err(), context.Canceled) {
+			sample.Dropped = true
+			t.limiter.update(h, sample)
+		}
+		h.release()
+		return nil, err
+	}
+	sample.Dropped = retryableStatuses[resp.StatusCode]
+	t.limiter.update(h, sample)
+	resp.Body = wrapBody(resp.Body, h.release)
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the next transport
+func (t *limiterTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
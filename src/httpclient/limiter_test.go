@@ -0,0 +1,149 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitAlgorithms(t *testing.T) {
+	tt := []struct {
+		name      string
+		algorithm LimitAlgorithm
+		samples   []LimitSample
+		expected  int
+	}{
+		{name: "aimd increases when used", algorithm: NewAIMDLimit(0.5, 0),
+			samples: []LimitSample{{InFlight: 10}, {InFlight: 10}}, expected: 12},
+		{name: "aimd doesn't increase when unused", algorithm: NewAIMDLimit(0.5, 0),
+			samples: []LimitSample{{InFlight: 1}, {InFlight: 1}}, expected: 10},
+		{name: "aimd backs off on drops", algorithm: NewAIMDLimit(0.5, 0),
+			samples: []LimitSample{{InFlight: 10, Dropped: true}}, expected: 5},
+		{name: "aimd backs off on timeouts", algorithm: NewAIMDLimit(0.5, time.Second),
+			samples: []LimitSample{{InFlight: 10, RTT: 2 * time.Second}}, expected: 5},
+		{name: "gradient grows with a stable latency", algorithm: NewGradientLimit(2, 1),
+			samples: []LimitSample{{InFlight: 10, RTT: 10 * time.Millisecond}}, expected: 13},
+		{name: "gradient shrinks with a growing latency", algorithm: NewGradientLimit(1, 1),
+			samples: []LimitSample{
+				{InFlight: 10, RTT: 10 * time.Millisecond},
+				{InFlight: 10, RTT: 40 * time.Millisecond},
+				{InFlight: 10, RTT: 40 * time.Millisecond},
+			}, expected: 8},
+		{name: "gradient halves on drops", algorithm: NewGradientLimit(2, 0.2),
+			samples: []LimitSample{{InFlight: 10, Dropped: true}}, expected: 5},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			limit := 10
+			for _, sample := range tc.samples {
+				limit = tc.algorithm.Update(limit, sample)
+			}
+			assert.Equal(t, tc.expected, limit)
+		})
+	}
+}
+
+func TestAdaptiveLimiter_gradientBounds(t *testing.T) {
+	limiter, err := NewAdaptiveLimiter(func() LimitAlgorithm {
+		return NewGradientLimit(2, 0.5)
+	}).WithInitialLimit(4).WithLimits(1, 8).Build()
+	assert.NoError(t, err)
+	h := limiter.host("example.com")
+
+	// the limit grows up to the max while the latency is stable
+	for i := 0; i < 100; i++ {
+		limiter.update(h, LimitSample{InFlight: h.limit, RTT: 10 * time.Millisecond})
+	}
+	assert.Equal(t, 8, h.limit)
+
+	// then shrinks right away once the host is overloaded
+	limiter.update(h, LimitSample{InFlight: h.limit, RTT: 100 * time.Millisecond})
+	assert.Less(t, h.limit, 8)
+}
+
+func TestClient_AdaptiveLimiter(t *testing.T) {
+	// the server fails while degraded
+	var degraded int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&degraded) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	host := server.Listener.Addr().String()
+
+	limiter, err := NewAdaptiveLimiter(func() LimitAlgorithm {
+		return NewAIMDLimit(0.5, 0)
+	}).WithInitialLimit(4).WithLimits(1, 8).Build()
+	assert.NoError(t, err)
+	config, _ := NewConfig().WithAdaptiveLimiter(limiter).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	caller, _ := NewCallerBuilder(client, server.URL, "route", GET).Build()
+	call := func() (*http.Response, error) {
+		return caller.Call()
+	}
+
+	t.Run("backs off when the host degrades", func(t *testing.T) {
+		atomic.StoreInt32(&degraded, 1)
+		for i := 0; i < 3; i++ {
+			resp, err := call()
+			assert.NoError(t, err)
+			DrainAndClose(resp.Body)
+		}
+		assert.Equal(t, AdaptiveLimitStats{Limit: 1}, limiter.Stats()[host])
+	})
+
+	t.Run("rejects requests above the limit", func(t *testing.T) {
+		resp, err := call()
+		assert.NoError(t, err)
+		_, err = call()
+		assert.True(t, errors.Is(err, ErrLimitExceeded))
+		DrainAndClose(resp.Body)
+		assert.Equal(t, int64(1), limiter.Stats()[host].Rejected)
+	})
+
+	t.Run("recovers while the limit is used", func(t *testing.T) {
+		atomic.StoreInt32(&degraded, 0)
+		for i := 0; i < 20; i++ {
+			resp, err := call()
+			assert.NoError(t, err)
+			DrainAndClose(resp.Body)
+		}
+		// sequential requests grow the limit until it is more than twice the used concurrency
+		stats := limiter.Stats()[host]
+		assert.Equal(t, 0, stats.InFlight)
+		assert.Equal(t, 3, stats.Limit)
+	})
+
+	t.Run("building again doesn't change the limiter", func(t *testing.T) {
+		builder := NewAdaptiveLimiter(func() LimitAlgorithm { return NewAIMDLimit(0.5, 0) }).
+			WithInitialLimit(4).WithLimits(1, 8)
+		limiter, err := builder.Build()
+		assert.NoError(t, err)
+		limiter.host("example.com")
+		other, err := builder.WithLimits(1, 100).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 8, limiter.maxLimit)
+		assert.Len(t, limiter.Stats(), 1)
+		assert.Empty(t, other.Stats())
+	})
+
+	t.Run("invalid limiters", func(t *testing.T) {
+		_, err := NewAdaptiveLimiter(nil).Build()
+		assert.Error(t, err)
+		_, err = NewAdaptiveLimiter(func() LimitAlgorithm { return NewAIMDLimit(0.9, 0) }).WithLimits(0, 10).Build()
+		assert.Error(t, err)
+		_, err = NewAdaptiveLimiter(func() LimitAlgorithm { return NewAIMDLimit(0.9, 0) }).WithLimits(5, 1).Build()
+		assert.Error(t, err)
+		_, err = NewAdaptiveLimiter(func() LimitAlgorithm { return NewAIMDLimit(0.9, 0) }).WithInitialLimit(50).
+			WithLimits(1, 10).Build()
+		assert.Error(t, err)
+	})
+}
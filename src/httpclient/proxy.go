@@ -0,0 +1,229 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+)
+
+// Proxy selects the proxy of each request, built using ProxyBuilder
+type Proxy struct {
+	proxyURL    string
+	auth        *cauth.BasicAuth
+	hostProxies []hostProxy
+	noProxy     []string
+
+	defaultURL *url.URL
+	rules      []noProxyRule
+}
+
+// ProxyBuilder builds the Proxy
+type ProxyBuilder struct {
+	proxyURL    string
+	auth        *cauth.BasicAuth
+	hostProxies []hostProxy
+	noProxy     []string
+
+	defaultURL *url.URL
+	rules      []noProxyRule
+}
+
+// hostProxy is the proxy used for the hosts matching pattern
+type hostProxy struct {
+	pattern  string
+	proxyURL string
+	url      *url.URL
+}
+
+// noProxyRule matches the hosts which are connected to directly
+type noProxyRule struct {
+	all   bool
+	ipNet *net.IPNet
+	// domain matches its sub domains as well unless it starts with a dot which matches the sub domains only
+	domain string
+	port   string
+}
+
+// NewProxy creates a ProxyBuilder sending the requests through proxyURL,
+// an empty proxyURL connects directly unless a host proxy matches.
+// http, https and socks5 proxies are supported e.g. socks5://127.0.0.1:1080
+func NewProxy(proxyURL string) *ProxyBuilder {
+	return &ProxyBuilder{
+		proxyURL:    proxyURL,
+		hostProxies: make([]hostProxy, 0),
+		noProxy:     make([]string, 0),
+	}
+}
+
+// WithAuth authenticate against the proxies using basic auth
+func (b *ProxyBuilder) WithAuth(auth *cauth.BasicAuth) *ProxyBuilder {
+	b.auth = auth
+	return b
+}
+
+// WithHostProxy use proxyURL for the hosts matching the pattern instead of the default proxy,
+// the pattern is a host name or a domain suffix such as *.example.com or .example.com
+func (b *ProxyBuilder) WithHostProxy(pattern, proxyURL string) *ProxyBuilder {
+	b.hostProxies = append(b.hostProxies, hostProxy{pattern: strings.ToLower(pattern), proxyURL: proxyURL})
+	return b
+}
+
+// WithNoProxy connect directly to the hosts matching the rules, which have the NO_PROXY format:
+// * matches all hosts, CIDR blocks and IPs match the IP hosts, example.com matches the domain and its
+// sub domains while .example.com only matches the sub domains. rules may have a port e.g. example.com:8080
+func (b *ProxyBuilder) WithNoProxy(rules ...string) *ProxyBuilder {
+	b.noProxy = append(b.noProxy, rules...)
+	return b
+}
+
+// Build validates the proxy urls and the no proxy rules
+func (b *ProxyBuilder) Build() (*Proxy, error) {
+	if b.proxyURL == "" && len(b.hostProxies) == 0 {
+		return nil, errors.New("proxy url can't be empty")
+	}
+	if b.auth != nil {
+		if _, err := b.auth.GetAuthData(); err != nil {
+			return nil, fmt.Errorf("invalid proxy auth: %w", err)
+		}
+	}
+
+	var err error
+	b.defaultURL = nil
+	if b.proxyURL != "" {
+		if b.defaultURL, err = parseProxyURL(b.proxyURL); err != nil {
+			return nil, err
+		}
+	}
+	for i := range b.hostProxies {
+		if b.hostProxies[i].pattern == "" {
+			return nil, errors.New("host proxy pattern can't be empty")
+		}
+		if b.hostProxies[i].url, err = parseProxyURL(b.hostProxies[i].proxyURL); err != nil {
+			return nil, err
+		}
+	}
+	b.rules = make([]noProxyRule, 0, len(b.noProxy))
+	for _, rule := range b.noProxy {
+		parsed, err := parseNoProxyRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		b.rules = append(b.rules, parsed)
+	}
+	return (*Proxy)(b), nil
+}
+
+// ProxyFor returns the proxy url for the request or nil to connect directly,
+// it can be used as http.Transport Proxy
+func (p *Proxy) ProxyFor(req *http.Request) (*url.URL, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	for _, rule := range p.rules {
+		if rule.matches(host, port) {
+			return nil, nil
+		}
+	}
+
+	proxyURL := p.defaultURL
+	for _, hp := range p.hostProxies {
+		if matchesHostPattern(hp.pattern, host) {
+			proxyURL = hp.url
+			break
+		}
+	}
+	if proxyURL == nil || p.auth == nil {
+		return proxyURL, nil
+	}
+
+	// the transport sends the url credentials in the Proxy-Authorization header
+	// of CONNECT and plain http requests, and uses them for the socks5 handshake
+	withAuth := *proxyURL
+	withAuth.User = url.UserPassword(p.auth.GetCredentials())
+	return &withAuth, nil
+}
+
+// parseProxyURL validates the proxy url
+func parseProxyURL(proxyURL string) (*url.URL, error) {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("malformed proxy url %q: %w", proxyURL, err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("malformed proxy url %q: scheme must be http, https or socks5", proxyURL)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("malformed proxy url %q: missing host", proxyURL)
+	}
+	return parsed, nil
+}
+
+// matchesHostPattern matches a host against a host name or a *.domain or .domain suffix
+func matchesHostPattern(pattern, host string) bool {
+	suffix := strings.TrimPrefix(pattern, "*")
+	if strings.HasPrefix(suffix, ".") {
+		return strings.HasSuffix(host, suffix)
+	}
+	return host == pattern
+}
+
+// parseNoProxyRule parses a single NO_PROXY entry
+func parseNoProxyRule(rule string) (noProxyRule, error) {
+	rule = strings.ToLower(strings.TrimSpace(rule))
+	if rule == "" {
+		return noProxyRule{}, errors.New("no proxy rule can't be empty")
+	}
+	if rule == "*" {
+		return noProxyRule{all: true}, nil
+	}
+	if _, ipNet, err := net.ParseCIDR(rule); err == nil {
+		return noProxyRule{ipNet: ipNet}, nil
+	}
+
+	host, port := rule, ""
+	if h, p, err := net.SplitHostPort(rule); err == nil {
+		host, port = h, p
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		bits := 8 * len(ip.To16())
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return noProxyRule{ipNet: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, port: port}, nil
+	}
+	if strings.HasPrefix(host, "*.") {
+		host = host[1:]
+	}
+	return noProxyRule{domain: host, port: port}, nil
+}
+
+// matches reports whether the host should be connected to directly
+func (r noProxyRule) matches(host, port string) bool {
+	if r.all {
+		return true
+	}
+	if r.port != "" && r.port != port {
+		return false
+	}
+	if r.ipNet != nil {
+		ip := net.ParseIP(host)
+		return ip != nil && r.ipNet.Contains(ip)
+	}
+	if strings.HasPrefix(r.domain, ".") {
+		return strings.HasSuffix(host, r.domain)
+	}
+	return host == r.domain || strings.HasSuffix(host, "."+r.domain)
+}
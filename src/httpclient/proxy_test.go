@@ -0,0 +1,286 @@
+package httpclient
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxy_ProxyFor(t *testing.T) {
+	proxy, err := NewProxy("http://proxy.corp:3128").
+		WithHostProxy("*.partner.com", "http://partner-proxy.corp:3128").
+		WithHostProxy("legacy.example.com", "socks5://socks.corp:1080").
+		WithNoProxy("10.0.0.0/8", "192.168.1.10", ".internal", "example.org", "localhost:8080").
+		Build()
+	assert.NoError(t, err)
+
+	tt := []struct {
+		name     string
+		target   string
+		expected string
+	}{
+		{name: "default proxy", target: "https://example.com/users", expected: "http://proxy.corp:3128"},
+		{name: "host proxy by suffix", target: "https://api.partner.com", expected: "http://partner-proxy.corp:3128"},
+		{name: "host proxy by name", target: "http://legacy.example.com", expected: "socks5://socks.corp:1080"},
+		{name: "no proxy cidr", target: "http://10.1.2.3:8080", expected: ""},
+		{name: "no proxy ip", target: "http://192.168.1.10", expected: ""},
+		{name: "ip outside no proxy", target: "http://192.168.1.11", expected: "http://proxy.corp:3128"},
+		{name: "no proxy sub domain suffix", target: "https://svc.internal", expected: ""},
+		{name: "suffix doesn't match the bare domain", target: "https://internal", expected: "http://proxy.corp:3128"},
+		{name: "no proxy domain", target: "https://example.org", expected: ""},
+		{name: "no proxy domain matches sub domains", target: "https://www.example.org", expected: ""},
+		{name: "no proxy domain doesn't match other domains", target: "https://notexample.org",
+			expected: "http://proxy.corp:3128"},
+		{name: "no proxy with port", target: "http://localhost:8080", expected: ""},
+		{name: "no proxy with other port", target: "http://localhost:9090", expected: "http://proxy.corp:3128"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, tc.target, nil)
+			proxyURL, err := proxy.ProxyFor(req)
+			assert.NoError(t, err)
+			if tc.expected == "" {
+				assert.Nil(t, proxyURL)
+				return
+			}
+			assert.Equal(t, tc.expected, proxyURL.String())
+		})
+	}
+
+	t.Run("no proxy for all hosts", func(t *testing.T) {
+		proxy, _ := NewProxy("http://proxy.corp:3128").WithNoProxy("*").Build()
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		proxyURL, _ := proxy.ProxyFor(req)
+		assert.Nil(t, proxyURL)
+	})
+
+	t.Run("invalid proxies", func(t *testing.T) {
+		_, err := NewProxy("").Build()
+		assert.Error(t, err)
+		_, err = NewProxy("ftp://proxy.corp").Build()
+		assert.Error(t, err)
+		_, err = NewProxy("http://proxy.corp").WithAuth(cauth.NewBasicAuth("user", "")).Build()
+		assert.Error(t, err)
+		_, err = NewProxy("http://proxy.corp").WithNoProxy("").Build()
+		assert.Error(t, err)
+	})
+}
+
+// proxyStandIn is a forward proxy handling plain http requests and CONNECT tunnels,
+// it records the Proxy-Authorization header of each request
+type proxyStandIn struct {
+	mutex *sync.Mutex
+	auths []string
+}
+
+func (p *proxyStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mutex.Lock()
+	p.auths = append(p.auths, r.Header.Get("Proxy-Authorization"))
+	p.mutex.Unlock()
+
+	if r.Method != http.MethodConnect {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		w.Header().Set("X-Proxied", "true")
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	conn, _, _ := w.(http.Hijacker).Hijack()
+	go tunnel(conn, upstream)
+}
+
+func tunnel(a, b net.Conn) {
+	go func() {
+		_, _ = io.Copy(a, b)
+		_ = a.Close()
+	}()
+	_, _ = io.Copy(b, a)
+	_ = b.Close()
+}
+
+// serveSocks5 serves a minimal socks5 proxy requiring the given username and password
+func serveSocks5(t *testing.T, username, password string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	handle := func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		header := make([]byte, 2)
+		_, _ = io.ReadFull(r, header)
+		_, _ = io.ReadFull(r, make([]byte, header[1]))
+		// username and password authentication
+		_, _ = conn.Write([]byte{5, 2})
+		version, _ := r.ReadByte()
+		userLen, _ := r.ReadByte()
+		user := make([]byte, userLen)
+		_, _ = io.ReadFull(r, user)
+		passLen, _ := r.ReadByte()
+		pass := make([]byte, passLen)
+		_, _ = io.ReadFull(r, pass)
+		if version != 1 || string(user) != username || string(pass) != password {
+			_, _ = conn.Write([]byte{1, 1})
+			_ = conn.Close()
+			return
+		}
+		_, _ = conn.Write([]byte{1, 0})
+
+		// connect request
+		request := make([]byte, 4)
+		_, _ = io.ReadFull(r, request)
+		var host string
+		switch request[3] {
+		case 1:
+			ip := make([]byte, 4)
+			_, _ = io.ReadFull(r, ip)
+			host = net.IP(ip).String()
+		case 3:
+			n, _ := r.ReadByte()
+			name := make([]byte, n)
+			_, _ = io.ReadFull(r, name)
+			host = string(name)
+		}
+		port := make([]byte, 2)
+		_, _ = io.ReadFull(r, port)
+		upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+		if err != nil {
+			_, _ = conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+			_ = conn.Close()
+			return
+		}
+		_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		tunnel(&bufferedConn{Conn: conn, reader: r}, upstream)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// bufferedConn reads through the buffered reader of the connection
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func TestClient_Proxy(t *testing.T) {
+	standIn := &proxyStandIn{mutex: new(sync.Mutex)}
+	proxyServer := httptest.NewServer(standIn)
+	defer proxyServer.Close()
+
+	upstream := httptest.NewServer(protoHandler)
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	serverCert := newTestCert(t, dir, "server", ca, "127.0.0.1")
+	tlsUpstream := httptest.NewUnstartedServer(protoHandler)
+	tlsUpstream.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert.tlsCertificate()}}
+	tlsUpstream.StartTLS()
+	defer tlsUpstream.Close()
+
+	expectedAuth := "Basic " + "dXNlcjpwYXNzd29yZA=="
+
+	t.Run("plain http through the proxy", func(t *testing.T) {
+		proxy, _ := NewProxy(proxyServer.URL).WithAuth(cauth.NewBasicAuth("user", "password")).Build()
+		config, _ := NewConfig().WithProxy(proxy).Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+		caller, _ := NewCallerBuilder(client, upstream.URL, "users", GET).Build()
+		resp, err := caller.Call()
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, "true", resp.Header.Get("X-Proxied"))
+
+		standIn.mutex.Lock()
+		assert.Equal(t, expectedAuth, standIn.auths[len(standIn.auths)-1])
+		standIn.mutex.Unlock()
+	})
+
+	t.Run("https through a CONNECT tunnel", func(t *testing.T) {
+		proxy, _ := NewProxy(proxyServer.URL).WithAuth(cauth.NewBasicAuth("user", "password")).Build()
+		config, _ := NewConfig().WithProxy(proxy).WithCACertFiles(ca.certFile).Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+		assert.Contains(t, callBody(t, client, tlsUpstream.URL, "users"), "/users")
+		standIn.mutex.Lock()
+		assert.Equal(t, expectedAuth, standIn.auths[len(standIn.auths)-1])
+		standIn.mutex.Unlock()
+	})
+
+	t.Run("no proxy", func(t *testing.T) {
+		proxy, _ := NewProxy(proxyServer.URL).WithNoProxy("127.0.0.1").Build()
+		config, _ := NewConfig().WithProxy(proxy).Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+		caller, _ := NewCallerBuilder(client, upstream.URL, "users", GET).Build()
+		resp, err := caller.Call()
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, "", resp.Header.Get("X-Proxied"))
+	})
+
+	t.Run("socks5", func(t *testing.T) {
+		socksAddr := serveSocks5(t, "user", "password")
+		proxy, _ := NewProxy("socks5://" + socksAddr).WithAuth(cauth.NewBasicAuth("user", "password")).Build()
+		config, _ := NewConfig().WithProxy(proxy).Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+		assert.Equal(t, "HTTP/1.1 /users", callBody(t, client, upstream.URL, "users"))
+
+		proxy, _ = NewProxy("socks5://" + socksAddr).WithAuth(cauth.NewBasicAuth("user", "wrong")).Build()
+		config, _ = NewConfig().WithProxy(proxy).Build()
+		client, _ = NewClient(config, &http.Client{}, cauth.NoAuth)
+		caller, _ := NewCallerBuilder(client, upstream.URL, "users", GET).Build()
+		_, err := caller.Call()
+		assert.Error(t, err)
+	})
+
+	t.Run("unix sockets are never proxied", func(t *testing.T) {
+		socketPath := dir + "/proxy.sock"
+		serveUnixSocket(t, socketPath, "socket")
+		proxyURL, _ := url.Parse(proxyServer.URL)
+		config, _ := NewConfig().WithProxyURL(proxyURL).Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+		assert.Equal(t, "socket localhost /ping", callBody(t, client, "unix://"+socketPath, "ping"))
+	})
+}
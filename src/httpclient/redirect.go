@@ -0,0 +1,223 @@
+package httpclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrTooManyRedirects is returned when the redirect chain exceeds the max hops of the RedirectPolicy
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrRedirectNotAllowed is returned when the redirect target is rejected by the RedirectPolicy
+	ErrRedirectNotAllowed = errors.New("redirect not allowed")
+)
+
+// RedirectMethodRule defines which method is used to follow a redirect status
+type RedirectMethodRule int
+
+const (
+	// KeepMethod resends the request with the same method and body
+	KeepMethod RedirectMethodRule = iota
+	// PostToGet switches POST requests to GET without a body, other methods are kept
+	PostToGet
+	// ToGet switches all the methods but HEAD to GET without a body
+	ToGet
+)
+
+// defaultRedirectMaxHops is the max number of followed redirects, the same as net/http
+const defaultRedirectMaxHops = 10
+
+// RedirectPolicy controls how redirects are followed, built using RedirectPolicyBuilder
+type RedirectPolicy struct {
+	maxHops        int
+	sameHostOnly   bool
+	allowedSchemes []string
+	forwardAuth    bool
+	methodRules    map[int]RedirectMethodRule
+}
+
+// RedirectPolicyBuilder builds the RedirectPolicy
+type RedirectPolicyBuilder struct {
+	maxHops        int
+	sameHostOnly   bool
+	allowedSchemes []string
+	forwardAuth    bool
+	methodRules    map[int]RedirectMethodRule
+}
+
+// NewRedirectPolicy creates a RedirectPolicyBuilder with the defaults: 10 hops, any http or https host,
+// the auth header is never re-sent to other hosts, 301 and 302 switch POST to GET,
+// 303 switches to GET and 307 and 308 keep the method
+func NewRedirectPolicy() *RedirectPolicyBuilder {
+	return &RedirectPolicyBuilder{
+		maxHops:        defaultRedirectMaxHops,
+		allowedSchemes: []string{"http", "https"},
+		methodRules: map[int]RedirectMethodRule{
+			http.StatusMovedPermanently:  PostToGet,
+			http.StatusFound:             PostToGet,
+			http.StatusSeeOther:          ToGet,
+			http.StatusTemporaryRedirect: KeepMethod,
+			http.StatusPermanentRedirect: KeepMethod,
+		},
+	}
+}
+
+// WithMaxHops set the max number of followed redirects, 0 returns the redirect responses as they are
+func (b *RedirectPolicyBuilder) WithMaxHops(maxHops int) *RedirectPolicyBuilder {
+	b.maxHops = maxHops
+	return b
+}
+
+// WithSameHostOnly only follow redirects to the host of the original request
+func (b *RedirectPolicyBuilder) WithSameHostOnly(sameHostOnly bool) *RedirectPolicyBuilder {
+	b.sameHostOnly = sameHostOnly
+	return b
+}
+
+// WithAllowedSchemes only follow redirects to the given schemes
+func (b *RedirectPolicyBuilder) WithAllowedSchemes(schemes ...string) *RedirectPolicyBuilder {
+	b.allowedSchemes = schemes
+	return b
+}
+
+// WithForwardAuth re-send the auth header e.g. Authorization or x-api-key when redirected to another host,
+// the Cookie and Proxy-Authorization headers are never re-sent to another host
+func (b *RedirectPolicyBuilder) WithForwardAuth(forwardAuth bool) *RedirectPolicyBuilder {
+	b.forwardAuth = forwardAuth
+	return b
+}
+
+// WithMethodRule set the method rule of a redirect status
+func (b *RedirectPolicyBuilder) WithMethodRule(status int, rule RedirectMethodRule) *RedirectPolicyBuilder {
+	b.methodRules[status] = rule
+	return b
+}
+
+// Build validates the RedirectPolicy
+func (b *RedirectPolicyBuilder) Build() (*RedirectPolicy, error) {
+	if b.maxHops < 0 {
+		return nil, errors.New("redirect max hops can't be negative")
+	}
+	if len(b.allowedSchemes) == 0 {
+		return nil, errors.New("redirect allowed schemes can't be empty")
+	}
+	for status, rule := range b.methodRules {
+		if status < 300 || status > 399 {
+			return nil, fmt.Errorf("invalid redirect status %d", status)
+		}
+		if rule < KeepMethod || rule > ToGet {
+			return nil, fmt.Errorf("invalid redirect method rule %d", rule)
+		}
+	}
+	return (*RedirectPolicy)(b), nil
+}
+
+// RedirectChain returns the urls of the followed redirects, starting with the original request url
+// and ending with the url of the final response
+func RedirectChain(resp *http.Response) []*url.URL {
+	chain := make([]*url.URL, 0)
+	for r := resp; r != nil && r.Request != nil; r = r.Request.Response {
+		chain = append([]*url.URL{r.Request.URL}, chain...)
+	}
+	return chain
+}
+
+// isSchemeAllowed reports whether redirects to the scheme are followed
+func (p *RedirectPolicy) isSchemeAllowed(scheme string) bool {
+	for _, allowed := range p.allowedSchemes {
+		if strings.EqualFold(allowed, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// followRedirects follows the redirect responses according to the policy, each new request
+// references the redirect response which caused it through its Response field
+func (c *Caller) followRedirects(req *http.Request, resp *http.Response, body []byte, authKey string) (*http.Response, error) {
+	policy := c.client.config.redirectPolicy
+	origin := req.URL
+
+	for hops := 0; ; hops++ {
+		rule, isRedirect := policy.methodRules[resp.StatusCode]
+		location := resp.Header.Get("Location")
+		if !isRedirect || location == "" || policy.maxHops == 0 {
+			return resp, nil
+		}
+		if hops == policy.maxHops {
+			DrainAndClose(resp.Body)
+			return nil, fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, hops)
+		}
+
+		target, err := req.URL.Parse(location)
+		if err != nil {
+			DrainAndClose(resp.Body)
+			return nil, fmt.Errorf("malformed redirect location %q: %w", location, err)
+		}
+		if !policy.isSchemeAllowed(target.Scheme) {
+			DrainAndClose(resp.Body)
+			return nil, fmt.Errorf("%w: scheme of %s", ErrRedirectNotAllowed, target.Redacted())
+		}
+		// the host of the previous hop, a redirect back to the origin host is another cross host hop
+		crossHost := !strings.EqualFold(target.Host, req.URL.Host)
+		if policy.sameHostOnly && !strings.EqualFold(target.Host, origin.Host) {
+			DrainAndClose(resp.Body)
+			return nil, fmt.Errorf("%w: %s is not on the same host", ErrRedirectNotAllowed, target.Redacted())
+		}
+
+		next := req.Clone(req.Context())
+		next.URL = target
+		next.Host = ""
+		next.Response = resp
+		if crossHost && c.socketPath != "" {
+			// the unix socket only serves the original host
+			next = next.WithContext(withUnixSocket(req.Context(), ""))
+		} else if c.socketPath != "" {
+			next.Host = req.Host
+		}
+		// the jar adds its cookies to every request, the ones it added to the previous request are removed
+		if crossHost || c.client.config.cookieJar != nil {
+			next.Header.Del("Cookie")
+		}
+		if crossHost {
+			next.Header.Del("Proxy-Authorization")
+		}
+		if crossHost && !policy.forwardAuth {
+			next.Header.Del("Authorization")
+			if authKey != "" {
+				next.Header.Del(authKey)
+			}
+		}
+
+		keepBody := rule == KeepMethod ||
+			(rule == PostToGet && req.Method != http.MethodPost) ||
+			(rule == ToGet && req.Method == http.MethodHead)
+		if keepBody {
+			next.Body = io.NopCloser(bytes.NewReader(body))
+			next.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		} else {
+			next.Method = http.MethodGet
+			next.Body = nil
+			next.GetBody = nil
+			next.ContentLength = 0
+			for _, header := range []string{"Content-Type", "Content-Encoding", "Content-Length"} {
+				next.Header.Del(header)
+			}
+			body = nil
+		}
+
+		DrainAndClose(resp.Body)
+		resp, err = c.client.client.Do(next)
+		if err != nil {
+			return nil, err
+		}
+		req = next
+	}
+}
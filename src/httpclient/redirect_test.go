@@ -0,0 +1,160 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaller_Redirects(t *testing.T) {
+	// echo replies with the method, body and auth headers it received, and the cookie and proxy auth if any
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		reply := r.Method + " " + string(body) + " " + r.Header.Get("x-api-key")
+		for _, header := range []string{"Cookie", "Proxy-Authorization"} {
+			if value := r.Header.Get(header); value != "" {
+				reply += " " + value
+			}
+		}
+		_, _ = w.Write([]byte(reply))
+	}
+	// other echoes, except /back which redirects to the final route of origin
+	var originURL string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/back" {
+			http.Redirect(w, r, originURL+"/final", http.StatusTemporaryRedirect)
+			return
+		}
+		echo(w, r)
+	}))
+	defer other.Close()
+
+	// origin redirects /redirect/{status} to the final route, /cross to the other server, /bounce to the other
+	// server which redirects back and /loop to itself
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/final":
+			echo(w, r)
+		case r.URL.Path == "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case r.URL.Path == "/cross":
+			http.Redirect(w, r, other.URL+"/final", http.StatusTemporaryRedirect)
+		case r.URL.Path == "/bounce":
+			http.Redirect(w, r, other.URL+"/back", http.StatusTemporaryRedirect)
+		default:
+			status, _ := strconv.Atoi(r.URL.Path[len("/redirect/"):])
+			http.Redirect(w, r, "/final", status)
+		}
+	}))
+	defer origin.Close()
+	originURL = origin.URL
+
+	// credentials are the headers which are never re-sent to another host
+	credentials := map[string]string{"Cookie": "session=1", "Proxy-Authorization": "Basic cHJveHk="}
+	call := func(t *testing.T, policy *RedirectPolicyBuilder, route string, method HttpMethod,
+		headers ...map[string]string) (*http.Response, string, error) {
+		builder := NewConfig()
+		if policy != nil {
+			p, err := policy.Build()
+			assert.NoError(t, err)
+			builder.WithRedirectPolicy(p)
+		}
+		config, _ := builder.Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NewAPIKey("secret"))
+		callerBuilder := NewCallerBuilder(client, origin.URL, route, method).WithRequestBody([]byte("payload"))
+		for _, h := range headers {
+			callerBuilder.WithHeaders(h)
+		}
+		caller, _ := callerBuilder.Build()
+		resp, err := caller.Call()
+		if err != nil {
+			return nil, "", err
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body), nil
+	}
+
+	tt := []struct {
+		name     string
+		policy   *RedirectPolicyBuilder
+		route    string
+		method   HttpMethod
+		headers  map[string]string
+		expected string
+	}{
+		{name: "302 switches POST to GET", route: "redirect/302", method: POST, expected: "GET  secret"},
+		{name: "301 keeps PUT", route: "redirect/301", method: PUT, expected: "PUT payload secret"},
+		{name: "303 switches to GET", route: "redirect/303", method: PUT, expected: "GET  secret"},
+		{name: "307 keeps POST and body", route: "redirect/307", method: POST, expected: "POST payload secret"},
+		{name: "308 keeps PATCH and body", route: "redirect/308", method: PATCH, expected: "PATCH payload secret"},
+		{name: "custom method rule", policy: NewRedirectPolicy().WithMethodRule(http.StatusFound, KeepMethod),
+			route: "redirect/302", method: POST, expected: "POST payload secret"},
+		{name: "auth is stripped across hosts", route: "cross", method: GET, expected: "GET payload "},
+		{name: "auth is forwarded when allowed", policy: NewRedirectPolicy().WithForwardAuth(true),
+			route: "cross", method: GET, expected: "GET payload secret"},
+		{name: "credentials are kept on the same host", route: "redirect/307", method: GET, headers: credentials,
+			expected: "GET payload secret session=1 Basic cHJveHk="},
+		{name: "credentials are stripped across hosts", policy: NewRedirectPolicy().WithForwardAuth(true),
+			route: "cross", method: GET, headers: credentials, expected: "GET payload secret"},
+		{name: "credentials are stripped when redirected back", route: "bounce", method: GET, headers: credentials,
+			expected: "GET payload "},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body, err := call(t, tc.policy, tc.route, tc.method, tc.headers)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.expected, body)
+		})
+	}
+
+	t.Run("redirect chain", func(t *testing.T) {
+		resp, _, err := call(t, nil, "redirect/302", GET)
+		assert.NoError(t, err)
+		chain := RedirectChain(resp)
+		assert.Len(t, chain, 2)
+		assert.Equal(t, origin.URL+"/redirect/302", chain[0].String())
+		assert.Equal(t, origin.URL+"/final", chain[1].String())
+		assert.Equal(t, http.StatusFound, resp.Request.Response.StatusCode)
+	})
+
+	t.Run("too many redirects", func(t *testing.T) {
+		_, _, err := call(t, NewRedirectPolicy().WithMaxHops(3), "loop", GET)
+		assert.True(t, errors.Is(err, ErrTooManyRedirects))
+	})
+
+	t.Run("redirects not followed", func(t *testing.T) {
+		resp, _, err := call(t, NewRedirectPolicy().WithMaxHops(0), "redirect/302", GET)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+	})
+
+	t.Run("same host only", func(t *testing.T) {
+		_, _, err := call(t, NewRedirectPolicy().WithSameHostOnly(true), "cross", GET)
+		assert.True(t, errors.Is(err, ErrRedirectNotAllowed))
+	})
+
+	t.Run("scheme not allowed", func(t *testing.T) {
+		_, _, err := call(t, NewRedirectPolicy().WithAllowedSchemes("https"), "redirect/302", GET)
+		assert.True(t, errors.Is(err, ErrRedirectNotAllowed))
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		_, err := NewRedirectPolicy().WithMaxHops(-1).Build()
+		assert.Error(t, err)
+		_, err = NewRedirectPolicy().WithMethodRule(200, KeepMethod).Build()
+		assert.Error(t, err)
+		_, err = NewRedirectPolicy().WithAllowedSchemes().Build()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,155 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// ErrClientNotFound is returned when the registry has no client of the given name
+var ErrClientNotFound = errors.New("client not found")
+
+// Registry holds the named Clients of a config file, built using RegistryBuilder
+type Registry struct {
+	path      string
+	envPrefix string
+	lookupEnv func(string) (string, bool)
+
+	clients map[string]*Client
+	hosts   map[string]string
+}
+
+// RegistryBuilder builds the Registry
+type RegistryBuilder struct {
+	path      string
+	envPrefix string
+	lookupEnv func(string) (string, bool)
+}
+
+// NewRegistry creates a RegistryBuilder loading the clients of the JSON or YAML config file at path,
+// the values of the file are overridden by the environment variables prefixed by DefaultEnvPrefix
+func NewRegistry(path string) *RegistryBuilder {
+	return &RegistryBuilder{
+		path:      path,
+		envPrefix: DefaultEnvPrefix,
+		lookupEnv: os.LookupEnv,
+	}
+}
+
+// WithEnvPrefix set the prefix of the environment variables overriding the config file,
+// an empty prefix disables the overrides
+func (b *RegistryBuilder) WithEnvPrefix(prefix string) *RegistryBuilder {
+	b.envPrefix = prefix
+	return b
+}
+
+// WithLookupEnv set how the environment variables, including the secret references, are looked up
+func (b *RegistryBuilder) WithLookupEnv(lookupEnv func(string) (string, bool)) *RegistryBuilder {
+	b.lookupEnv = lookupEnv
+	return b
+}
+
+// Build loads the config file, validates every client and creates them, the validation errors
+// are ConfigErrors pointing at the invalid keys
+func (b *RegistryBuilder) Build() (*Registry, error) {
+	if b.path == "" {
+		return nil, errors.New("config file path is empty")
+	}
+	if b.lookupEnv == nil {
+		return nil, errors.New("lookup env func is not defined")
+	}
+	file, err := LoadConfigFile(b.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Clients) == 0 {
+		return nil, &ConfigError{Key: "clients", Err: errors.New("no client is defined")}
+	}
+	if b.envPrefix != "" {
+		if err := file.applyEnv(b.envPrefix, b.lookupEnv); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(file.Clients))
+	for name := range file.Clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs ConfigErrors
+	clients := make(map[string]*Client, len(names))
+	hosts := make(map[string]string, len(names))
+	for _, name := range names {
+		key := "clients." + name
+		clientConfig := file.Clients[name]
+		if clientConfig == nil {
+			errs = append(errs, &ConfigError{Key: key, Err: errors.New("is empty")})
+			continue
+		}
+		builder, auth, err := clientConfig.configBuilder(key, b.lookupEnv)
+		var clientErrs ConfigErrors
+		if errors.As(err, &clientErrs) {
+			errs = append(errs, clientErrs...)
+			continue
+		}
+		config, err := builder.Build()
+		if err == nil {
+			clients[name], err = NewClient(config, &http.Client{}, auth)
+		}
+		if err != nil {
+			errs = append(errs, &ConfigError{Key: key, Err: err})
+			continue
+		}
+		hosts[name] = clientConfig.BaseURL
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &Registry{
+		path:      b.path,
+		envPrefix: b.envPrefix,
+		lookupEnv: b.lookupEnv,
+		clients:   clients,
+		hosts:     hosts,
+	}, nil
+}
+
+// Names returns the sorted names of the clients
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.clients))
+	for name := range r.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Client returns the client of the given name
+func (r *Registry) Client(name string) (*Client, error) {
+	client, ok := r.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrClientNotFound, name)
+	}
+	return client, nil
+}
+
+// BaseURL returns the base url of the client of the given name
+func (r *Registry) BaseURL(name string) (string, error) {
+	host, ok := r.hosts[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrClientNotFound, name)
+	}
+	return host, nil
+}
+
+// Caller creates a CallerBuilder calling the route relative to the base url of the client of the given name
+func (r *Registry) Caller(name, route string, method HttpMethod) (*CallerBuilder, error) {
+	client, err := r.Client(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewCallerBuilder(client, r.hosts[name], route, method), nil
+}
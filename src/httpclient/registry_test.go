@@ -0,0 +1,152 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Build(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path + " " + r.Header.Get("Authorization") + " " + r.Header.Get("X-Team")))
+	}))
+	defer server.Close()
+
+	path := writeConfigFile(t, "clients.yaml", `
+clients:
+  payments:
+    baseURL: https://payments.example.com
+    timeout: 5s
+    headers:
+      X-Team: billing
+    auth:
+      type: jwt
+      token: env:PAYMENTS_TOKEN
+  search:
+    baseURL: https://search.example.com
+`)
+	env := map[string]string{
+		"PAYMENTS_TOKEN":               "t0ken",
+		"HTTPCLIENT_PAYMENTS_BASE_URL": server.URL,
+	}
+	registry, err := NewRegistry(path).WithLookupEnv(mapEnv(env)).Build()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"payments", "search"}, registry.Names())
+
+	host, err := registry.BaseURL("payments")
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL, host)
+
+	builder, err := registry.Caller("payments", "charges", GET)
+	if !assert.NoError(t, err) {
+		return
+	}
+	caller, err := builder.Build()
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp, err := caller.CallWithContext(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "/charges Bearer t0ken billing", string(body))
+
+	_, err = registry.Client("orders")
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+	_, err = registry.BaseURL("orders")
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+	_, err = registry.Caller("orders", "", GET)
+	assert.True(t, errors.Is(err, ErrClientNotFound))
+
+	// the overrides are disabled without a prefix
+	registry, err = NewRegistry(path).WithEnvPrefix("").WithLookupEnv(mapEnv(env)).Build()
+	assert.NoError(t, err)
+	host, _ = registry.BaseURL("payments")
+	assert.Equal(t, "https://payments.example.com", host)
+
+	// a failed reload leaves the registry as it is
+	registryBuilder := NewRegistry(path).WithLookupEnv(mapEnv(env))
+	registry, _ = registryBuilder.Build()
+	if err := os.WriteFile(path, []byte("clients:\n  orders:\n    timeout: soon\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = registryBuilder.Build()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"payments", "search"}, registry.Names())
+	host, _ = registry.BaseURL("payments")
+	assert.Equal(t, server.URL, host)
+}
+
+func TestRegistry_BuildErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		env      map[string]string
+		wantKeys []string
+	}{
+		{
+			name: "invalid clients",
+			content: `
+clients:
+  payments:
+    baseURL: https://payments.example.com
+    timeout: soon
+    auth:
+      type: jwt
+      token: env:PAYMENTS_TOKEN
+  search:
+    pool:
+      maxConnsPerHost: -1
+`,
+			wantKeys: []string{
+				"clients.payments.timeout",
+				"clients.payments.auth.token",
+				"clients.search.baseURL",
+				"clients.search.pool.maxConnsPerHost",
+			},
+		},
+		{
+			name:     "invalid env override",
+			content:  "clients:\n  payments:\n    baseURL: https://payments.example.com\n",
+			env:      map[string]string{"HTTPCLIENT_PAYMENTS_RETRIES": "many"},
+			wantKeys: []string{"HTTPCLIENT_PAYMENTS_RETRIES"},
+		},
+		{
+			name:     "invalid client config",
+			content:  "clients:\n  payments:\n    baseURL: https://payments.example.com\n    tls:\n      caFiles: [missing.pem]\n",
+			wantKeys: []string{"clients.payments.tls.caFiles[0]"},
+		},
+		{
+			name:     "empty client",
+			content:  "clients:\n  payments:\n",
+			wantKeys: []string{"clients.payments"},
+		},
+		{
+			name:     "no clients",
+			content:  "clients: {}\n",
+			wantKeys: []string{"clients"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, "clients.yaml", tt.content)
+			_, err := NewRegistry(path).WithLookupEnv(mapEnv(tt.env)).Build()
+			assert.Equal(t, tt.wantKeys, configErrorKeys(err))
+		})
+	}
+
+	_, err := NewRegistry("").Build()
+	assert.Error(t, err)
+	_, err = NewRegistry(writeConfigFile(t, "clients.yaml", "clients: [")).Build()
+	assert.Error(t, err)
+}
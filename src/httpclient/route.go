@@ -0,0 +1,115 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ErrMissingPathParam is returned at Build time when the route template references an undefined path param
+var ErrMissingPathParam = errors.New("missing path param")
+
+// buildEndpoint joins the host, which may carry a base path, with the route template
+// e.g. https://example.com/api + users/{id} => https://example.com/api/users/42.
+// for unix:///path/to/socket hosts the socket path is returned as well
+func buildEndpoint(host, route string, params map[string]string) (*url.URL, string, error) {
+	endpoint, socketPath, err := parseHost(host)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// a query string on the route is kept and merged with the query params at call time
+	rawQuery := ""
+	if idx := strings.Index(route, "?"); idx != -1 {
+		route, rawQuery = route[:idx], route[idx+1:]
+		if _, err := url.ParseQuery(rawQuery); err != nil {
+			return nil, "", fmt.Errorf("malformed route query %q: %w", rawQuery, err)
+		}
+	}
+
+	routePath, err := expandRoute(route, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	basePath := strings.TrimRight(endpoint.EscapedPath(), "/")
+	escapedPath := basePath + "/" + strings.TrimLeft(routePath, "/")
+	path, err := url.PathUnescape(escapedPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("malformed route %q: %w", route, err)
+	}
+	endpoint.Path = path
+	endpoint.RawPath = escapedPath
+	endpoint.RawQuery = rawQuery
+	return endpoint, socketPath, nil
+}
+
+// parseHost validates the host which must be an absolute http(s) url or a unix:// socket path
+func parseHost(host string) (*url.URL, string, error) {
+	endpoint, err := url.Parse(host)
+	if err != nil {
+		return nil, "", fmt.Errorf("malformed host %q: %w", host, err)
+	}
+	if endpoint.Scheme == "unix" {
+		socketPath, err := unixSocketPath(endpoint)
+		if err != nil {
+			return nil, "", err
+		}
+		return &url.URL{Scheme: "http", Host: unixSocketHost(socketPath)}, socketPath, nil
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, "", fmt.Errorf("malformed host %q: scheme must be http, https or unix", host)
+	}
+	if endpoint.Host == "" {
+		return nil, "", fmt.Errorf("malformed host %q: missing host name", host)
+	}
+	if endpoint.RawQuery != "" || endpoint.Fragment != "" {
+		return nil, "", fmt.Errorf("malformed host %q: query and fragment are not allowed", host)
+	}
+	return endpoint, "", nil
+}
+
+// expandRoute replaces the {name} placeholders in the route with the escaped path params
+func expandRoute(route string, params map[string]string) (string, error) {
+	var sb strings.Builder
+	missing := make([]string, 0)
+
+	for {
+		start := strings.Index(route, "{")
+		end := strings.Index(route, "}")
+		if start == -1 {
+			if end != -1 {
+				return "", fmt.Errorf("malformed route template: unbalanced braces in %q", route)
+			}
+			sb.WriteString(route)
+			break
+		}
+		if end < start {
+			return "", fmt.Errorf("malformed route template: unbalanced braces in %q", route)
+		}
+		name := route[start+1 : end]
+		if name == "" || strings.ContainsAny(name, "{/") {
+			return "", fmt.Errorf("malformed route template: invalid path param %q", name)
+		}
+
+		sb.WriteString(route[:start])
+		value, ok := params[name]
+		if !ok || value == "" {
+			missing = append(missing, name)
+		}
+		// PathEscape keeps the dot segments which would move the request to another resource
+		if value == "." || value == ".." {
+			return "", fmt.Errorf("invalid path param %q: %q is a dot segment", name, value)
+		}
+		sb.WriteString(url.PathEscape(value))
+		route = route[end+1:]
+	}
+
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return "", fmt.Errorf("%w: %s", ErrMissingPathParam, strings.Join(missing, ", "))
+	}
+	return sb.String(), nil
+}
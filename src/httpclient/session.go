@@ -0,0 +1,130 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// LoginFunc logs in using the client, the session cookies it receives are stored in the client cookie jar
+type LoginFunc func(ctx context.Context, client *Client) error
+
+// Session logs in once and logs in again when the session expires, built using SessionBuilder
+type Session struct {
+	client  *Client
+	login   LoginFunc
+	expired func(*http.Response) bool
+
+	mutex      *sync.Mutex
+	loggedIn   bool
+	generation uint64
+}
+
+// SessionBuilder builds the Session
+type SessionBuilder struct {
+	client  *Client
+	login   LoginFunc
+	expired func(*http.Response) bool
+
+	mutex      *sync.Mutex
+	loggedIn   bool
+	generation uint64
+}
+
+// NewSession creates a SessionBuilder logging in using the login callback,
+// by default a 401 Unauthorized response means that the session expired
+func NewSession(client *Client, login LoginFunc) *SessionBuilder {
+	return &SessionBuilder{
+		client: client,
+		login:  login,
+		expired: func(resp *http.Response) bool {
+			return resp.StatusCode == http.StatusUnauthorized
+		},
+		mutex: new(sync.Mutex),
+	}
+}
+
+// WithExpiryCheck set how an expired session is detected from a response e.g. a redirect to the login page
+func (b *SessionBuilder) WithExpiryCheck(expired func(*http.Response) bool) *SessionBuilder {
+	b.expired = expired
+	return b
+}
+
+// Build validates the Session, the client must have a cookie jar to keep the session cookies
+func (b *SessionBuilder) Build() (*Session, error) {
+	if b.client == nil {
+		return nil, errors.New("client is empty")
+	}
+	if b.client.Jar() == nil {
+		return nil, errors.New("client has no cookie jar, see ConfigBuilder.WithCookieJar")
+	}
+	if b.login == nil {
+		return nil, errors.New("login func is not defined")
+	}
+	if b.expired == nil {
+		return nil, errors.New("expiry check is not defined")
+	}
+	return (*Session)(b), nil
+}
+
+// Login logs in unless already logged in
+func (s *Session) Login(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.loggedIn {
+		return nil
+	}
+	return s.doLogin(ctx)
+}
+
+// Invalidate forces logging in again before the next call
+func (s *Session) Invalidate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loggedIn = false
+}
+
+// Call logs in if needed and calls the caller, which should use the session client.
+// if the session expired it logs in again and retries the call once
+func (s *Session) Call(ctx context.Context, caller *Caller) (*http.Response, error) {
+	if err := s.Login(ctx); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	generation := s.generation
+	s.mutex.Unlock()
+
+	resp, err := caller.CallWithContext(ctx)
+	if err != nil || !s.expired(resp) {
+		return resp, err
+	}
+	DrainAndClose(resp.Body)
+
+	if err := s.relogin(ctx, generation); err != nil {
+		return nil, err
+	}
+	return caller.CallWithContext(ctx)
+}
+
+// relogin logs in again unless another call already did since the given generation
+func (s *Session) relogin(ctx context.Context, generation uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.loggedIn && s.generation != generation {
+		return nil
+	}
+	return s.doLogin(ctx)
+}
+
+// doLogin calls the login callback, the mutex must be held
+func (s *Session) doLogin(ctx context.Context) error {
+	s.loggedIn = false
+	if err := s.login(ctx, s.client); err != nil {
+		return fmt.Errorf("session login failed: %w", err)
+	}
+	s.loggedIn = true
+	s.generation++
+	return nil
+}
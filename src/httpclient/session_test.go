@@ -0,0 +1,117 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession_Call(t *testing.T) {
+	// the server issues a new session on each login and expires all the sessions on /expire
+	var (
+		mutex   sync.Mutex
+		current string
+		logins  int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r.URL.Path {
+		case "/login":
+			current = "session-" + strconv.Itoa(int(atomic.AddInt32(&logins, 1)))
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: current, Path: "/"})
+		case "/expire":
+			current = ""
+		default:
+			cookie, err := r.Cookie("session")
+			if err != nil || cookie.Value != current {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(cookie.Value))
+		}
+	}))
+	defer server.Close()
+
+	jar, _ := NewCookieJar("")
+	config, _ := NewConfig().WithCookieJar(jar).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+	login := func(ctx context.Context, client *Client) error {
+		caller, err := NewCallerBuilder(client, server.URL, "login", POST).Build()
+		if err != nil {
+			return err
+		}
+		resp, err := caller.CallWithContext(ctx)
+		if err != nil {
+			return err
+		}
+		DrainAndClose(resp.Body)
+		return nil
+	}
+	session, err := NewSession(client, login).Build()
+	assert.NoError(t, err)
+
+	call := func() string {
+		caller, _ := NewCallerBuilder(client, server.URL, "data", GET).Build()
+		resp, err := session.Call(context.Background(), caller)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	t.Run("logs in once", func(t *testing.T) {
+		assert.Equal(t, "session-1", call())
+		assert.Equal(t, "session-1", call())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&logins))
+	})
+
+	t.Run("logs in again when expired", func(t *testing.T) {
+		assert.Equal(t, "", callBody(t, client, server.URL, "expire"))
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.Equal(t, "session-2", call())
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(2), atomic.LoadInt32(&logins))
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		session.Invalidate()
+		assert.Equal(t, "session-3", call())
+	})
+
+	t.Run("login failure", func(t *testing.T) {
+		failing, _ := NewSession(client, func(context.Context, *Client) error {
+			return errors.New("bad credentials")
+		}).Build()
+		caller, _ := NewCallerBuilder(client, server.URL, "data", GET).Build()
+		_, err := failing.Call(context.Background(), caller)
+		assert.Error(t, err)
+	})
+
+	t.Run("client without a cookie jar", func(t *testing.T) {
+		config, _ := NewConfig().Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+		_, err := NewSession(client, login).Build()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,258 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCertificatePinMismatch is returned when none of the server certificates matches the pinned public keys
+var ErrCertificatePinMismatch = errors.New("server certificate doesn't match the pinned public keys")
+
+// tlsOptions holds the TLS settings of the Config
+type tlsOptions struct {
+	caFiles        []string
+	certFile       string
+	keyFile        string
+	minVersion     uint16
+	cipherSuites   []uint16
+	serverName     string
+	pins           []string
+	reloadInterval time.Duration
+}
+
+// isSet reports whether any TLS setting is configured
+func (o *tlsOptions) isSet() bool {
+	return len(o.caFiles) != 0 || o.certFile != "" || o.minVersion != 0 || len(o.cipherSuites) != 0 ||
+		o.serverName != "" || len(o.pins) != 0
+}
+
+// validate checks the TLS settings and makes sure the certificate files can be loaded
+func (o *tlsOptions) validate() error {
+	if (o.certFile == "") != (o.keyFile == "") {
+		return errors.New("client certificate and key files must be set together")
+	}
+	if o.reloadInterval < 0 {
+		return errors.New("certificate reload interval can't be negative")
+	}
+	if _, err := o.parsePins(); err != nil {
+		return err
+	}
+	_, err := newCertReloader(o)
+	return err
+}
+
+// parsePins decodes the pinned public key hashes
+func (o *tlsOptions) parsePins() ([][]byte, error) {
+	pins := make([][]byte, 0, len(o.pins))
+	for _, pin := range o.pins {
+		hash, err := parsePin(pin)
+		if err != nil {
+			return nil, err
+		}
+		pins = append(pins, hash)
+	}
+	return pins, nil
+}
+
+// parsePin decodes a base64 SPKI sha256 hash optionally prefixed by sha256/
+func parsePin(pin string) ([]byte, error) {
+	hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/"))
+	if err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("invalid public key pin %q: expected base64 encoded sha256 hash", pin)
+	}
+	return hash, nil
+}
+
+// SPKIHash returns the base64 sha256 hash of the certificate public key as used by the pinning config
+func SPKIHash(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// newTLSConfig creates the transport TLS config.
+// when CA files are set, verification is done by VerifyConnection against the current CA pool
+// so that rotated CA bundles are picked up without recreating the client
+func newTLSConfig(o *tlsOptions) (*tls.Config, error) {
+	pins, err := o.parsePins()
+	if err != nil {
+		return nil, err
+	}
+	reloader, err := newCertReloader(o)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &tls.Config{
+		MinVersion:   o.minVersion,
+		CipherSuites: o.cipherSuites,
+		ServerName:   o.serverName,
+	}
+	if conf.MinVersion == 0 {
+		conf.MinVersion = tls.VersionTLS12
+	}
+	if o.certFile != "" {
+		conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.clientCertificate(), nil
+		}
+	}
+	if len(o.caFiles) == 0 && len(o.pins) == 0 {
+		return conf, nil
+	}
+
+	// the default verification is replaced, VerifyConnection does the full chain verification
+	conf.InsecureSkipVerify = len(o.caFiles) != 0
+	conf.VerifyConnection = func(cs tls.ConnectionState) error {
+		chains := cs.VerifiedChains
+		if len(o.caFiles) != 0 {
+			var err error
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server didn't present a certificate")
+			}
+			intermediates := x509.NewCertPool()
+			for _, cert := range cs.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+			chains, err = cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+				DNSName:       cs.ServerName,
+				Roots:         reloader.rootCAs(),
+				Intermediates: intermediates,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return verifyPins(pins, chains)
+	}
+	return conf, nil
+}
+
+// verifyPins succeeds if any certificate of the verified chains matches one of the pins
+func verifyPins(pins [][]byte, chains [][]*x509.Certificate) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(pin, hash[:]) {
+					return nil
+				}
+			}
+		}
+	}
+	return ErrCertificatePinMismatch
+}
+
+// certReloader holds the CA pool and client certificate and reloads them when the files change on disk
+type certReloader struct {
+	options   *tlsOptions
+	mutex     *sync.Mutex
+	lastCheck time.Time
+	modTimes  map[string]time.Time
+	pool      *x509.CertPool
+	cert      *tls.Certificate
+}
+
+func newCertReloader(o *tlsOptions) (*certReloader, error) {
+	r := &certReloader{
+		options:  o,
+		mutex:    new(sync.Mutex),
+		modTimes: make(map[string]time.Time),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// rootCAs returns the current CA pool
+func (r *certReloader) rootCAs() *x509.CertPool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reloadIfChanged()
+	return r.pool
+}
+
+// clientCertificate returns the current client certificate
+func (r *certReloader) clientCertificate() *tls.Certificate {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reloadIfChanged()
+	return r.cert
+}
+
+// reloadIfChanged reloads the files, at most once per reload interval, if any of them was modified.
+// a failed reload keeps the previously loaded certificates
+func (r *certReloader) reloadIfChanged() {
+	if r.options.reloadInterval <= 0 || time.Since(r.lastCheck) < r.options.reloadInterval {
+		return
+	}
+	r.lastCheck = time.Now()
+	for file, modTime := range r.modTimes {
+		info, err := os.Stat(file)
+		if err == nil && !info.ModTime().Equal(modTime) {
+			_ = r.load()
+			return
+		}
+	}
+}
+
+// appendCAFile adds the certificates of the PEM file to the pool
+func appendCAFile(pool *x509.CertPool, file string) error {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("unable to read CA file: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no PEM certificates found in CA file %q", file)
+	}
+	return nil
+}
+
+// load reads the CA bundles and the client key pair
+func (r *certReloader) load() error {
+	o := r.options
+	modTimes := make(map[string]time.Time)
+	stat := func(file string) {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+
+	var pool *x509.CertPool
+	if len(o.caFiles) != 0 {
+		pool = x509.NewCertPool()
+		for _, file := range o.caFiles {
+			stat(file)
+			if err := appendCAFile(pool, file); err != nil {
+				return err
+			}
+		}
+	}
+
+	var cert *tls.Certificate
+	if o.certFile != "" {
+		stat(o.certFile)
+		stat(o.keyFile)
+		keyPair, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		cert = &keyPair
+	}
+
+	r.pool = pool
+	r.cert = cert
+	r.modTimes = modTimes
+	return nil
+}
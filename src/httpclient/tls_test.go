@@ -0,0 +1,248 @@
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCert is a generated certificate and its PEM files
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+// newTestCert generates a certificate signed by parent, or a self signed CA when parent is nil
+func newTestCert(t *testing.T, dir, name string, parent *testCert, hosts ...string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+			continue
+		}
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, _ := x509.ParseCertificate(der)
+
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	assert.NoError(t, os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return c
+}
+
+func TestClient_TLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	otherCA := newTestCert(t, dir, "other-ca", nil)
+	serverCert := newTestCert(t, dir, "server", ca, "127.0.0.1", "service.internal")
+	clientCert := newTestCert(t, dir, "client", ca)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	// reply with the common name of the client certificate
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) != 0 {
+			_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.tlsCertificate()},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    clientCAs,
+		MaxVersion:   tls.VersionTLS12,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	call := func(config *Config) (string, error) {
+		client, err := NewClient(config, &http.Client{}, cauth.NoAuth)
+		if err != nil {
+			return "", err
+		}
+		caller, _ := NewCallerBuilder(client, server.URL, "whoami", GET).Build()
+		resp, err := caller.Call()
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	tt := []struct {
+		name         string
+		config       *ConfigBuilder
+		expected     string
+		expectsError bool
+	}{
+		{
+			name:         "unknown CA",
+			config:       NewConfig(),
+			expectsError: true,
+		},
+		{
+			name:     "custom CA",
+			config:   NewConfig().WithCACertFiles(ca.certFile),
+			expected: "",
+		},
+		{
+			name:         "other CA",
+			config:       NewConfig().WithCACertFiles(otherCA.certFile),
+			expectsError: true,
+		},
+		{
+			name:     "mTLS",
+			config:   NewConfig().WithCACertFiles(ca.certFile).WithClientCertFile(clientCert.certFile, clientCert.keyFile),
+			expected: "client",
+		},
+		{
+			name:     "SNI override",
+			config:   NewConfig().WithCACertFiles(ca.certFile).WithServerName("service.internal"),
+			expected: "",
+		},
+		{
+			name:         "SNI override not in certificate",
+			config:       NewConfig().WithCACertFiles(ca.certFile).WithServerName("other.internal"),
+			expectsError: true,
+		},
+		{
+			name:     "pinned CA public key",
+			config:   NewConfig().WithCACertFiles(ca.certFile).WithPinnedPublicKeys("sha256/" + SPKIHash(ca.cert)),
+			expected: "",
+		},
+		{
+			name:         "pin mismatch",
+			config:       NewConfig().WithCACertFiles(ca.certFile).WithPinnedPublicKeys(SPKIHash(otherCA.cert)),
+			expectsError: true,
+		},
+		{
+			name:         "min TLS version not supported by the server",
+			config:       NewConfig().WithCACertFiles(ca.certFile).WithMinTLSVersion(tls.VersionTLS13),
+			expectsError: true,
+		},
+		{
+			name: "cipher suites",
+			config: NewConfig().WithCACertFiles(ca.certFile).
+				WithCipherSuites(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256),
+			expected: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := tc.config.Build()
+			assert.NoError(t, err)
+			body, err := call(config)
+			if tc.expectsError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, body)
+		})
+	}
+
+	t.Run("pin mismatch error", func(t *testing.T) {
+		config, _ := NewConfig().WithCACertFiles(ca.certFile).WithPinnedPublicKeys(SPKIHash(otherCA.cert)).Build()
+		_, err := call(config)
+		assert.True(t, errors.Is(err, ErrCertificatePinMismatch))
+	})
+
+	t.Run("reload rotated client certificate", func(t *testing.T) {
+		rotateDir := t.TempDir()
+		current := newTestCert(t, rotateDir, "client", ca)
+		config, _ := NewConfig().
+			WithCACertFiles(ca.certFile).
+			WithClientCertFile(current.certFile, current.keyFile).
+			WithCertReloadInterval(time.Millisecond).
+			Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+		caller, _ := NewCallerBuilder(client, server.URL, "whoami", GET).Build()
+
+		whoami := func() string {
+			resp, err := caller.Call()
+			assert.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			body, _ := io.ReadAll(resp.Body)
+			return string(body)
+		}
+		assert.Equal(t, "client", whoami())
+
+		// rotate the certificate on disk with one using a different common name
+		rotated := newTestCert(t, t.TempDir(), "rotated", ca)
+		certPEM, _ := os.ReadFile(rotated.certFile)
+		keyPEM, _ := os.ReadFile(rotated.keyFile)
+		assert.NoError(t, os.WriteFile(current.certFile, certPEM, 0600))
+		assert.NoError(t, os.WriteFile(current.keyFile, keyPEM, 0600))
+		future := time.Now().Add(time.Minute)
+		assert.NoError(t, os.Chtimes(current.certFile, future, future))
+		time.Sleep(5 * time.Millisecond)
+
+		client.CloseIdleConnections()
+		assert.Equal(t, "rotated", whoami())
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := NewConfig().WithCACertFiles(filepath.Join(dir, "missing.crt")).Build()
+		assert.Error(t, err)
+		_, err = NewConfig().WithClientCertFile(clientCert.certFile, "").Build()
+		assert.Error(t, err)
+		_, err = NewConfig().WithPinnedPublicKeys("not-a-pin").Build()
+		assert.Error(t, err)
+	})
+}
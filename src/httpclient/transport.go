@@ -0,0 +1,318 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// default connection pool sizes
+// allow 100 concurrent connection in the connection pool
+const (
+	maxIdleConns        = 100
+	maxConnsPerHost     = 100
+	maxIdleConnsPerHost = 100
+)
+
+// default dialer settings, the same as http.DefaultTransport
+const (
+	defaultDialTimeout = 30 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+)
+
+// errTransportOptions is returned when transport options are set but the client transport is not an *http.Transport
+var errTransportOptions = errors.New("transport and TLS options require the client transport to be an *http.Transport")
+
+// transportOptions holds the connection pool and transport settings of the Config,
+// zero values keep the defaults
+type transportOptions struct {
+	maxIdleConns        int
+	maxConnsPerHost     int
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+	keepAlive           time.Duration
+	disableHTTP2        bool
+	h2c                 bool
+	proxyURL            *url.URL
+	proxy               *Proxy
+	dialer              dialFunc
+	unixSocket          string
+
+	maxResponseHeaderBytes int64
+}
+
+// isSet reports whether any transport setting is configured
+func (o *transportOptions) isSet() bool {
+	return o.maxIdleConns != 0 || o.maxConnsPerHost != 0 || o.maxIdleConnsPerHost != 0 || o.idleConnTimeout != 0 ||
+		o.dialTimeout != 0 || o.tlsHandshakeTimeout != 0 || o.keepAlive != 0 || o.disableHTTP2 || o.h2c ||
+		o.proxyURL != nil || o.proxy != nil || o.dialer != nil || o.unixSocket != "" || o.maxResponseHeaderBytes != 0
+}
+
+// validate checks the transport settings
+func (o *transportOptions) validate() error {
+	if o.maxIdleConns < 0 || o.maxConnsPerHost < 0 || o.maxIdleConnsPerHost < 0 {
+		return errors.New("connection pool sizes can't be negative")
+	}
+	if o.idleConnTimeout < 0 || o.dialTimeout < 0 || o.tlsHandshakeTimeout < 0 {
+		return errors.New("transport timeouts can't be negative")
+	}
+	if o.maxResponseHeaderBytes < 0 {
+		return errors.New("max response header size can't be negative")
+	}
+	if o.h2c && o.disableHTTP2 {
+		return errors.New("h2c requires HTTP/2 to be enabled")
+	}
+	return nil
+}
+
+// PoolStats is a snapshot of the client connection pool usage
+type PoolStats struct {
+	// OpenConns is the number of connections dialed and not closed yet
+	OpenConns int64
+	// DialedConns is the total number of dialed connections
+	DialedConns int64
+	// ReusedConns is the number of requests sent over an already open connection
+	ReusedConns int64
+	// InFlight is the number of requests whose response body is not closed yet
+	InFlight int64
+	// TotalRequests is the total number of sent requests
+	TotalRequests int64
+	// CoalescedRequests is the number of requests served by the response of an identical in flight request
+	CoalescedRequests int64
+}
+
+// poolStats collects the PoolStats counters
+type poolStats struct {
+	openConns     int64
+	dialedConns   int64
+	reusedConns   int64
+	inFlight      int64
+	totalRequests int64
+
+	coalescedRequests int64
+}
+
+// snapshot returns the current counters
+func (s *poolStats) snapshot() PoolStats {
+	return PoolStats{
+		OpenConns:     atomic.LoadInt64(&s.openConns),
+		DialedConns:   atomic.LoadInt64(&s.dialedConns),
+		ReusedConns:   atomic.LoadInt64(&s.reusedConns),
+		InFlight:      atomic.LoadInt64(&s.inFlight),
+		TotalRequests: atomic.LoadInt64(&s.totalRequests),
+
+		CoalescedRequests: atomic.LoadInt64(&s.coalescedRequests),
+	}
+}
+
+// dialContext counts the connections opened by dial
+func (s *poolStats) dialContext(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&s.dialedConns, 1)
+		atomic.AddInt64(&s.openConns, 1)
+		return &countedConn{Conn: conn, onClose: func() { atomic.AddInt64(&s.openConns, -1) }}, nil
+	}
+}
+
+// statsTransport counts the requests and the reused connections
+type statsTransport struct {
+	next  http.RoundTripper
+	stats *poolStats
+}
+
+// RoundTrip sends the request using the next transport while tracking its connection
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s := t.stats
+	atomic.AddInt64(&s.totalRequests, 1)
+	atomic.AddInt64(&s.inFlight, 1)
+	done := func() { atomic.AddInt64(&s.inFlight, -1) }
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&s.reusedConns, 1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	resp.Body = wrapBody(resp.Body, done)
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the next transport
+func (t *statsTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+// closeIdleConnections closes the idle connections of transports supporting it
+func closeIdleConnections(transport http.RoundTripper) {
+	if closer, ok := transport.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// dialFunc dials a connection to the address
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// roundTripperFunc is an adapter to use a function as http.RoundTripper
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip executes the function
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTransport applies the config to a clone of the given transport
+func newTransport(base *http.Transport, config *Config, stats *poolStats) (*http.Transport, error) {
+	o := config.transport
+	t := base.Clone()
+
+	t.MaxIdleConns = valueOrDefault(o.maxIdleConns, maxIdleConns)
+	t.MaxConnsPerHost = valueOrDefault(o.maxConnsPerHost, maxConnsPerHost)
+	t.MaxIdleConnsPerHost = valueOrDefault(o.maxIdleConnsPerHost, maxIdleConnsPerHost)
+	if o.idleConnTimeout > 0 {
+		t.IdleConnTimeout = o.idleConnTimeout
+	}
+	if o.tlsHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = o.tlsHandshakeTimeout
+	}
+	if o.maxResponseHeaderBytes > 0 {
+		t.MaxResponseHeaderBytes = o.maxResponseHeaderBytes
+	}
+	if o.proxyURL != nil {
+		t.Proxy = http.ProxyURL(o.proxyURL)
+	}
+	if o.proxy != nil {
+		t.Proxy = o.proxy.ProxyFor
+	}
+	t.Proxy = directUnixSocket(t.Proxy)
+
+	// keep the dialer of the given transport unless the dialer settings are overridden
+	dial := dialFunc(t.DialContext)
+	if dial == nil || o.dialTimeout != 0 || o.keepAlive != 0 {
+		dialer := &net.Dialer{Timeout: defaultDialTimeout, KeepAlive: defaultKeepAlive}
+		if o.dialTimeout > 0 {
+			dialer.Timeout = o.dialTimeout
+		}
+		if o.keepAlive != 0 {
+			// negative keep alive disables it
+			dialer.KeepAlive = o.keepAlive
+		}
+		dial = dialer.DialContext
+	}
+	if o.dialer != nil {
+		dial = o.dialer
+	}
+	if o.unixSocket != "" {
+		dial = fixedSocketDial(dial, o.unixSocket)
+	}
+	t.DialContext = stats.dialContext(unixSocketDial(dial))
+
+	if config.tls.isSet() {
+		tlsConfig, err := newTLSConfig(&config.tls)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = tlsConfig
+	}
+
+	if o.disableHTTP2 {
+		// a non nil empty map disables HTTP/2
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		return t, nil
+	}
+	t.ForceAttemptHTTP2 = true
+	if o.h2c {
+		// HTTP/2 with prior knowledge over plain text connections for http:// urls
+		h2c := &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return t.DialContext(ctx, network, addr)
+			},
+		}
+		if o.maxResponseHeaderBytes > 0 && o.maxResponseHeaderBytes <= math.MaxUint32 {
+			h2c.MaxHeaderListSize = uint32(o.maxResponseHeaderBytes)
+		}
+		t.RegisterProtocol("http", h2c)
+	}
+	return t, nil
+}
+
+func valueOrDefault(value, defaultValue int) int {
+	if value == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// countedConn calls onClose once the connection is closed
+type countedConn struct {
+	net.Conn
+	closeOnce sync.Once
+	onClose   func()
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(c.onClose)
+	return c.Conn.Close()
+}
+
+// wrapBody calls onClose once the body is closed or fully read, the body of a
+// 101 Switching Protocols response stays writable
+func wrapBody(body io.ReadCloser, onClose func()) io.ReadCloser {
+	wrapped := &onCloseBody{ReadCloser: body, onClose: onClose}
+	if w, ok := body.(io.Writer); ok {
+		return &onCloseReadWriteBody{onCloseBody: wrapped, Writer: w}
+	}
+	return wrapped
+}
+
+// onCloseReadWriteBody is a writable onCloseBody
+type onCloseReadWriteBody struct {
+	*onCloseBody
+	io.Writer
+}
+
+// onCloseBody calls onClose once the body is closed or fully read
+type onCloseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	onClose func()
+}
+
+func (b *onCloseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.onClose)
+	}
+	return n, err
+}
+
+func (b *onCloseBody) Close() error {
+	defer b.once.Do(b.onClose)
+	return b.ReadCloser.Close()
+}
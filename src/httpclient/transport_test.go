@@ -0,0 +1,166 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// protoHandler replies with the request protocol and the request uri
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte(r.Proto + " " + r.RequestURI))
+})
+
+func callBody(t *testing.T, client *Client, host, route string) string {
+	caller, err := NewCallerBuilder(client, host, route, GET).Build()
+	assert.NoError(t, err)
+	resp, err := caller.Call()
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestNewClient_Transport(t *testing.T) {
+	t.Run("pool settings", func(t *testing.T) {
+		config, err := NewConfig().
+			WithMaxIdleConns(10).
+			WithMaxConnsPerHost(5).
+			WithIdleConnTimeout(time.Minute).
+			WithTLSHandshakeTimeout(time.Second).
+			Build()
+		assert.NoError(t, err)
+		client, err := NewClient(config, &http.Client{}, cauth.NoAuth)
+		assert.NoError(t, err)
+
+		transport := client.transport.(*http.Transport)
+		assert.Equal(t, 10, transport.MaxIdleConns)
+		assert.Equal(t, 5, transport.MaxConnsPerHost)
+		assert.Equal(t, maxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+		assert.Equal(t, time.Second, transport.TLSHandshakeTimeout)
+	})
+
+	t.Run("the given client is not modified", func(t *testing.T) {
+		config, _ := NewConfig().Build()
+		original := &http.Transport{}
+		httpClient := &http.Client{Transport: original}
+		_, err := NewClient(config, httpClient, cauth.NoAuth)
+		assert.NoError(t, err)
+		assert.Equal(t, original, httpClient.Transport)
+		assert.Equal(t, 0, original.MaxIdleConns)
+	})
+
+	t.Run("custom round tripper", func(t *testing.T) {
+		called := false
+		rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			called = true
+			return http.DefaultTransport.RoundTrip(req)
+		})
+		server := httptest.NewServer(protoHandler)
+		defer server.Close()
+
+		config, _ := NewConfig().Build()
+		client, err := NewClient(config, &http.Client{Transport: rt}, cauth.NoAuth)
+		assert.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1 /proto", callBody(t, client, server.URL, "proto"))
+		assert.True(t, called)
+
+		config, _ = NewConfig().WithMaxConnsPerHost(1).Build()
+		_, err = NewClient(config, &http.Client{Transport: rt}, cauth.NoAuth)
+		assert.Equal(t, errTransportOptions, err)
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		_, err := NewConfig().WithMaxIdleConns(-1).Build()
+		assert.Error(t, err)
+		_, err = NewConfig().WithDialTimeout(-1).Build()
+		assert.Error(t, err)
+		_, err = NewConfig().WithHTTP2(false).WithH2C(true).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestNewClient_HTTP2(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	serverCert := newTestCert(t, dir, "server", ca, "127.0.0.1")
+
+	server := httptest.NewUnstartedServer(protoHandler)
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert.tlsCertificate()}}
+	server.StartTLS()
+	defer server.Close()
+
+	h2cServer := httptest.NewServer(h2c.NewHandler(protoHandler, &http2.Server{}))
+	defer h2cServer.Close()
+
+	tt := []struct {
+		name     string
+		host     string
+		config   *ConfigBuilder
+		expected string
+	}{
+		{name: "HTTP/2 over TLS", host: server.URL, config: NewConfig().WithCACertFiles(ca.certFile), expected: "HTTP/2.0"},
+		{name: "HTTP/2 disabled", host: server.URL, config: NewConfig().WithCACertFiles(ca.certFile).WithHTTP2(false),
+			expected: "HTTP/1.1"},
+		{name: "h2c", host: h2cServer.URL, config: NewConfig().WithH2C(true), expected: "HTTP/2.0"},
+		{name: "h2c disabled", host: h2cServer.URL, config: NewConfig(), expected: "HTTP/1.1"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := tc.config.Build()
+			assert.NoError(t, err)
+			client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+			assert.Equal(t, tc.expected+" /proto", callBody(t, client, tc.host, "proto"))
+		})
+	}
+}
+
+func TestNewClient_ProxyURL(t *testing.T) {
+	// the proxy stand-in replies with the absolute request uri instead of forwarding the request
+	proxy := httptest.NewServer(protoHandler)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	config, _ := NewConfig().WithProxyURL(proxyURL).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+	assert.Equal(t, "HTTP/1.1 http://upstream.internal/users", callBody(t, client, "http://upstream.internal", "users"))
+}
+
+func TestClient_PoolStats(t *testing.T) {
+	server := httptest.NewServer(protoHandler)
+	defer server.Close()
+
+	config, _ := NewConfig().Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+
+	caller, _ := NewCallerBuilder(client, server.URL, "proto", GET).Build()
+	resp, err := caller.Call()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), client.PoolStats().InFlight)
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	callBody(t, client, server.URL, "proto")
+
+	stats := client.PoolStats()
+	assert.Equal(t, PoolStats{OpenConns: 1, DialedConns: 1, ReusedConns: 1, InFlight: 0, TotalRequests: 2}, stats)
+
+	client.CloseIdleConnections()
+	assert.Equal(t, int64(0), client.PoolStats().OpenConns)
+}
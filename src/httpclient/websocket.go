@@ -0,0 +1,859 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sghaida/go-stuff/src/retry"
+)
+
+// MessageType is the type of a websocket data message
+type MessageType int
+
+const (
+	// TextMessage is an utf-8 text message
+	TextMessage MessageType = opText
+	// BinaryMessage is a binary message
+	BinaryMessage MessageType = opBinary
+)
+
+// websocket close codes as defined in RFC 6455
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseAbnormal        = 1006
+	CloseInvalidPayload  = 1007
+	CloseMessageTooBig   = 1009
+)
+
+// websocket frame opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const (
+	// websocketGUID is concatenated with the handshake key to compute the accept key
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// maxControlPayload is the max payload size of the control frames
+	maxControlPayload = 125
+	// closeTimeout is how long Close waits for the close reply of the server
+	closeTimeout = time.Second
+	// defaultMaxMessageSize is the max message size unless set on the websocket or in the client config
+	defaultMaxMessageSize = 32 << 20
+)
+
+var (
+	// ErrWebSocketClosed is returned when using a websocket closed by Close
+	ErrWebSocketClosed = errors.New("websocket closed")
+	// ErrWebSocketHandshake is returned when the server rejects the websocket upgrade
+	ErrWebSocketHandshake = errors.New("websocket handshake failed")
+)
+
+// CloseError is returned when the connection is closed with a close frame
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed with code %d: %s", e.Code, e.Reason)
+}
+
+// WebSocket is a RFC 6455 websocket client connecting through the Client, so that the handshake uses the
+// client config, TLS, proxy, cookies, default and auth headers, built using WebSocketBuilder.
+// one goroutine at a time may read while writes are safe for concurrent use
+type WebSocket struct {
+	client         *Client
+	host           string
+	route          string
+	headers        map[string]string
+	protocols      []string
+	pingInterval   time.Duration
+	maxMessageSize int64
+	fragmentSize   int
+	reconnectTries int
+	onReconnect    func()
+
+	endpoint   *url.URL
+	socketPath string
+	mutex      *sync.Mutex
+	conn       *wsConn
+	generation int
+	closed     bool
+	// closing is closed by Close to stop a reconnection
+	closing chan struct{}
+	// reconnecting is closed when the reconnection in progress, if not nil, is over
+	reconnecting chan struct{}
+}
+
+// WebSocketBuilder builds the WebSocket
+type WebSocketBuilder struct {
+	client         *Client
+	host           string
+	route          string
+	headers        map[string]string
+	protocols      []string
+	pingInterval   time.Duration
+	maxMessageSize int64
+	fragmentSize   int
+	reconnectTries int
+	onReconnect    func()
+}
+
+// NewWebSocket creates a WebSocketBuilder for the ws, wss, http, https or unix host and the route
+func NewWebSocket(client *Client, host, route string) *WebSocketBuilder {
+	return &WebSocketBuilder{
+		client:  client,
+		host:    host,
+		route:   route,
+		headers: make(map[string]string),
+	}
+}
+
+// WithHeaders add handshake headers
+func (b *WebSocketBuilder) WithHeaders(headers map[string]string) *WebSocketBuilder {
+	for key, value := range headers {
+		b.headers[key] = value
+	}
+	return b
+}
+
+// WithProtocols request the sub protocols, in order of preference
+func (b *WebSocketBuilder) WithProtocols(protocols ...string) *WebSocketBuilder {
+	b.protocols = protocols
+	return b
+}
+
+// WithPingInterval send a ping every interval and drop the connection if nothing is received for two intervals
+// while a goroutine is reading the messages
+func (b *WebSocketBuilder) WithPingInterval(interval time.Duration) *WebSocketBuilder {
+	b.pingInterval = interval
+	return b
+}
+
+// WithMaxMessageSize close the connection when a message exceeds size bytes. by default the max response size
+// of the client config applies, or 32MB if not set
+func (b *WebSocketBuilder) WithMaxMessageSize(size int64) *WebSocketBuilder {
+	b.maxMessageSize = size
+	return b
+}
+
+// WithFragmentSize split the written messages into frames of size bytes
+func (b *WebSocketBuilder) WithFragmentSize(size int) *WebSocketBuilder {
+	b.fragmentSize = size
+	return b
+}
+
+// WithReconnect reconnect when the connection drops, trying up to maxTries times with the backoff of
+// the retry package. onReconnect, if not nil, is called after each reconnection e.g. to subscribe again
+func (b *WebSocketBuilder) WithReconnect(maxTries int, onReconnect func()) *WebSocketBuilder {
+	b.reconnectTries = maxTries
+	b.onReconnect = onReconnect
+	return b
+}
+
+// Build validates the WebSocket
+func (b *WebSocketBuilder) Build() (*WebSocket, error) {
+	if b.client == nil {
+		return nil, errors.New("client can't be nil")
+	}
+	if b.pingInterval < 0 {
+		return nil, errors.New("ping interval can't be negative")
+	}
+	if b.maxMessageSize < 0 {
+		return nil, errors.New("max message size can't be negative")
+	}
+	if b.fragmentSize < 0 {
+		return nil, errors.New("fragment size can't be negative")
+	}
+	if b.reconnectTries < 0 {
+		return nil, errors.New("reconnect tries can't be negative")
+	}
+
+	host := b.host
+	switch {
+	case strings.HasPrefix(host, "ws://"):
+		host = "http://" + strings.TrimPrefix(host, "ws://")
+	case strings.HasPrefix(host, "wss://"):
+		host = "https://" + strings.TrimPrefix(host, "wss://")
+	}
+	endpoint, socketPath, err := buildEndpoint(host, b.route, nil)
+	if err != nil {
+		return nil, err
+	}
+	maxMessageSize := b.maxMessageSize
+	if maxMessageSize == 0 {
+		maxMessageSize = defaultMaxMessageSize
+		if b.client.config.maxResponseSize > 0 {
+			maxMessageSize = b.client.config.maxResponseSize
+		}
+	}
+	headers := make(map[string]string, len(b.headers))
+	for key, value := range b.headers {
+		headers[key] = value
+	}
+	return &WebSocket{
+		client:         b.client,
+		host:           b.host,
+		route:          b.route,
+		headers:        headers,
+		protocols:      append([]string(nil), b.protocols...),
+		pingInterval:   b.pingInterval,
+		maxMessageSize: maxMessageSize,
+		fragmentSize:   b.fragmentSize,
+		reconnectTries: b.reconnectTries,
+		onReconnect:    b.onReconnect,
+		endpoint:       endpoint,
+		socketPath:     socketPath,
+		mutex:          new(sync.Mutex),
+		closing:        make(chan struct{}),
+	}, nil
+}
+
+// Connect does the websocket handshake, it does nothing if already connected
+func (ws *WebSocket) Connect(ctx context.Context) error {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	if ws.closed {
+		return ErrWebSocketClosed
+	}
+	if ws.conn != nil {
+		return nil
+	}
+	conn, err := ws.dial(ctx)
+	if err != nil {
+		return err
+	}
+	ws.conn = conn
+	ws.generation++
+	return nil
+}
+
+// Protocol returns the sub protocol selected by the server
+func (ws *WebSocket) Protocol() string {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	if ws.conn == nil {
+		return ""
+	}
+	return ws.conn.protocol
+}
+
+// ReadMessage reads the next data message, the ping and close frames are answered while reading.
+// when the connection drops it reconnects if enabled and reads from the new connection
+func (ws *WebSocket) ReadMessage() (MessageType, []byte, error) {
+	for {
+		conn, generation, err := ws.current()
+		if err != nil {
+			return 0, nil, err
+		}
+		messageType, message, err := conn.readMessage()
+		if err == nil {
+			return messageType, message, nil
+		}
+		if err := ws.reconnect(generation, err); err != nil {
+			return 0, nil, err
+		}
+	}
+}
+
+// WriteMessage writes a data message, when the connection drops it reconnects
+// if enabled and writes the message to the new connection
+func (ws *WebSocket) WriteMessage(messageType MessageType, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("invalid websocket message type %d", messageType)
+	}
+	conn, generation, err := ws.current()
+	if err != nil {
+		return err
+	}
+	err = conn.writeMessage(byte(messageType), data, ws.fragmentSize)
+	if err == nil {
+		return nil
+	}
+	if err := ws.reconnect(generation, err); err != nil {
+		return err
+	}
+	if conn, _, err = ws.current(); err != nil {
+		return err
+	}
+	return conn.writeMessage(byte(messageType), data, ws.fragmentSize)
+}
+
+// Ping sends a ping frame with the payload
+func (ws *WebSocket) Ping(payload []byte) error {
+	if len(payload) > maxControlPayload {
+		return fmt.Errorf("ping payload exceeds %d bytes", maxControlPayload)
+	}
+	conn, _, err := ws.current()
+	if err != nil {
+		return err
+	}
+	return conn.writeFrame(true, opPing, payload)
+}
+
+// Close does the close handshake and closes the connection, the websocket can't be used afterwards
+func (ws *WebSocket) Close() error {
+	ws.mutex.Lock()
+	if ws.closed {
+		ws.mutex.Unlock()
+		return nil
+	}
+	ws.closed = true
+	close(ws.closing)
+	conn := ws.conn
+	reconnecting := ws.reconnecting != nil
+	ws.mutex.Unlock()
+	// the connection being replaced is already shut down
+	if conn == nil || reconnecting {
+		return nil
+	}
+	return conn.close(CloseNormal, "")
+}
+
+// current returns the connection and its generation
+func (ws *WebSocket) current() (*wsConn, int, error) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	if ws.closed {
+		return nil, 0, ErrWebSocketClosed
+	}
+	if ws.conn == nil {
+		return nil, 0, errors.New("websocket is not connected")
+	}
+	return ws.conn, ws.generation, nil
+}
+
+// reconnect replaces the connection of the given generation which failed with cause, unless it was already
+// replaced. cause is returned if reconnecting is disabled or the server closed the connection normally.
+// the lock isn't held while dialing so that Close stops the reconnection, the callers meanwhile wait for it
+func (ws *WebSocket) reconnect(generation int, cause error) error {
+	ws.mutex.Lock()
+	if ws.closed {
+		ws.mutex.Unlock()
+		return ErrWebSocketClosed
+	}
+	if ws.generation != generation {
+		ws.mutex.Unlock()
+		return nil
+	}
+	var closeErr *CloseError
+	if ws.reconnectTries == 0 || (errors.As(cause, &closeErr) && closeErr.Code == CloseNormal) {
+		ws.mutex.Unlock()
+		return cause
+	}
+	if reconnecting := ws.reconnecting; reconnecting != nil {
+		ws.mutex.Unlock()
+		select {
+		case <-reconnecting:
+			return nil
+		case <-ws.closing:
+			return ErrWebSocketClosed
+		}
+	}
+	reconnecting := make(chan struct{})
+	ws.reconnecting = reconnecting
+	ws.conn.shutdown()
+	ws.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-ws.closing:
+			cancel()
+		case <-reconnecting:
+		}
+	}()
+	dial := retry.NewRetry(ws.reconnectTries, retry.DefaultInitialDelay, retry.DefaultMaxDelay)
+	conn, err := dial.RunWithContext(ctx, func(ctx context.Context) (interface{}, error) {
+		return ws.dial(ctx)
+	})
+
+	ws.mutex.Lock()
+	ws.reconnecting = nil
+	close(reconnecting)
+	if ws.closed {
+		ws.mutex.Unlock()
+		if err == nil {
+			conn.(*wsConn).shutdown()
+		}
+		return ErrWebSocketClosed
+	}
+	if err != nil {
+		ws.mutex.Unlock()
+		return fmt.Errorf("websocket reconnect failed: %w", err)
+	}
+	ws.conn = conn.(*wsConn)
+	ws.generation++
+	ws.mutex.Unlock()
+
+	if ws.onReconnect != nil {
+		ws.onReconnect()
+	}
+	return nil
+}
+
+// dial does the websocket handshake using the client
+func (ws *WebSocket) dial(ctx context.Context) (*wsConn, error) {
+	config := ws.client.config
+	if config.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.timeout)
+		defer cancel()
+	}
+	if ws.socketPath != "" {
+		ctx = withUnixSocket(ctx, ws.socketPath)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ws.endpoint.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	if ws.socketPath != "" {
+		req.Host = "localhost"
+	}
+
+	for key, value := range config.defaultHeaders {
+		req.Header.Add(key, value)
+	}
+	for key, value := range ws.headers {
+		req.Header.Set(key, value)
+	}
+	auth, err := getAuthHeader(ws.client.authType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract auth header: %w", err)
+	}
+	if key, value := auth.GetAuthKeyValue(); key != "" && value != "" {
+		req.Header.Add(key, value)
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if len(ws.protocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(ws.protocols, ", "))
+	}
+
+	resp, err := ws.client.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		DrainAndClose(resp.Body)
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrWebSocketHandshake, resp.StatusCode)
+	}
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%w: the connection isn't writable", ErrWebSocketHandshake)
+	}
+	if err := validateHandshake(resp, key, ws.protocols); err != nil {
+		_ = rwc.Close()
+		return nil, err
+	}
+
+	conn := &wsConn{
+		rwc:            rwc,
+		reader:         bufio.NewReader(rwc),
+		writeMutex:     new(sync.Mutex),
+		maxMessageSize: ws.maxMessageSize,
+		readLock:       make(chan struct{}, 1),
+		protocol:       resp.Header.Get("Sec-WebSocket-Protocol"),
+		done:           make(chan struct{}),
+		closeReceived:  make(chan struct{}),
+	}
+	conn.touch()
+	if ws.pingInterval > 0 {
+		go conn.keepAlive(ws.pingInterval)
+	}
+	return conn, nil
+}
+
+// validateHandshake checks the upgrade headers, the accept key and the selected sub protocol
+func validateHandshake(resp *http.Response, key string, protocols []string) error {
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") ||
+		!headerHasToken(resp.Header, "Connection", "upgrade") {
+		return fmt.Errorf("%w: missing upgrade headers", ErrWebSocketHandshake)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return fmt.Errorf("%w: invalid accept key", ErrWebSocketHandshake)
+	}
+	protocol := resp.Header.Get("Sec-WebSocket-Protocol")
+	if protocol == "" {
+		return nil
+	}
+	for _, p := range protocols {
+		if p == protocol {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unexpected sub protocol %q", ErrWebSocketHandshake, protocol)
+}
+
+// acceptKey computes the Sec-WebSocket-Accept of the handshake key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether the comma separated header values contain the token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsConn is a websocket connection
+type wsConn struct {
+	rwc        io.ReadWriteCloser
+	reader     *bufio.Reader
+	writeMutex *sync.Mutex
+	// maxMessageSize is the max size of the received messages
+	maxMessageSize int64
+	// readLock is held while reading a message
+	readLock chan struct{}
+	protocol string
+	// lastRead is the unix nano time of the last received frame
+	lastRead int64
+
+	done          chan struct{}
+	doneOnce      sync.Once
+	closeSent     int32
+	closeReceived chan struct{}
+	receivedOnce  sync.Once
+}
+
+// touch records that a frame was received
+func (c *wsConn) touch() {
+	atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+}
+
+// keepAlive pings the server and drops the connection if nothing is received for two intervals while reading
+func (c *wsConn) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		// the pongs are only received while reading
+		reading := len(c.readLock) == 1
+		if reading && time.Since(time.Unix(0, atomic.LoadInt64(&c.lastRead))) > 2*interval {
+			c.shutdown()
+			return
+		}
+		if err := c.writeFrame(true, opPing, nil); err != nil {
+			c.shutdown()
+			return
+		}
+	}
+}
+
+// readMessage reads the frames of the next data message
+func (c *wsConn) readMessage() (MessageType, []byte, error) {
+	c.readLock <- struct{}{}
+	defer func() {
+		<-c.readLock
+	}()
+
+	var messageType byte
+	message := make([]byte, 0)
+	for {
+		// the frames of a message share its max size
+		frame, err := readFrame(c.reader, c.maxMessageSize-int64(len(message)), false)
+		if err != nil {
+			var closeErr *CloseError
+			if errors.As(err, &closeErr) {
+				return 0, nil, c.fail(closeErr)
+			}
+			c.shutdown()
+			return 0, nil, err
+		}
+		c.touch()
+
+		switch frame.opcode {
+		case opPing:
+			if err := c.writeFrame(true, opPong, frame.payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.closeFrameReceived(frame.payload)
+		case opText, opBinary:
+			if messageType != 0 {
+				return 0, nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "unfinished fragmented message"})
+			}
+			messageType = frame.opcode
+		case opContinuation:
+			if messageType == 0 {
+				return 0, nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "unexpected continuation frame"})
+			}
+		default:
+			return 0, nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "unknown opcode"})
+		}
+
+		message = append(message, frame.payload...)
+		if !frame.fin {
+			continue
+		}
+		if messageType == opText && !utf8.Valid(message) {
+			return 0, nil, c.fail(&CloseError{Code: CloseInvalidPayload, Reason: "invalid utf-8 text"})
+		}
+		return MessageType(messageType), message, nil
+	}
+}
+
+// closeFrameReceived answers the close frame of the server unless it answers ours
+func (c *wsConn) closeFrameReceived(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		closeErr = &CloseError{Code: CloseProtocolError, Reason: "invalid close payload"}
+	case len(payload) >= 2:
+		closeErr = &CloseError{Code: int(binary.BigEndian.Uint16(payload)), Reason: string(payload[2:])}
+	}
+	if atomic.CompareAndSwapInt32(&c.closeSent, 0, 1) {
+		var reply []byte
+		if closeErr.Code != CloseNoStatus {
+			reply = closePayload(closeErr.Code, "")
+		}
+		_ = c.writeFrame(true, opClose, reply)
+	}
+	c.receivedOnce.Do(func() {
+		close(c.closeReceived)
+	})
+	c.shutdown()
+	return closeErr
+}
+
+// fail closes the connection with the close error
+func (c *wsConn) fail(closeErr *CloseError) error {
+	if atomic.CompareAndSwapInt32(&c.closeSent, 0, 1) {
+		_ = c.writeFrame(true, opClose, closePayload(closeErr.Code, closeErr.Reason))
+	}
+	c.shutdown()
+	return closeErr
+}
+
+// close sends the close frame and waits for the reply of the server, reading it unless a reader is active
+func (c *wsConn) close(code int, reason string) error {
+	defer c.shutdown()
+	if !atomic.CompareAndSwapInt32(&c.closeSent, 0, 1) {
+		return nil
+	}
+	if err := c.writeFrame(true, opClose, closePayload(code, reason)); err != nil {
+		return err
+	}
+
+	select {
+	case c.readLock <- struct{}{}:
+		// no active reader, read until the close reply
+		timer := time.AfterFunc(closeTimeout, c.shutdown)
+		defer timer.Stop()
+		for {
+			frame, err := readFrame(c.reader, c.maxMessageSize, false)
+			if err != nil || frame.opcode == opClose {
+				return nil
+			}
+		}
+	default:
+		select {
+		case <-c.closeReceived:
+		case <-time.After(closeTimeout):
+		}
+		return nil
+	}
+}
+
+// shutdown closes the underlying connection and stops the keep alive
+func (c *wsConn) shutdown() {
+	c.doneOnce.Do(func() {
+		close(c.done)
+		_ = c.rwc.Close()
+	})
+}
+
+// writeMessage writes the data message, split into frames of fragmentSize bytes if set
+func (c *wsConn) writeMessage(opcode byte, data []byte, fragmentSize int) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if fragmentSize <= 0 || len(data) <= fragmentSize {
+		return writeFrame(c.rwc, true, opcode, data, true)
+	}
+	for len(data) > 0 {
+		n := fragmentSize
+		if n > len(data) {
+			n = len(data)
+		}
+		if err := writeFrame(c.rwc, n == len(data), opcode, data[:n], true); err != nil {
+			return err
+		}
+		opcode = opContinuation
+		data = data[n:]
+	}
+	return nil
+}
+
+// writeFrame writes a single masked frame
+func (c *wsConn) writeFrame(fin bool, opcode byte, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return writeFrame(c.rwc, fin, opcode, payload, true)
+}
+
+// closePayload encodes the close code and reason
+func closePayload(code int, reason string) []byte {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return append(payload, reason...)
+}
+
+// wsFrame is a websocket frame
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+// readFrame reads a frame whose payload doesn't exceed maxSize bytes, the payload is read
+// as it arrives rather than allocated from the announced length. the frames of the server must not
+// be masked while the ones of the clients must be, as expected by masked
+func readFrame(r *bufio.Reader, maxSize int64, masked bool) (wsFrame, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return wsFrame{}, err
+	}
+	frame := wsFrame{fin: header[0]&0x80 != 0, opcode: header[0] & 0x0f}
+	if header[0]&0x70 != 0 {
+		return wsFrame{}, &CloseError{Code: CloseProtocolError, Reason: "reserved bits set"}
+	}
+	if (header[1]&0x80 != 0) != masked {
+		return wsFrame{}, &CloseError{Code: CloseProtocolError, Reason: "invalid frame masking"}
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return wsFrame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return wsFrame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+		if length>>63 != 0 {
+			return wsFrame{}, &CloseError{Code: CloseProtocolError, Reason: "invalid payload length"}
+		}
+	}
+	if frame.opcode >= opClose && (!frame.fin || length > maxControlPayload) {
+		return wsFrame{}, &CloseError{Code: CloseProtocolError, Reason: "invalid control frame"}
+	}
+	if frame.opcode < opClose && length > uint64(maxSize) {
+		return wsFrame{}, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return wsFrame{}, err
+		}
+	}
+	var payload bytes.Buffer
+	if _, err := io.CopyN(&payload, r, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return wsFrame{}, err
+	}
+	frame.payload = payload.Bytes()
+	if masked {
+		for i := range frame.payload {
+			frame.payload[i] ^= mask[i%4]
+		}
+	}
+	return frame, nil
+}
+
+// writeFrame writes a frame, masking its payload if masked as the client frames must be
+func writeFrame(w io.Writer, fin bool, opcode byte, payload []byte, masked bool) error {
+	frame := make([]byte, 0, 14+len(payload))
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame = append(frame, first)
+
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[len(frame)-2:], uint16(length))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(length))
+	}
+
+	if !masked {
+		frame = append(frame, payload...)
+	} else {
+		mask := make([]byte, 4)
+		if _, err := rand.Read(mask); err != nil {
+			return err
+		}
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	}
+	_, err := w.Write(frame)
+	return err
+}
@@ -0,0 +1,388 @@
+package httpclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/stretchr/testify/assert"
+)
+
+// wsStandIn is a websocket server echoing the messages, some messages trigger a behaviour:
+// drop drops the connection, bye closes it, fragments replies with a fragmented message,
+// invalid replies with invalid utf-8 text, ping-me pings the client, huge announces a 1TB frame
+// and masked replies with a masked frame
+type wsStandIn struct {
+	mutex   *sync.Mutex
+	headers http.Header
+	// frames is the number of frames of the last message
+	frames int
+	pings  int32
+	pongs  int32
+	closes int32
+}
+
+func (s *wsStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/forbidden" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	s.mutex.Lock()
+	s.headers = r.Header.Clone()
+	s.mutex.Unlock()
+
+	conn, rw, _ := w.(http.Hijacker).Hijack()
+	defer func() {
+		_ = conn.Close()
+	}()
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n"
+	if strings.Contains(r.Header.Get("Sec-WebSocket-Protocol"), "chat") {
+		response += "Sec-WebSocket-Protocol: chat\r\n"
+	}
+	_, _ = conn.Write([]byte(response + "\r\n"))
+	s.serve(conn, rw.Reader)
+}
+
+func (s *wsStandIn) serve(conn net.Conn, reader *bufio.Reader) {
+	var (
+		opcode  byte
+		message []byte
+		frames  int
+	)
+	for {
+		frame, err := readFrame(reader, defaultMaxMessageSize, true)
+		if err != nil {
+			return
+		}
+		switch frame.opcode {
+		case opPing:
+			atomic.AddInt32(&s.pings, 1)
+			_ = writeFrame(conn, true, opPong, frame.payload, false)
+			continue
+		case opPong:
+			atomic.AddInt32(&s.pongs, 1)
+			continue
+		case opClose:
+			atomic.AddInt32(&s.closes, 1)
+			_ = writeFrame(conn, true, opClose, frame.payload, false)
+			return
+		case opText, opBinary:
+			opcode, message, frames = frame.opcode, frame.payload, 1
+		default:
+			message = append(message, frame.payload...)
+			frames++
+		}
+		if !frame.fin {
+			continue
+		}
+		s.mutex.Lock()
+		s.frames = frames
+		s.mutex.Unlock()
+
+		switch string(message) {
+		case "drop":
+			return
+		case "bye":
+			_ = writeFrame(conn, true, opClose, closePayload(CloseNormal, "bye"), false)
+			_, _ = readFrame(reader, defaultMaxMessageSize, true)
+			return
+		case "fragments":
+			_ = writeFrame(conn, false, opText, []byte("frag"), false)
+			_ = writeFrame(conn, true, opPing, []byte("p"), false)
+			_ = writeFrame(conn, false, opContinuation, []byte("men"), false)
+			_ = writeFrame(conn, true, opContinuation, []byte("ted"), false)
+		case "invalid":
+			_ = writeFrame(conn, true, opText, []byte{0xff, 0xfe}, false)
+		case "huge":
+			_, _ = conn.Write([]byte{0x80 | opBinary, 127, 0, 0, 1, 0, 0, 0, 0, 0})
+		case "masked":
+			_ = writeFrame(conn, true, opText, []byte("masked"), true)
+		case "ping-me":
+			_ = writeFrame(conn, true, opPing, []byte("p"), false)
+			_ = writeFrame(conn, true, opText, []byte("pinged"), false)
+		default:
+			_ = writeFrame(conn, true, opcode, message, false)
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	standIn := &wsStandIn{mutex: new(sync.Mutex)}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	wsURL := "ws://" + server.Listener.Addr().String()
+
+	config, _ := NewConfig().WithTimeout(200 * time.Millisecond).
+		WithHeaders(map[string]string{"X-Default": "default"}).Build()
+	client, _ := NewClient(config, &http.Client{}, cauth.NewAPIKey("secret"))
+
+	connect := func(t *testing.T, builder *WebSocketBuilder) *WebSocket {
+		ws, err := builder.Build()
+		assert.NoError(t, err)
+		assert.NoError(t, ws.Connect(context.Background()))
+		t.Cleanup(func() {
+			_ = ws.Close()
+		})
+		return ws
+	}
+	roundTrip := func(t *testing.T, ws *WebSocket, messageType MessageType, message string) string {
+		assert.NoError(t, ws.WriteMessage(messageType, []byte(message)))
+		replyType, reply, err := ws.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, messageType, replyType)
+		return string(reply)
+	}
+
+	t.Run("handshake and echo", func(t *testing.T) {
+		ws := connect(t, NewWebSocket(client, wsURL, "chat").WithProtocols("v2", "chat").
+			WithHeaders(map[string]string{"X-Extra": "extra"}))
+		assert.Equal(t, "chat", ws.Protocol())
+
+		standIn.mutex.Lock()
+		assert.Equal(t, "secret", standIn.headers.Get("x-api-key"))
+		assert.Equal(t, "default", standIn.headers.Get("X-Default"))
+		assert.Equal(t, "extra", standIn.headers.Get("X-Extra"))
+		standIn.mutex.Unlock()
+
+		// the connection outlives the config timeout of the handshake
+		time.Sleep(250 * time.Millisecond)
+		assert.Equal(t, "hello", roundTrip(t, ws, TextMessage, "hello"))
+		large := strings.Repeat("x", 70000)
+		assert.Equal(t, large, roundTrip(t, ws, BinaryMessage, large))
+	})
+
+	t.Run("fragmentation", func(t *testing.T) {
+		ws := connect(t, NewWebSocket(client, wsURL, "chat").WithFragmentSize(4))
+		assert.Equal(t, "fragmented message", roundTrip(t, ws, TextMessage, "fragmented message"))
+		standIn.mutex.Lock()
+		assert.Equal(t, 5, standIn.frames)
+		standIn.mutex.Unlock()
+
+		// the server fragments its reply and pings in between
+		pongs := atomic.LoadInt32(&standIn.pongs)
+		assert.Equal(t, "fragmented", roundTrip(t, ws, TextMessage, "fragments"))
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt32(&standIn.pongs) == pongs+1
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("ping and pong", func(t *testing.T) {
+		ws := connect(t, NewWebSocket(client, wsURL, "chat").WithPingInterval(50*time.Millisecond))
+		pongs := atomic.LoadInt32(&standIn.pongs)
+		assert.Equal(t, "pinged", roundTrip(t, ws, TextMessage, "ping-me"))
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt32(&standIn.pongs) == pongs+1
+		}, time.Second, 5*time.Millisecond)
+
+		pings := atomic.LoadInt32(&standIn.pings)
+		go func() {
+			_, _, _ = ws.ReadMessage()
+		}()
+		time.Sleep(200 * time.Millisecond)
+		assert.GreaterOrEqual(t, atomic.LoadInt32(&standIn.pings)-pings, int32(2))
+		assert.NoError(t, ws.Ping([]byte("manual")))
+	})
+
+	t.Run("close handshake", func(t *testing.T) {
+		closes := atomic.LoadInt32(&standIn.closes)
+		ws := connect(t, NewWebSocket(client, wsURL, "chat"))
+		start := time.Now()
+		assert.NoError(t, ws.Close())
+		assert.Less(t, int64(time.Since(start)), int64(closeTimeout))
+		assert.Equal(t, closes+1, atomic.LoadInt32(&standIn.closes))
+		assert.True(t, errors.Is(ws.WriteMessage(TextMessage, []byte("hello")), ErrWebSocketClosed))
+
+		// with an active reader
+		ws = connect(t, NewWebSocket(client, wsURL, "chat"))
+		read := make(chan error, 1)
+		go func() {
+			_, _, err := ws.ReadMessage()
+			read <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		start = time.Now()
+		assert.NoError(t, ws.Close())
+		assert.Less(t, int64(time.Since(start)), int64(closeTimeout))
+		assert.True(t, errors.Is(<-read, ErrWebSocketClosed))
+	})
+
+	t.Run("closed by the server", func(t *testing.T) {
+		ws := connect(t, NewWebSocket(client, wsURL, "chat").WithReconnect(3, nil))
+		assert.NoError(t, ws.WriteMessage(TextMessage, []byte("bye")))
+		_, _, err := ws.ReadMessage()
+		var closeErr *CloseError
+		if assert.True(t, errors.As(err, &closeErr)) {
+			assert.Equal(t, CloseNormal, closeErr.Code)
+			assert.Equal(t, "bye", closeErr.Reason)
+		}
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		reconnected := make(chan struct{}, 1)
+		ws := connect(t, NewWebSocket(client, wsURL, "chat").WithReconnect(3, func() {
+			reconnected <- struct{}{}
+		}))
+		assert.NoError(t, ws.WriteMessage(TextMessage, []byte("drop")))
+		read := make(chan string, 1)
+		go func() {
+			_, message, _ := ws.ReadMessage()
+			read <- string(message)
+		}()
+		// the reader reconnects, then the message is written on the new connection
+		select {
+		case <-reconnected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("not reconnected")
+		}
+		assert.NoError(t, ws.WriteMessage(TextMessage, []byte("again")))
+		select {
+		case message := <-read:
+			assert.Equal(t, "again", message)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message after reconnecting")
+		}
+		assert.Len(t, reconnected, 0)
+	})
+
+	t.Run("close while reconnecting", func(t *testing.T) {
+		var reconnects int32
+		ws := connect(t, NewWebSocket(client, wsURL, "chat").WithReconnect(10, func() {
+			atomic.AddInt32(&reconnects, 1)
+		}))
+		// the reconnection dials a closed port and backs off for seconds
+		endpoint := *ws.endpoint
+		endpoint.Host = "127.0.0.1:1"
+		ws.endpoint = &endpoint
+		assert.NoError(t, ws.WriteMessage(TextMessage, []byte("drop")))
+		read := make(chan error, 1)
+		go func() {
+			_, _, err := ws.ReadMessage()
+			read <- err
+		}()
+		assert.Eventually(t, func() bool {
+			ws.mutex.Lock()
+			defer ws.mutex.Unlock()
+			return ws.reconnecting != nil
+		}, time.Second, time.Millisecond)
+		start := time.Now()
+		assert.NoError(t, ws.Close())
+		select {
+		case err := <-read:
+			assert.True(t, errors.Is(err, ErrWebSocketClosed), "unexpected error %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the reconnection isn't stopped")
+		}
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&reconnects))
+	})
+
+	t.Run("no reconnect", func(t *testing.T) {
+		ws := connect(t, NewWebSocket(client, wsURL, "chat"))
+		assert.NoError(t, ws.WriteMessage(TextMessage, []byte("drop")))
+		_, _, err := ws.ReadMessage()
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid utf-8", func(t *testing.T) {
+		ws := connect(t, NewWebSocket(client, wsURL, "chat"))
+		assert.NoError(t, ws.WriteMessage(TextMessage, []byte("invalid")))
+		_, _, err := ws.ReadMessage()
+		var closeErr *CloseError
+		if assert.True(t, errors.As(err, &closeErr)) {
+			assert.Equal(t, CloseInvalidPayload, closeErr.Code)
+		}
+	})
+
+	t.Run("max message size", func(t *testing.T) {
+		ws := connect(t, NewWebSocket(client, wsURL, "chat").WithMaxMessageSize(8))
+		assert.NoError(t, ws.WriteMessage(TextMessage, []byte("too long message")))
+		_, _, err := ws.ReadMessage()
+		var closeErr *CloseError
+		if assert.True(t, errors.As(err, &closeErr)) {
+			assert.Equal(t, CloseMessageTooBig, closeErr.Code)
+		}
+	})
+
+	t.Run("default max message size", func(t *testing.T) {
+		ws := connect(t, NewWebSocket(client, wsURL, "chat"))
+		assert.NoError(t, ws.WriteMessage(TextMessage, []byte("huge")))
+		_, _, err := ws.ReadMessage()
+		var closeErr *CloseError
+		if assert.True(t, errors.As(err, &closeErr)) {
+			assert.Equal(t, CloseMessageTooBig, closeErr.Code)
+		}
+
+		// the max response size of the config applies to the messages
+		config, _ := NewConfig().WithMaxResponseSize(8).Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+		ws = connect(t, NewWebSocket(client, wsURL, "chat"))
+		assert.NoError(t, ws.WriteMessage(TextMessage, []byte("too long message")))
+		_, _, err = ws.ReadMessage()
+		if assert.True(t, errors.As(err, &closeErr)) {
+			assert.Equal(t, CloseMessageTooBig, closeErr.Code)
+		}
+	})
+
+	t.Run("masked server frame", func(t *testing.T) {
+		ws := connect(t, NewWebSocket(client, wsURL, "chat"))
+		assert.NoError(t, ws.WriteMessage(TextMessage, []byte("masked")))
+		_, _, err := ws.ReadMessage()
+		var closeErr *CloseError
+		if assert.True(t, errors.As(err, &closeErr)) {
+			assert.Equal(t, CloseProtocolError, closeErr.Code)
+		}
+	})
+
+	t.Run("wss over http/2 enabled tls", func(t *testing.T) {
+		dir := t.TempDir()
+		ca := newTestCert(t, dir, "ca", nil)
+		serverCert := newTestCert(t, dir, "server", ca, "127.0.0.1")
+		tlsServer := httptest.NewUnstartedServer(standIn)
+		tlsServer.EnableHTTP2 = true
+		tlsServer.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert.tlsCertificate()}}
+		tlsServer.StartTLS()
+		defer tlsServer.Close()
+
+		config, _ := NewConfig().WithCACertFiles(ca.certFile).Build()
+		client, _ := NewClient(config, &http.Client{}, cauth.NoAuth)
+		ws := connect(t, NewWebSocket(client, "wss://"+tlsServer.Listener.Addr().String(), "chat"))
+		assert.Equal(t, "secure", roundTrip(t, ws, TextMessage, "secure"))
+	})
+
+	t.Run("handshake rejected", func(t *testing.T) {
+		ws, _ := NewWebSocket(client, wsURL, "forbidden").Build()
+		assert.True(t, errors.Is(ws.Connect(context.Background()), ErrWebSocketHandshake))
+	})
+
+	t.Run("building again creates another websocket", func(t *testing.T) {
+		builder := NewWebSocket(client, wsURL, "chat")
+		ws := connect(t, builder)
+		other, err := builder.WithMaxMessageSize(8).WithHeaders(map[string]string{"X-Extra": "extra"}).Build()
+		assert.NoError(t, err)
+		assert.NotSame(t, ws.mutex, other.mutex)
+		assert.Equal(t, int64(defaultMaxMessageSize), ws.maxMessageSize)
+		assert.Empty(t, ws.headers)
+		assert.Equal(t, "hello", roundTrip(t, ws, TextMessage, "hello"))
+		assert.NoError(t, ws.Close())
+	})
+
+	t.Run("invalid websockets", func(t *testing.T) {
+		_, err := NewWebSocket(client, "ftp://example.com", "chat").Build()
+		assert.Error(t, err)
+		_, err = NewWebSocket(client, wsURL, "chat").WithPingInterval(-time.Second).Build()
+		assert.Error(t, err)
+		_, err = NewWebSocket(nil, wsURL, "chat").Build()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,290 @@
+// Package jsonrpc calls JSON-RPC 2.0 methods using the httpclient Client
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/sghaida/go-stuff/src/httpclient"
+)
+
+// Version is the JSON-RPC protocol version
+const Version = "2.0"
+
+// standard error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+var (
+	// ErrParse is matched by errors.Is for the errors with the parse error code
+	ErrParse = &Error{Code: CodeParseError, Message: "parse error"}
+	// ErrInvalidRequest is matched by errors.Is for the errors with the invalid request code
+	ErrInvalidRequest = &Error{Code: CodeInvalidRequest, Message: "invalid request"}
+	// ErrMethodNotFound is matched by errors.Is for the errors with the method not found code
+	ErrMethodNotFound = &Error{Code: CodeMethodNotFound, Message: "method not found"}
+	// ErrInvalidParams is matched by errors.Is for the errors with the invalid params code
+	ErrInvalidParams = &Error{Code: CodeInvalidParams, Message: "invalid params"}
+	// ErrInternal is matched by errors.Is for the errors with the internal error code
+	ErrInternal = &Error{Code: CodeInternalError, Message: "internal error"}
+	// ErrMissingResponse is set on the batch elements the server didn't reply to
+	ErrMissingResponse = errors.New("jsonrpc: missing response")
+)
+
+// Error is the error object of a JSON-RPC response
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (%d)", e.Message, e.Code)
+}
+
+// Is matches the errors with the same code, which makes the standard errors usable with errors.Is
+func (e *Error) Is(target error) bool {
+	var t *Error
+	return errors.As(target, &t) && t.Code == e.Code
+}
+
+// HTTPError is returned when the server replies with an error status and no JSON-RPC response
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("jsonrpc: unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// BatchElem is a call or a notification of a batch, Error is set once the batch is sent
+type BatchElem struct {
+	Method string
+	Params interface{}
+	// Result is decoded from the response result, it may be nil to ignore the result
+	Result interface{}
+	// Notification elements don't get a response
+	Notification bool
+	Error        error
+}
+
+// request is a JSON-RPC request, notifications have no id
+type request struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	ID      *uint64     `json:"id,omitempty"`
+}
+
+// response is a JSON-RPC response, the id is null when the server couldn't read the request id
+type response struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error"`
+	ID      *uint64         `json:"id"`
+}
+
+// Client calls the methods of a JSON-RPC endpoint, built using ClientBuilder.
+// the auth and timeout of the httpclient Client config apply to every call, the calls are POST requests
+// which are retried according to the config only when sent WithIdempotencyKey
+type Client struct {
+	// lastID is first to be 64 bit aligned for the atomic operations
+	lastID            uint64
+	client            *httpclient.Client
+	host              string
+	route             string
+	headers           map[string]string
+	idempotencyHeader string
+}
+
+// ClientBuilder builds the JSON-RPC Client
+type ClientBuilder struct {
+	lastID            uint64
+	client            *httpclient.Client
+	host              string
+	route             string
+	headers           map[string]string
+	idempotencyHeader string
+}
+
+// NewClient creates a ClientBuilder calling the endpoint at the route of the host e.g. "rpc"
+func NewClient(client *httpclient.Client, host, route string) *ClientBuilder {
+	return &ClientBuilder{
+		client:  client,
+		host:    host,
+		route:   route,
+		headers: make(map[string]string),
+	}
+}
+
+// WithHeaders add request headers
+func (b *ClientBuilder) WithHeaders(headers map[string]string) *ClientBuilder {
+	for key, value := range headers {
+		b.headers[key] = value
+	}
+	return b
+}
+
+// WithIdempotencyKey send an idempotency key in the header, httpclient.DefaultIdempotencyHeader if empty,
+// which allows retrying the calls on failures according to the retry count of the client config
+func (b *ClientBuilder) WithIdempotencyKey(header string) *ClientBuilder {
+	if header == "" {
+		header = httpclient.DefaultIdempotencyHeader
+	}
+	b.idempotencyHeader = header
+	return b
+}
+
+// Build validates the JSON-RPC Client
+func (b *ClientBuilder) Build() (*Client, error) {
+	if b.client == nil {
+		return nil, errors.New("client can't be nil")
+	}
+	if _, err := httpclient.NewCallerBuilder(b.client, b.host, b.route, httpclient.POST).Build(); err != nil {
+		return nil, err
+	}
+	return (*Client)(b), nil
+}
+
+// Call calls the method with the params, which should marshal to a JSON array or object or be nil,
+// and decodes the result into result unless it is nil. a JSON-RPC error is returned as *Error
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	id := atomic.AddUint64(&c.lastID, 1)
+	body, err := c.post(ctx, request{Version: Version, Method: method, Params: params, ID: &id})
+	if err != nil {
+		return err
+	}
+	var resp response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("jsonrpc: malformed response: %w", err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.ID == nil || *resp.ID != id {
+		return fmt.Errorf("jsonrpc: response id doesn't match request id %d", id)
+	}
+	return decodeResult(resp.Result, result)
+}
+
+// Notify calls the method without waiting for a result, the server doesn't reply to notifications
+func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
+	_, err := c.post(ctx, request{Version: Version, Method: method, Params: params})
+	return err
+}
+
+// BatchCall sends the elements in a single batch request and correlates the responses by id.
+// the returned error is about the batch as a whole, the error of each element is set on the element
+func (c *Client) BatchCall(ctx context.Context, batch []*BatchElem) error {
+	if len(batch) == 0 {
+		return errors.New("jsonrpc: empty batch")
+	}
+	requests := make([]request, 0, len(batch))
+	pending := make(map[uint64]*BatchElem, len(batch))
+	for _, elem := range batch {
+		req := request{Version: Version, Method: elem.Method, Params: elem.Params}
+		if !elem.Notification {
+			id := atomic.AddUint64(&c.lastID, 1)
+			req.ID = &id
+			pending[id] = elem
+		}
+		elem.Error = nil
+		requests = append(requests, req)
+	}
+
+	body, err := c.post(ctx, requests)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	// a server which can't read the batch replies with a single error response
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		var resp response
+		if err := json.Unmarshal(trimmed, &resp); err != nil {
+			return fmt.Errorf("jsonrpc: malformed response: %w", err)
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		return errors.New("jsonrpc: batch replied with a single response")
+	}
+	var responses []response
+	if err := json.Unmarshal(body, &responses); err != nil {
+		return fmt.Errorf("jsonrpc: malformed response: %w", err)
+	}
+	for _, resp := range responses {
+		if resp.ID == nil {
+			if resp.Error != nil {
+				return resp.Error
+			}
+			continue
+		}
+		elem, ok := pending[*resp.ID]
+		if !ok {
+			continue
+		}
+		delete(pending, *resp.ID)
+		if resp.Error != nil {
+			elem.Error = resp.Error
+			continue
+		}
+		elem.Error = decodeResult(resp.Result, elem.Result)
+	}
+	for _, elem := range pending {
+		elem.Error = ErrMissingResponse
+	}
+	return nil
+}
+
+// post sends the payload and returns the response body
+func (c *Client) post(ctx context.Context, payload interface{}) ([]byte, error) {
+	builder := httpclient.NewCallerBuilder(c.client, c.host, c.route, httpclient.POST).
+		WithHeaders(c.headers).
+		WithBody(payload, httpclient.MediaTypeJSON).
+		WithAccept(httpclient.MediaTypeJSON)
+	if c.idempotencyHeader != "" {
+		builder.WithIdempotencyKey(c.idempotencyHeader, nil)
+	}
+	caller, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := caller.RetryableCallWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer httpclient.DrainAndClose(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response body: %w", err)
+	}
+	// servers may reply to JSON-RPC errors with an error status
+	if (resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices) && !json.Valid(body) {
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
+
+// decodeResult unmarshals the result into v unless v is nil
+func decodeResult(result json.RawMessage, v interface{}) error {
+	if v == nil || len(result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(result, v); err != nil {
+		return fmt.Errorf("jsonrpc: unable to decode result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sghaida/go-stuff/src/cauth"
+	"github.com/sghaida/go-stuff/src/httpclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// rpcStandIn serves add, echo and flaky which fails once with 503, the notifications are recorded
+type rpcStandIn struct {
+	mutex         *sync.Mutex
+	notifications []string
+	apiKeys       []string
+	flaky         int
+}
+
+func (s *rpcStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error"},"id":null}`))
+		return
+	}
+	s.mutex.Lock()
+	s.apiKeys = append(s.apiKeys, r.Header.Get("x-api-key"))
+	if r.URL.Path == "/flaky" && s.flaky == 0 {
+		s.flaky++
+		s.mutex.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if raw[0] != '[' {
+		if resp := s.handle(raw); resp != nil {
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var batch []json.RawMessage
+	_ = json.Unmarshal(raw, &batch)
+	responses := make([]map[string]interface{}, 0)
+	// replies in reverse order to check the correlation by id
+	for i := len(batch) - 1; i >= 0; i-- {
+		if resp := s.handle(batch[i]); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	_ = json.NewEncoder(w).Encode(responses)
+}
+
+func (s *rpcStandIn) handle(raw json.RawMessage) map[string]interface{} {
+	var req struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+		ID     *uint64         `json:"id"`
+	}
+	_ = json.Unmarshal(raw, &req)
+	if req.ID == nil {
+		s.mutex.Lock()
+		s.notifications = append(s.notifications, req.Method)
+		s.mutex.Unlock()
+		return nil
+	}
+	resp := map[string]interface{}{"jsonrpc": Version, "id": *req.ID}
+	switch req.Method {
+	case "add":
+		var params []int
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			resp["error"] = map[string]interface{}{"code": CodeInvalidParams, "message": "invalid params", "data": "expected numbers"}
+			break
+		}
+		sum := 0
+		for _, p := range params {
+			sum += p
+		}
+		resp["result"] = sum
+	case "echo":
+		resp["result"] = req.Params
+	case "skip":
+		return nil
+	default:
+		resp["error"] = map[string]interface{}{"code": CodeMethodNotFound, "message": "method not found"}
+	}
+	return resp
+}
+
+func TestClient(t *testing.T) {
+	standIn := &rpcStandIn{mutex: new(sync.Mutex)}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	config, _ := httpclient.NewConfig().WithRetry(2).Build()
+	client, _ := httpclient.NewClient(config, &http.Client{}, cauth.NewAPIKey("secret"))
+	rpc, err := NewClient(client, server.URL, "rpc").Build()
+	assert.NoError(t, err)
+
+	t.Run("call", func(t *testing.T) {
+		var sum int
+		assert.NoError(t, rpc.Call(context.Background(), "add", []int{1, 2, 3}, &sum))
+		assert.Equal(t, 6, sum)
+
+		var echo map[string]string
+		assert.NoError(t, rpc.Call(context.Background(), "echo", map[string]string{"key": "value"}, &echo))
+		assert.Equal(t, map[string]string{"key": "value"}, echo)
+
+		standIn.mutex.Lock()
+		assert.Equal(t, "secret", standIn.apiKeys[len(standIn.apiKeys)-1])
+		standIn.mutex.Unlock()
+	})
+
+	t.Run("error mapping", func(t *testing.T) {
+		err := rpc.Call(context.Background(), "missing", nil, nil)
+		assert.True(t, errors.Is(err, ErrMethodNotFound))
+		assert.False(t, errors.Is(err, ErrInvalidParams))
+
+		err = rpc.Call(context.Background(), "add", []string{"a"}, nil)
+		var rpcErr *Error
+		if assert.True(t, errors.As(err, &rpcErr)) {
+			assert.Equal(t, CodeInvalidParams, rpcErr.Code)
+			assert.Equal(t, `"expected numbers"`, string(rpcErr.Data))
+		}
+	})
+
+	t.Run("notification", func(t *testing.T) {
+		assert.NoError(t, rpc.Notify(context.Background(), "log", []string{"hello"}))
+		standIn.mutex.Lock()
+		assert.Equal(t, []string{"log"}, standIn.notifications)
+		standIn.mutex.Unlock()
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		var sum, other int
+		batch := []*BatchElem{
+			{Method: "add", Params: []int{1, 2}, Result: &sum},
+			{Method: "audit", Params: []string{"batch"}, Notification: true},
+			{Method: "add", Params: []int{3, 4}, Result: &other},
+			{Method: "missing"},
+			{Method: "skip"},
+		}
+		assert.NoError(t, rpc.BatchCall(context.Background(), batch))
+		assert.NoError(t, batch[0].Error)
+		assert.Equal(t, 3, sum)
+		assert.NoError(t, batch[1].Error)
+		assert.NoError(t, batch[2].Error)
+		assert.Equal(t, 7, other)
+		assert.True(t, errors.Is(batch[3].Error, ErrMethodNotFound))
+		assert.True(t, errors.Is(batch[4].Error, ErrMissingResponse))
+
+		standIn.mutex.Lock()
+		assert.Contains(t, standIn.notifications, "audit")
+		standIn.mutex.Unlock()
+
+		assert.Error(t, rpc.BatchCall(context.Background(), nil))
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		// calls are not retried unless they carry an idempotency key
+		flaky, _ := NewClient(client, server.URL, "flaky").Build()
+		var httpErr *HTTPError
+		assert.True(t, errors.As(flaky.Call(context.Background(), "add", []int{1}, nil), &httpErr))
+		assert.Equal(t, http.StatusServiceUnavailable, httpErr.StatusCode)
+
+		standIn.mutex.Lock()
+		standIn.flaky = 0
+		standIn.mutex.Unlock()
+		flaky, _ = NewClient(client, server.URL, "flaky").WithIdempotencyKey("").Build()
+		var sum int
+		assert.NoError(t, flaky.Call(context.Background(), "add", []int{1, 1}, &sum))
+		assert.Equal(t, 2, sum)
+	})
+
+	t.Run("invalid clients", func(t *testing.T) {
+		_, err := NewClient(nil, server.URL, "rpc").Build()
+		assert.Error(t, err)
+		_, err = NewClient(client, "", "rpc").Build()
+		assert.Error(t, err)
+	})
+}
@@ -2,6 +2,7 @@ package retry
 
 import (
 	"context"
+	"errors"
 	"math"
 	"math/rand"
 	"time"
@@ -20,6 +21,25 @@ type Retry struct {
 	maxDelay     time.Duration
 }
 
+// TerminationError stops the retries, Run and RunWithContext return the wrapped error
+type TerminationError struct {
+	Err error
+}
+
+func (e *TerminationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *TerminationError) Unwrap() error {
+	return e.Err
+}
+
+// Terminate wraps err into a TerminationError so that it is returned without further retries
+func Terminate(err error) error {
+	return &TerminationError{Err: err}
+}
+
 // NewRetry initialize new retry
 func NewRetry(maxTries int, initialDelay, maxDelay time.Duration) *Retry {
 	if maxTries <= 0 {
@@ -59,6 +79,11 @@ func (r *Retry) RunWithContext(
 		if err == nil {
 			return result, nil
 		}
+		// termination error, return the wrapped error without retrying
+		var terminate *TerminationError
+		if errors.As(err, &terminate) {
+			return nil, terminate.Err
+		}
 		// max retries is reached return the error
 		attempts++
 		if attempts == r.maxTries {
@@ -172,4 +172,18 @@ func TestRetry_RunWithContext(t *testing.T) {
 		assert.GreaterOrEqual(t, tries, 1, fmt.Sprintf("expected at less than 3, got %d", tries))
 		assert.Equal(t, err, testErr, fmt.Sprintf("err should equal Test error, got: %v", err))
 	})
+
+	t.Run("termination error stops the retries", func(t *testing.T) {
+		tries := 0
+		retry := NewRetry(5, 10*time.Millisecond, 10*time.Millisecond)
+
+		res, err := retry.Run(func() (interface{}, error) {
+			tries++
+			return nil, fmt.Errorf("wrapped: %w", Terminate(testErr))
+		})
+
+		assert.Equal(t, 1, tries, fmt.Sprintf("expected 1 try, got %d", tries))
+		assert.Equal(t, testErr, err, fmt.Sprintf("err should equal testErr, got: %v", err))
+		assert.Nil(t, res)
+	})
 }